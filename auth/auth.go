@@ -0,0 +1,79 @@
+// Package auth provides authentication middlewares for ngamux: HTTP
+// Basic, bearer tokens and API keys with pluggable validators, and
+// HMAC-signed requests for webhooks.
+//
+// Every middleware stores the authenticated caller as a *Principal in the
+// request context, where handlers read it with
+// ngamux.Req(r).Principal() or FromContext, whichever middleware
+// authenticated the request. The middlewares are plain
+// func(http.HandlerFunc) http.HandlerFunc values, assignable to
+// ngamux.MiddlewareFunc.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+var (
+	// ErrMissingCredentials is reported when the request carries no
+	// credentials for the middleware.
+	ErrMissingCredentials = errors.New("auth: missing credentials")
+	// ErrInvalidCredentials is reported when the credentials are wrong.
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Subject identifies the caller, e.g. a user name or key ID.
+	Subject string
+	// Method names the mechanism that authenticated the caller, e.g.
+	// "basic", "bearer", "apikey" or "hmac".
+	Method string
+	// Roles and Scopes are used by authorization checks.
+	Roles  []string
+	Scopes []string
+	// Attributes holds any other information about the caller.
+	Attributes map[string]any
+}
+
+// HasRole reports whether the principal has role.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && slices.Contains(p.Roles, role)
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+type contextKey struct{}
+
+// FromContext returns the principal stored in ctx, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// ErrorHandler writes the response for a request that failed
+// authentication. err is one of the errors exported by this package or
+// an error returned by a validator.
+type ErrorHandler func(rw http.ResponseWriter, r *http.Request, err error)
+
+// unauthorized returns the default ErrorHandler, replying 401 with the
+// given WWW-Authenticate challenge when it is not empty.
+func unauthorized(challenge string) ErrorHandler {
+	return func(rw http.ResponseWriter, r *http.Request, err error) {
+		if challenge != "" {
+			rw.Header().Set("WWW-Authenticate", challenge)
+		}
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+}
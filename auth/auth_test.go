@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestPrincipal(t *testing.T) {
+	must := must.New(t)
+	p := &Principal{Roles: []string{"admin"}, Scopes: []string{"users:read"}}
+	must.True(p.HasRole("admin"))
+	must.False(p.HasRole("user"))
+	must.True(p.HasScope("users:read"))
+	must.False(p.HasScope("users:write"))
+
+	var none *Principal
+	must.False(none.HasRole("admin"))
+	must.False(none.HasScope("users:read"))
+}
+
+func TestContext(t *testing.T) {
+	must := must.New(t)
+	must.Nil(FromContext(context.Background()))
+
+	p := &Principal{Subject: "alice"}
+	must.Equal(p, FromContext(NewContext(context.Background(), p)))
+}
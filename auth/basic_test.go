@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestBasic(t *testing.T) {
+	mw := Basic(BasicConfig{Realm: "admin", Users: map[string]string{"alice": "secret"}})
+
+	serve := func(setup func(r *http.Request)) (*httptest.ResponseRecorder, *Principal) {
+		var principal *Principal
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		setup(req)
+		rec := httptest.NewRecorder()
+		mw(func(rw http.ResponseWriter, r *http.Request) {
+			principal = FromContext(r.Context())
+		})(rec, req)
+		return rec, principal
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		must := must.New(t)
+		rec, principal := serve(func(r *http.Request) { r.SetBasicAuth("alice", "secret") })
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal("alice", principal.Subject)
+		must.Equal("basic", principal.Method)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		must := must.New(t)
+		rec, principal := serve(func(r *http.Request) { r.SetBasicAuth("alice", "nope") })
+		must.Equal(http.StatusUnauthorized, rec.Code)
+		must.Equal(`Basic realm="admin", charset="UTF-8"`, rec.Header().Get("WWW-Authenticate"))
+		must.Nil(principal)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		must := must.New(t)
+		rec, _ := serve(func(r *http.Request) { r.SetBasicAuth("bob", "") })
+		must.Equal(http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		must := must.New(t)
+		rec, _ := serve(func(r *http.Request) {})
+		must.Equal(http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("custom validator and error handler", func(t *testing.T) {
+		must := must.New(t)
+		var reason error
+		mw := Basic(BasicConfig{
+			Validator: func(r *http.Request, username, password string) (*Principal, error) {
+				if username == "svc" {
+					return &Principal{Subject: username, Roles: []string{"service"}}, nil
+				}
+				return nil, nil
+			},
+			ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+				reason = err
+				rw.WriteHeader(http.StatusForbidden)
+			},
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("other", "x")
+		rec := httptest.NewRecorder()
+		mw(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+		must.Equal(http.StatusForbidden, rec.Code)
+		must.True(errors.Is(reason, ErrInvalidCredentials))
+
+		req.SetBasicAuth("svc", "x")
+		mw(func(rw http.ResponseWriter, r *http.Request) {
+			must.True(FromContext(r.Context()).HasRole("service"))
+		})(httptest.NewRecorder(), req)
+	})
+}
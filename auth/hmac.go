@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is reported when the request signature does not
+	// match the request.
+	ErrInvalidSignature = errors.New("auth: invalid signature")
+	// ErrTimestampSkew is reported when the signed timestamp is missing,
+	// malformed or outside the accepted tolerance.
+	ErrTimestampSkew = errors.New("auth: timestamp outside tolerance")
+	// ErrReplayed is reported when a signature was already used within
+	// the replay window.
+	ErrReplayed = errors.New("auth: replayed request")
+	// ErrBodyTooLarge is reported when the body exceeds MaxBodySize.
+	ErrBodyTooLarge = errors.New("auth: body too large")
+)
+
+// HMACConfig configures the HMAC request signature middleware.
+//
+// The signature is the hex encoded HMAC of the canonical request, sent
+// as "<algorithm>=<hex>" (e.g. "sha256=ab12...") or bare hex in
+// SignatureHeader. The default canonical request is the timestamp,
+// method, request URI and body joined by newlines.
+type HMACConfig struct {
+	// Secret returns the shared secret for a key ID, as sent in
+	// KeyIDHeader (empty when the header is not used). It is required.
+	Secret func(keyID string) ([]byte, bool)
+	// Hash is the hash function. It defaults to SHA-256.
+	Hash func() hash.Hash
+	// Algorithm is the prefix expected before the hex signature. It
+	// defaults to "sha256".
+	Algorithm string
+
+	// SignatureHeader carries the signature.
+	SignatureHeader string
+	// TimestampHeader carries the signing time as Unix seconds.
+	TimestampHeader string
+	// KeyIDHeader carries the ID of the key used to sign. Leave it empty
+	// when a single secret is shared.
+	KeyIDHeader string
+
+	// Canonical builds the signed message. Override it to match the
+	// format of a third-party webhook sender.
+	Canonical func(r *http.Request, timestamp string, body []byte) []byte
+
+	// Tolerance is the maximum accepted difference between the signed
+	// Unix timestamp and the server clock.
+	Tolerance time.Duration
+	// ReplayWindow is how long used signatures are remembered and
+	// rejected. It defaults to twice Tolerance so a signature cannot be
+	// reused while its timestamp is acceptable. A negative value disables
+	// replay protection.
+	ReplayWindow time.Duration
+	// MaxBodySize limits the body read to verify the signature.
+	MaxBodySize int64
+
+	// ErrorHandler writes the response for rejected requests. The
+	// default replies 401.
+	ErrorHandler ErrorHandler
+
+	now func() time.Time
+}
+
+// NewHMACConfig returns HMACConfig with some default values
+func NewHMACConfig(secret func(keyID string) ([]byte, bool)) HMACConfig {
+	return HMACConfig{
+		Secret:          secret,
+		Hash:            sha256.New,
+		Algorithm:       "sha256",
+		SignatureHeader: "X-Signature",
+		TimestampHeader: "X-Timestamp",
+		KeyIDHeader:     "X-Key-Id",
+		Canonical:       CanonicalRequest,
+		Tolerance:       5 * time.Minute,
+		MaxBodySize:     1 << 20,
+		ErrorHandler:    unauthorized(""),
+	}
+}
+
+// CanonicalRequest is the default canonical request: the timestamp,
+// method, request URI and body joined by newlines.
+func CanonicalRequest(r *http.Request, timestamp string, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(timestamp)
+	buf.WriteByte('\n')
+	buf.WriteString(r.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(r.URL.RequestURI())
+	buf.WriteByte('\n')
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func (c *HMACConfig) setDefaults() {
+	defaults := NewHMACConfig(c.Secret)
+	if c.Hash == nil {
+		c.Hash = defaults.Hash
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = defaults.Algorithm
+	}
+	if c.SignatureHeader == "" {
+		c.SignatureHeader = defaults.SignatureHeader
+	}
+	if c.TimestampHeader == "" {
+		c.TimestampHeader = defaults.TimestampHeader
+	}
+	if c.Canonical == nil {
+		c.Canonical = defaults.Canonical
+	}
+	if c.Tolerance <= 0 {
+		c.Tolerance = defaults.Tolerance
+	}
+	if c.ReplayWindow == 0 {
+		c.ReplayWindow = 2 * c.Tolerance
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaults.MaxBodySize
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = defaults.ErrorHandler
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+// HMAC returns a middleware that verifies HMAC request signatures, as
+// used by webhooks. The body is read to compute the signature and
+// restored for the handler.
+func HMAC(config HMACConfig) func(next http.HandlerFunc) http.HandlerFunc {
+	if config.Secret == nil {
+		panic("auth: HMACConfig.Secret is required")
+	}
+	config.setDefaults()
+	seen := &replayCache{entries: map[string]time.Time{}}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			principal, err := config.verify(r, seen)
+			if err != nil {
+				config.ErrorHandler(rw, r, err)
+				return
+			}
+			next(rw, r.WithContext(NewContext(r.Context(), principal)))
+		}
+	}
+}
+
+func (c *HMACConfig) verify(r *http.Request, seen *replayCache) (*Principal, error) {
+	signature := r.Header.Get(c.SignatureHeader)
+	timestamp := r.Header.Get(c.TimestampHeader)
+	if signature == "" || timestamp == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrTimestampSkew
+	}
+	now := c.now()
+	if skew := now.Sub(time.Unix(unix, 0)); skew > c.Tolerance || skew < -c.Tolerance {
+		return nil, ErrTimestampSkew
+	}
+
+	keyID := ""
+	if c.KeyIDHeader != "" {
+		keyID = r.Header.Get(c.KeyIDHeader)
+	}
+	secret, ok := c.Secret(keyID)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if algorithm, hexSig, found := strings.Cut(signature, "="); found {
+		if !strings.EqualFold(algorithm, c.Algorithm) {
+			return nil, ErrInvalidSignature
+		}
+		signature = hexSig
+	}
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, c.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > c.MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(c.Hash, secret)
+	mac.Write(c.Canonical(r, timestamp, body))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	if c.ReplayWindow > 0 && !seen.add(keyID+":"+hex.EncodeToString(given), now, now.Add(c.ReplayWindow)) {
+		return nil, ErrReplayed
+	}
+
+	return &Principal{Subject: keyID, Method: "hmac"}, nil
+}
+
+// SignRequest signs r for the HMAC middleware configured with config,
+// setting the timestamp, key ID and signature headers. The body is read
+// and restored. It is meant for clients and tests.
+func SignRequest(r *http.Request, config HMACConfig, keyID string, secret []byte) error {
+	config.setDefaults()
+
+	body := []byte{}
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := strconv.FormatInt(config.now().Unix(), 10)
+	mac := hmac.New(config.Hash, secret)
+	mac.Write(config.Canonical(r, timestamp, body))
+
+	r.Header.Set(config.TimestampHeader, timestamp)
+	if config.KeyIDHeader != "" && keyID != "" {
+		r.Header.Set(config.KeyIDHeader, keyID)
+	}
+	r.Header.Set(config.SignatureHeader, config.Algorithm+"="+hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// replayCache remembers signatures until their expiry.
+type replayCache struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+// add records key and reports whether it was not already present.
+func (c *replayCache) add(key string, now, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, e := range c.entries {
+			if !now.Before(e) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if e, ok := c.entries[key]; ok && now.Before(e) {
+		return false
+	}
+	c.entries[key] = expiry
+	return true
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestHMAC(t *testing.T) {
+	secrets := map[string][]byte{"github": []byte("s3cret")}
+	now := time.Unix(1700000000, 0)
+	config := NewHMACConfig(func(keyID string) ([]byte, bool) {
+		secret, ok := secrets[keyID]
+		return secret, ok
+	})
+	config.now = func() time.Time { return now }
+
+	var reason error
+	config.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
+		reason = err
+		rw.WriteHeader(http.StatusUnauthorized)
+	}
+	mw := HMAC(config)
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hooks?x=1", strings.NewReader(body))
+		must.Nil(t, SignRequest(req, config, "github", secrets["github"]))
+		return req
+	}
+	serve := func(req *http.Request) (int, string) {
+		reason = nil
+		var body string
+		rec := httptest.NewRecorder()
+		mw(func(rw http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			must.Equal(t, "github", FromContext(r.Context()).Subject)
+			must.Equal(t, "hmac", FromContext(r.Context()).Method)
+		})(rec, req)
+		return rec.Code, body
+	}
+
+	t.Run("valid and body restored", func(t *testing.T) {
+		must := must.New(t)
+		code, body := serve(newRequest(`{"event":"push"}`))
+		must.Equal(http.StatusOK, code)
+		must.Equal(`{"event":"push"}`, body)
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		must := must.New(t)
+		req := newRequest(`{"event":"replay"}`)
+		signature := req.Header.Get("X-Signature")
+		code, _ := serve(req)
+		must.Equal(http.StatusOK, code)
+
+		replay := httptest.NewRequest(http.MethodPost, "/hooks?x=1", strings.NewReader(`{"event":"replay"}`))
+		replay.Header = req.Header.Clone()
+		replay.Header.Set("X-Signature", strings.ToUpper(signature[7:]))
+		code, _ = serve(replay)
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrReplayed))
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		must := must.New(t)
+		req := newRequest(`{"amount":1}`)
+		req.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+		code, _ := serve(req)
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrInvalidSignature))
+	})
+
+	t.Run("timestamp skew", func(t *testing.T) {
+		must := must.New(t)
+		req := newRequest(`{}`)
+		now = now.Add(10 * time.Minute)
+		defer func() { now = now.Add(-10 * time.Minute) }()
+		code, _ := serve(req)
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrTimestampSkew))
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		must := must.New(t)
+		req := newRequest(`{}`)
+		req.Header.Set("X-Key-Id", "gitlab")
+		code, _ := serve(req)
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrInvalidCredentials))
+	})
+
+	t.Run("wrong algorithm", func(t *testing.T) {
+		must := must.New(t)
+		req := newRequest(`{}`)
+		req.Header.Set("X-Signature", "sha1="+req.Header.Get("X-Signature")[7:])
+		code, _ := serve(req)
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrInvalidSignature))
+	})
+
+	t.Run("missing headers", func(t *testing.T) {
+		must := must.New(t)
+		code, _ := serve(httptest.NewRequest(http.MethodPost, "/hooks", nil))
+		must.Equal(http.StatusUnauthorized, code)
+		must.True(errors.Is(reason, ErrMissingCredentials))
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		must := must.New(t)
+		small := config
+		small.MaxBodySize = 4
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader("12345"))
+		must.Nil(SignRequest(req, small, "github", secrets["github"]))
+		rec := httptest.NewRecorder()
+		HMAC(small)(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+		must.True(errors.Is(reason, ErrBodyTooLarge))
+	})
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TokenValidator checks a bearer token or API key and returns the
+// principal it identifies.
+type TokenValidator func(r *http.Request, token string) (*Principal, error)
+
+// TokenConfig configures the Bearer and APIKey middlewares.
+type TokenConfig struct {
+	// Validator checks the token. It is required.
+	Validator TokenValidator
+	// Header is the request header carrying the token.
+	Header string
+	// Scheme is the authentication scheme expected before the token in
+	// Header, e.g. "Bearer". Empty means the header holds the bare token.
+	Scheme string
+	// Query, when set, names a query parameter used as a fallback when
+	// the header is absent. Tokens in URLs end up in logs, so prefer
+	// headers.
+	Query string
+	// Realm is sent in the WWW-Authenticate challenge of Bearer.
+	Realm string
+	// ErrorHandler writes the response for rejected requests. The default
+	// replies 401, with a Bearer challenge for the Bearer middleware.
+	ErrorHandler ErrorHandler
+}
+
+// Bearer returns a middleware that authenticates requests with a bearer
+// token (RFC 6750) from the Authorization header.
+func Bearer(config TokenConfig) func(next http.HandlerFunc) http.HandlerFunc {
+	if config.Header == "" {
+		config.Header = "Authorization"
+		config.Scheme = "Bearer"
+	}
+	if config.ErrorHandler == nil {
+		challenge := "Bearer"
+		if config.Realm != "" {
+			challenge += " realm=" + strconv.Quote(config.Realm)
+		}
+		config.ErrorHandler = unauthorized(challenge)
+	}
+	return tokenMiddleware(config, "bearer")
+}
+
+// APIKey returns a middleware that authenticates requests with an API
+// key, read from the X-API-Key header unless configured otherwise.
+func APIKey(config TokenConfig) func(next http.HandlerFunc) http.HandlerFunc {
+	if config.Header == "" {
+		config.Header = "X-API-Key"
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = unauthorized("")
+	}
+	return tokenMiddleware(config, "apikey")
+}
+
+func tokenMiddleware(config TokenConfig, method string) func(next http.HandlerFunc) http.HandlerFunc {
+	if config.Validator == nil {
+		panic("auth: TokenConfig.Validator is required")
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			token := config.extract(r)
+			if token == "" {
+				config.ErrorHandler(rw, r, ErrMissingCredentials)
+				return
+			}
+
+			principal, err := config.Validator(r, token)
+			if err == nil && principal == nil {
+				err = ErrInvalidCredentials
+			}
+			if err != nil {
+				config.ErrorHandler(rw, r, err)
+				return
+			}
+			if principal.Method == "" {
+				principal.Method = method
+			}
+			next(rw, r.WithContext(NewContext(r.Context(), principal)))
+		}
+	}
+}
+
+func (c TokenConfig) extract(r *http.Request) string {
+	value := r.Header.Get(c.Header)
+	if value == "" {
+		if c.Query != "" {
+			return r.URL.Query().Get(c.Query)
+		}
+		return ""
+	}
+
+	if c.Scheme == "" {
+		return strings.TrimSpace(value)
+	}
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, c.Scheme) {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
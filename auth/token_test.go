@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+var errRevoked = errors.New("revoked")
+
+func validator(r *http.Request, token string) (*Principal, error) {
+	switch token {
+	case "good":
+		return &Principal{Subject: "alice", Scopes: []string{"read"}}, nil
+	case "revoked":
+		return nil, errRevoked
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func TestBearer(t *testing.T) {
+	mw := Bearer(TokenConfig{Validator: validator, Realm: "api"})
+	serve := func(authorization string) (*httptest.ResponseRecorder, *Principal) {
+		var principal *Principal
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		mw(func(rw http.ResponseWriter, r *http.Request) {
+			principal = FromContext(r.Context())
+		})(rec, req)
+		return rec, principal
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		must := must.New(t)
+		rec, principal := serve("bearer good")
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal("alice", principal.Subject)
+		must.Equal("bearer", principal.Method)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		must := must.New(t)
+		for _, authorization := range []string{"", "Bearer bad", "Bearer revoked", "Basic good", "good"} {
+			rec, principal := serve(authorization)
+			must.Equal(http.StatusUnauthorized, rec.Code)
+			must.Equal(`Bearer realm="api"`, rec.Header().Get("WWW-Authenticate"))
+			must.Nil(principal)
+		}
+	})
+
+	t.Run("validator is required", func(t *testing.T) {
+		must := must.New(t)
+		defer func() { must.NotNil(recover()) }()
+		Bearer(TokenConfig{})
+	})
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Run("header", func(t *testing.T) {
+		must := must.New(t)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "good")
+		rec := httptest.NewRecorder()
+		APIKey(TokenConfig{Validator: validator})(func(rw http.ResponseWriter, r *http.Request) {
+			must.Equal("apikey", FromContext(r.Context()).Method)
+		})(rec, req)
+		must.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("query fallback", func(t *testing.T) {
+		must := must.New(t)
+		req := httptest.NewRequest(http.MethodGet, "/?api_key=good", nil)
+		rec := httptest.NewRecorder()
+		APIKey(TokenConfig{Validator: validator, Query: "api_key"})(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+		must.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("error handler receives validator error", func(t *testing.T) {
+		must := must.New(t)
+		var reason error
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "revoked")
+		rec := httptest.NewRecorder()
+		APIKey(TokenConfig{
+			Validator:    validator,
+			ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) { reason = err },
+		})(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+		must.Equal(errRevoked, reason)
+		must.Equal("", rec.Header().Get("WWW-Authenticate"))
+	})
+}
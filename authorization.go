@@ -0,0 +1,153 @@
+package ngamux
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ngamux/ngamux/auth"
+)
+
+// Policy decides whether a request may reach a route. Policies are
+// declared on routes and groups with Require and evaluated by Authorize
+// against the principal set by an authentication middleware.
+type Policy interface {
+	// Allow reports whether the request is allowed. principal is nil
+	// when the request was not authenticated.
+	Allow(r *http.Request, principal *auth.Principal) bool
+	// String describes the policy, e.g. for route introspection.
+	String() string
+}
+
+type policyFunc struct {
+	name  string
+	allow func(r *http.Request, principal *auth.Principal) bool
+}
+
+func (p policyFunc) Allow(r *http.Request, principal *auth.Principal) bool {
+	return p.allow(r, principal)
+}
+
+func (p policyFunc) String() string {
+	return p.name
+}
+
+// PolicyFunc returns a Policy named name that calls allow. The request
+// gives access to route parameters, e.g. for owner checks:
+//
+//	ngamux.PolicyFunc("owner", func(r *http.Request, p *auth.Principal) bool {
+//		return p != nil && r.PathValue("id") == p.Subject
+//	})
+func PolicyFunc(name string, allow func(r *http.Request, principal *auth.Principal) bool) Policy {
+	return policyFunc{name: name, allow: allow}
+}
+
+// Authenticated returns a Policy allowing any authenticated principal.
+func Authenticated() Policy {
+	return PolicyFunc("authenticated", func(r *http.Request, principal *auth.Principal) bool {
+		return principal != nil
+	})
+}
+
+// Roles returns a Policy allowing principals that have any of roles.
+func Roles(roles ...string) Policy {
+	return PolicyFunc("role("+strings.Join(roles, ", ")+")", func(r *http.Request, principal *auth.Principal) bool {
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Scopes returns a Policy allowing principals granted any of scopes.
+func Scopes(scopes ...string) Policy {
+	return PolicyFunc("scope("+strings.Join(scopes, ", ")+")", func(r *http.Request, principal *auth.Principal) bool {
+		for _, scope := range scopes {
+			if principal.HasScope(scope) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AnyOf returns a Policy allowing requests allowed by any of policies.
+func AnyOf(policies ...Policy) Policy {
+	return PolicyFunc(joinPolicies(policies, " or "), func(r *http.Request, principal *auth.Principal) bool {
+		for _, policy := range policies {
+			if policy.Allow(r, principal) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AllOf returns a Policy allowing requests allowed by every policy.
+func AllOf(policies ...Policy) Policy {
+	return PolicyFunc(joinPolicies(policies, " and "), func(r *http.Request, principal *auth.Principal) bool {
+		for _, policy := range policies {
+			if !policy.Allow(r, principal) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func joinPolicies(policies []Policy, sep string) string {
+	names := make([]string, len(policies))
+	for i, policy := range policies {
+		names[i] = policy.String()
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return "(" + strings.Join(names, sep) + ")"
+}
+
+// Authorize returns a middleware that lets a request through only when
+// every policy allows it. Denied requests get a 403 problem response,
+// or 401 when no authentication middleware set a principal.
+//
+// Routes declared with Require are authorized automatically, after
+// every middleware of the route, so Authorize is only needed to guard
+// handlers outside of an Ngamux router.
+func Authorize(policies ...Policy) MiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			for _, policy := range policies {
+				if policy.Allow(r, principal) {
+					continue
+				}
+
+				status := http.StatusForbidden
+				if principal == nil {
+					status = http.StatusUnauthorized
+				}
+				Res(rw, r).Problem(NewProblem(status, "requires "+policy.String()))
+				return
+			}
+			next(rw, r)
+		}
+	}
+}
+
+// Require returns a group of this router whose routes, including those
+// of its sub-groups, are only served to requests allowed by every
+// policy, on top of the policies of this router. It declares
+// authorization both for groups and single routes:
+//
+//	admin := mux.Group("/admin").Require(ngamux.Roles("admin"))
+//	mux.Require(ngamux.AnyOf(ngamux.Roles("admin"), ngamux.Scopes("users:write"))).
+//		Delete("/users/{id}", deleteUser)
+//
+// Policies see the principal set by authentication middlewares
+// registered with Use, and are reported by Routes.
+func (mux *Ngamux) Require(policies ...Policy) *Ngamux {
+	group := mux.Group("")
+	group.policies = policies
+	return group
+}
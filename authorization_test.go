@@ -0,0 +1,144 @@
+package ngamux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/auth"
+)
+
+// authenticate is a test authentication middleware reading the principal
+// from the X-User ("name|role,role|scope,scope") header.
+func authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if user := r.Header.Get("X-User"); user != "" {
+			parts := strings.Split(user+"||", "|")
+			principal := &auth.Principal{
+				Subject: parts[0],
+				Roles:   strings.Split(parts[1], ","),
+				Scopes:  strings.Split(parts[2], ","),
+			}
+			r = r.WithContext(auth.NewContext(r.Context(), principal))
+		}
+		next(rw, r)
+	}
+}
+
+func owner() Policy {
+	return PolicyFunc("owner", func(r *http.Request, principal *auth.Principal) bool {
+		return principal != nil && r.PathValue("id") == principal.Subject
+	})
+}
+
+func TestRequire(t *testing.T) {
+	mux := New()
+	mux.Use(authenticate)
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		Res(rw).Text("ok")
+	}
+
+	mux.Get("/public", handler)
+	mux.Require(AnyOf(Roles("admin"), Scopes("users:write"))).Delete("/admin/users/{id}", handler)
+	users := mux.Group("/users").Require(Authenticated())
+	users.Get("/{id}", handler)
+	users.Require(AnyOf(Roles("admin"), owner())).Put("/{id}", handler)
+
+	serve := func(method, path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		method, path, user string
+		status             int
+	}{
+		{http.MethodGet, "/public", "", http.StatusOK},
+		{http.MethodDelete, "/admin/users/1", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/admin/users/1", "bob|editor|users:read", http.StatusForbidden},
+		{http.MethodDelete, "/admin/users/1", "bob|admin", http.StatusOK},
+		{http.MethodDelete, "/admin/users/1", "bob||users:write", http.StatusOK},
+		{http.MethodGet, "/users/1", "", http.StatusUnauthorized},
+		{http.MethodGet, "/users/1", "bob", http.StatusOK},
+		{http.MethodPut, "/users/bob", "bob", http.StatusOK},
+		{http.MethodPut, "/users/alice", "bob", http.StatusForbidden},
+		{http.MethodPut, "/users/alice", "carol|admin", http.StatusOK},
+		{http.MethodPut, "/users/alice", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.method+" "+tc.path+" "+tc.user, func(t *testing.T) {
+			must := must.New(t)
+			rec := serve(tc.method, tc.path, tc.user)
+			must.Equal(tc.status, rec.Code)
+			if tc.status != http.StatusOK {
+				must.Equal("application/problem+json", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("problem detail", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(http.MethodDelete, "/admin/users/1", "bob")
+		must.True(strings.Contains(rec.Body.String(), `"detail":"requires (role(admin) or scope(users:write))"`))
+		must.True(strings.Contains(rec.Body.String(), `"status":403`))
+	})
+
+	t.Run("router codec", func(t *testing.T) {
+		must := must.New(t)
+		mux := New(func(c *Config) {
+			c.JSONMarshal = func(v any) ([]byte, error) { return []byte(`{"codec":"router"}`), nil }
+		})
+		mux.Require(Authenticated()).Get("/", handler)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.Equal(http.StatusUnauthorized, rec.Code)
+		must.Equal(`{"codec":"router"}`, rec.Body.String())
+	})
+}
+
+func TestRoutesReportPolicies(t *testing.T) {
+	must := must.New(t)
+	mux := New()
+	handler := func(rw http.ResponseWriter, r *http.Request) {}
+
+	mux.Get("/", handler)
+	api := mux.Group("/api").Require(Authenticated())
+	api.Require(Roles("admin", "ops")).Delete("/users/{id}", handler)
+	mux.Handle("/static/", http.NotFoundHandler())
+
+	routes := mux.Routes()
+	must.Equal(3, len(routes))
+	must.Equal(http.MethodGet, routes[0].Method)
+	must.Equal("", routes[0].Policy())
+	must.Equal(http.MethodDelete, routes[1].Method)
+	must.Equal("/api/users/{id}", routes[1].Path)
+	must.Equal("authenticated and role(admin, ops)", routes[1].Policy())
+	must.Equal("ALL", routes[2].Method)
+	must.Equal("/static/", routes[2].Path)
+
+	// Groups report the whole tree.
+	must.Equal(3, len(api.Routes()))
+}
+
+func TestAuthorize(t *testing.T) {
+	must := must.New(t)
+	handler := authenticate(Authorize(AllOf(Scopes("read"), Scopes("write")))(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "bob||read")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	must.Equal(http.StatusForbidden, rec.Code)
+	must.True(strings.Contains(rec.Body.String(), "(scope(read) and scope(write))"))
+
+	req.Header.Set("X-User", "bob||read,write")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	must.Equal(http.StatusOK, rec.Code)
+}
@@ -0,0 +1,249 @@
+package ngamux
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Binding sources, as used in struct tags and reported by FieldError.
+const (
+	BindPath   = "path"
+	BindQuery  = "query"
+	BindHeader = "header"
+	BindCookie = "cookie"
+	BindForm   = "form"
+	BindJSON   = "json"
+)
+
+// bindSources lists the tag sources in the order they are applied, so
+// that the more specific ones win when a field has several tags.
+var bindSources = []string{BindForm, BindQuery, BindHeader, BindCookie, BindPath}
+
+// FieldError describes a request value that could not be bound to a
+// struct field.
+type FieldError struct {
+	// Field is the name of the struct field, empty for errors about the
+	// whole body.
+	Field string
+	// Source is where the value comes from, e.g. "query".
+	Source string
+	// Key is the name of the value in its source, e.g. the query key.
+	Key string
+	// Err is the reason the value was rejected.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Key == "" {
+		return e.Source + ": " + e.Err.Error()
+	}
+	return e.Source + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// BindError is returned by Request.Bind with every value that could not
+// be bound.
+type BindError struct {
+	Fields []*FieldError
+}
+
+func (e *BindError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return "bind: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the field errors, so that errors.Is and errors.As can
+// inspect them.
+func (e *BindError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Problem returns a 400 Bad Request problem listing the rejected values
+// under the "errors" member.
+func (e *BindError) Problem() Problem {
+	errs := make([]map[string]string, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = map[string]string{
+			"field":  field.Field,
+			"source": field.Source,
+			"key":    field.Key,
+			"detail": field.Err.Error(),
+		}
+	}
+	problem := NewProblem(http.StatusBadRequest, "the request has invalid values")
+	problem.Extensions = map[string]any{"errors": errs}
+	return problem
+}
+
+// bindField is a struct field filled from a request source.
+type bindField struct {
+	index  []int
+	field  reflect.StructField
+	source string
+	key    string
+}
+
+// bindInfo is the reflected binding metadata of a struct type.
+type bindInfo struct {
+	fields  []bindField
+	hasForm bool
+}
+
+// bindCache maps struct types to their *bindInfo.
+var bindCache sync.Map
+
+func bindInfoOf(typ reflect.Type) *bindInfo {
+	if info, ok := bindCache.Load(typ); ok {
+		return info.(*bindInfo)
+	}
+
+	info := &bindInfo{}
+	collectBindFields(typ, nil, info)
+	slices.SortStableFunc(info.fields, func(a, b bindField) int {
+		return slices.Index(bindSources, a.source) - slices.Index(bindSources, b.source)
+	})
+	info.hasForm = slices.ContainsFunc(info.fields, func(f bindField) bool { return f.source == BindForm })
+
+	actual, _ := bindCache.LoadOrStore(typ, info)
+	return actual.(*bindInfo)
+}
+
+func collectBindFields(typ reflect.Type, index []int, info *bindInfo) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldIndex := append(slices.Clone(index), i)
+
+		tagged := false
+		for _, source := range bindSources {
+			key, _, _ := strings.Cut(field.Tag.Get(source), ",")
+			if key == "" || key == "-" {
+				continue
+			}
+			tagged = true
+			if field.IsExported() {
+				info.fields = append(info.fields, bindField{fieldIndex, field, source, key})
+			}
+		}
+
+		if !tagged && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectBindFields(field.Type, fieldIndex, info)
+		}
+	}
+}
+
+// Bind fills the struct pointed to by dst from the request. JSON bodies
+// are decoded first, following the json tags. Fields are then set from
+// the values named by their form, query, header, cookie and path tags,
+// in that order, so that a path parameter wins over a query value for a
+// field with both tags. Absent values leave fields untouched, unless
+// they have a default tag. Values are converted as by QueriesParser, and
+// query and form tags may name nested structs.
+//
+// Bodies over the router's MaxDecodeBytes are rejected, the
+// *http.MaxBytesError being reported in the *BindError.
+//
+// Values that cannot be converted to their field type do not stop
+// binding; they are all reported in a *BindError. Once bound, dst is
+// checked by the router's Validator, if any, which reports broken rules
+// in validate.Errors.
+func (r Request) Bind(dst any) error {
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Pointer || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: destination must be a non-nil pointer to a struct")
+	}
+	val = val.Elem()
+	info := bindInfoOf(val.Type())
+
+	var errs []*FieldError
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	maxBytes := max(configFromRequest(r.Request).MaxDecodeBytes, 0)
+	maxMemory := int64(10 << 20)
+	if maxBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBytes)
+		maxMemory = min(maxMemory, maxBytes)
+	}
+
+	if isJSONMediaType(mediaType) && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		if err == nil && len(body) > 0 {
+			err = r.JSONCodec().Unmarshal(body, dst)
+		}
+		if err != nil {
+			errs = append(errs, &FieldError{Source: BindJSON, Err: err})
+		}
+	}
+
+	if info.hasForm {
+		var err error
+		if mediaType == "multipart/form-data" {
+			err = r.ParseMultipartForm(maxMemory)
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil {
+			errs = append(errs, &FieldError{Source: BindForm, Err: err})
+		}
+	}
+
+	query := r.URL.Query()
+	for _, field := range info.fields {
+		v := val.FieldByIndex(field.index)
+		switch field.source {
+		case BindQuery:
+			errs = append(errs, decodeField(v, field.field, query, field.source, field.key)...)
+		case BindForm:
+			errs = append(errs, decodeField(v, field.field, r.PostForm, field.source, field.key)...)
+		default:
+			values := r.bindValues(field.source, field.key)
+			errs = append(errs, assignField(v, field.field, values, field.source, field.key)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &BindError{Fields: errs}
+	}
+	if validator := configFromRequest(r.Request).Validator; validator != nil {
+		return validator.Struct(dst)
+	}
+	return nil
+}
+
+// bindValues returns the values named key in the path, header or
+// cookie source.
+func (r Request) bindValues(source, key string) []string {
+	switch source {
+	case BindPath:
+		if value := r.PathValue(key); value != "" {
+			return []string{value}
+		}
+	case BindHeader:
+		return r.Header.Values(key)
+	case BindCookie:
+		if cookie, err := r.Cookie(key); err == nil {
+			return []string{cookie.Value}
+		}
+	}
+	return nil
+}
+
+// isJSONMediaType reports whether mediaType is application/json or a
+// +json structured syntax suffix type.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,174 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/validate"
+)
+
+type bindPaging struct {
+	Page  int `query:"page"`
+	Limit int `query:"limit"`
+}
+
+type bindUser struct {
+	bindPaging
+	ID      int    `path:"id" query:"id"`
+	Name    string `json:"name"`
+	Admin   bool   `json:"admin"`
+	Token   string `header:"X-Token"`
+	Session string `cookie:"session"`
+	Note    string `form:"note"`
+	Ignored string `query:"-"`
+	hidden  string `query:"hidden"`
+}
+
+func TestBind(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodPatch, "/users/7?id=1&page=2&limit=10&hidden=x&Ignored=y", strings.NewReader(`{"name":"alice","admin":true}`))
+	req.SetPathValue("id", "7")
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Token", "secret")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	var user bindUser
+	must.Nil(Req(req).Bind(&user))
+	must.Equal(7, user.ID)
+	must.Equal("alice", user.Name)
+	must.True(user.Admin)
+	must.Equal("secret", user.Token)
+	must.Equal("abc", user.Session)
+	must.Equal(2, user.Page)
+	must.Equal(10, user.Limit)
+	must.Equal("", user.Ignored)
+	must.Equal("", user.hidden)
+}
+
+func TestBindForm(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodPost, "/?id=3", strings.NewReader("note=hello"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var user bindUser
+	must.Nil(Req(req).Bind(&user))
+	must.Equal("hello", user.Note)
+	must.Equal(3, user.ID)
+}
+
+func TestBindErrors(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodPost, "/?page=one&limit=two", strings.NewReader(`{"name":`))
+	req.Header.Set("Content-Type", "application/json")
+
+	var user bindUser
+	err := Req(req).Bind(&user)
+	bindErr := &BindError{}
+	must.True(errors.As(err, &bindErr))
+	must.Equal(3, len(bindErr.Fields))
+	must.Equal(BindJSON, bindErr.Fields[0].Source)
+	must.Equal("Page", bindErr.Fields[1].Field)
+	must.Equal("limit", bindErr.Fields[2].Key)
+
+	var numErr *strconv.NumError
+	must.True(errors.As(err, &numErr))
+
+	problem := bindErr.Problem()
+	must.Equal(http.StatusBadRequest, problem.Status)
+	must.Equal(3, len(problem.Extensions["errors"].([]map[string]string)))
+
+	must.NotNil(Req(req).Bind(user))
+	must.NotNil(Req(req).Bind((*bindUser)(nil)))
+}
+
+func TestBindLimit(t *testing.T) {
+	must := must.New(t)
+	config := NewConfig()
+	config.MaxDecodeBytes = 16
+
+	multipartBody := &bytes.Buffer{}
+	mw := multipart.NewWriter(multipartBody)
+	must.Nil(mw.WriteField("note", strings.Repeat("x", 32)))
+	must.Nil(mw.Close())
+
+	for _, tc := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"name":"long enough"}`},
+		{"application/x-www-form-urlencoded", "note=" + strings.Repeat("x", 32)},
+		{mw.FormDataContentType(), multipartBody.String()},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		req = withConfig(req, &config)
+
+		var user bindUser
+		var maxBytesErr *http.MaxBytesError
+		must.True(errors.As(Req(req).Bind(&user), &maxBytesErr))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	var user bindUser
+	must.Nil(Req(withConfig(req, &config)).Bind(&user))
+	must.Equal("a", user.Name)
+}
+
+func TestBindInfoCache(t *testing.T) {
+	must := must.New(t)
+	typ := reflect.TypeOf(bindUser{})
+	info := bindInfoOf(typ)
+	must.True(info == bindInfoOf(typ))
+	must.True(info.hasForm)
+
+	// Path wins over query for fields tagged with both.
+	sources := []string{}
+	for _, field := range info.fields {
+		if field.field.Name == "ID" {
+			sources = append(sources, field.source)
+		}
+	}
+	must.Equal([]string{BindQuery, BindPath}, sources)
+}
+
+func TestBindValidation(t *testing.T) {
+	must := must.New(t)
+	type signup struct {
+		Name string `json:"name" validate:"required,min=3"`
+		Page int    `query:"page" validate:"min=1"`
+	}
+	config := NewConfig()
+	WithValidator()(&config)
+	request := func(target, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return withConfig(req, &config)
+	}
+
+	var in signup
+	must.Nil(Req(request("/?page=1", `{"name":"alice"}`)).Bind(&in))
+
+	err := Req(request("/?page=0", `{"name":"al"}`)).Bind(&in)
+	var errs validate.Errors
+	must.True(errors.As(err, &errs))
+	must.Equal(2, len(errs))
+	must.Equal(http.StatusUnprocessableEntity, ErrorProblem(err).Status)
+
+	in = signup{}
+	err = Req(request("/", `{"name":""}`)).JSON(&in)
+	must.True(errors.As(err, &errs))
+
+	// Without a validator, only Validate checks the rules.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	must.Nil(Req(req).JSON(&in))
+	must.NotNil(Req(req).Validate(in))
+}
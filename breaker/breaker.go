@@ -0,0 +1,406 @@
+// Package breaker provides a circuit breaker middleware for routes that
+// depend on a downstream service, so that they fail fast while the
+// service is down instead of piling up slow, failing requests.
+//
+// The breaker starts closed and counts request outcomes over a rolling
+// window. When enough requests failed, it opens: requests are answered
+// by the fallback handler without reaching the route. After OpenTimeout
+// it lets a few probe requests through (half-open); it closes again if
+// they succeed and reopens otherwise.
+//
+// A request fails when its response status or the error reported by the
+// handler with Fail is classified as a failure, or when the handler
+// panics. Share one middleware value between all the routes that call
+// the same service.
+package breaker
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets requests through and counts failures.
+	StateClosed State = iota
+	// StateOpen rejects requests with the fallback.
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Config configures a circuit breaker.
+type Config struct {
+	// Name identifies the breaker in logs and state change hooks,
+	// typically the name of the downstream service.
+	Name string
+
+	// Window is the rolling period over which outcomes are counted,
+	// split into Buckets buckets.
+	Window  time.Duration
+	Buckets int
+	// MinRequests is the minimum number of requests in the window before
+	// the breaker may open.
+	MinRequests int
+	// FailureRatio is the proportion of failed requests in the window,
+	// between 0 and 1, at which the breaker opens.
+	FailureRatio float64
+
+	// OpenTimeout is how long the breaker stays open before probing.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests let through while
+	// half-open. The breaker closes once they all succeeded.
+	HalfOpenRequests int
+
+	// IsFailure classifies the outcome of a request from its response
+	// status and the error reported with Fail, if any. The default counts
+	// 5xx statuses and reported errors as failures.
+	IsFailure func(status int, err error) bool
+	// Fallback answers requests rejected by an open breaker. The default
+	// replies 503 with a problem response and a Retry-After header.
+	Fallback http.HandlerFunc
+
+	// OnStateChange is called after every state change, e.g. to update
+	// metrics. It must not block.
+	OnStateChange func(name string, from, to State)
+	// Logger receives a record for every state change. It defaults to
+	// slog.Default().
+	Logger *slog.Logger
+
+	now func() time.Time
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		Window:           10 * time.Second,
+		Buckets:          10,
+		MinRequests:      20,
+		FailureRatio:     0.5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+		IsFailure:        isFailure,
+	}
+}
+
+func isFailure(status int, err error) bool {
+	return err != nil || status >= 500
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = defaults.Buckets
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaults.MinRequests
+	}
+	if c.FailureRatio <= 0 || c.FailureRatio > 1 {
+		c.FailureRatio = defaults.FailureRatio
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaults.OpenTimeout
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = defaults.HalfOpenRequests
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = defaults.IsFailure
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+// Breaker is a circuit breaker.
+type Breaker struct {
+	config Config
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	window     window
+	openedAt   time.Time
+	probes     int
+	successes  int
+}
+
+// NewBreaker returns a closed Breaker.
+func NewBreaker(config Config) *Breaker {
+	config.setDefaults()
+	return &Breaker{
+		config: config,
+		window: newWindow(config.Window, config.Buckets),
+	}
+}
+
+// New returns a circuit breaker middleware. It is a shortcut for
+// NewBreaker(config).Middleware().
+func New(config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	return NewBreaker(cfg).Middleware()
+}
+
+// transition is a state change to report once the lock is released.
+type transition struct {
+	from, to State
+}
+
+// setState switches to state. b.mu must be held.
+func (b *Breaker) setState(state State, now time.Time, changes *[]transition) {
+	if b.state == state {
+		return
+	}
+	*changes = append(*changes, transition{b.state, state})
+	b.state = state
+	b.generation++
+	b.probes = 0
+	b.successes = 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.window.reset()
+	}
+}
+
+// refresh moves an open breaker whose timeout elapsed to half-open.
+// b.mu must be held.
+func (b *Breaker) refresh(now time.Time, changes *[]transition) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(StateHalfOpen, now, changes)
+	}
+}
+
+func (b *Breaker) notify(changes []transition) {
+	for _, change := range changes {
+		level := slog.LevelInfo
+		if change.to == StateOpen {
+			level = slog.LevelWarn
+		}
+		b.config.Logger.Log(context.Background(), level, "circuit breaker state changed",
+			"name", b.config.Name,
+			"from", change.from.String(),
+			"to", change.to.String(),
+		)
+		if b.config.OnStateChange != nil {
+			b.config.OnStateChange(b.config.Name, change.from, change.to)
+		}
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	changes := []transition{}
+	b.mu.Lock()
+	b.refresh(b.config.now(), &changes)
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(changes)
+	return state
+}
+
+// allow reports whether a request may go through, and the generation it
+// belongs to.
+func (b *Breaker) allow() (uint64, bool) {
+	changes := []transition{}
+	b.mu.Lock()
+	b.refresh(b.config.now(), &changes)
+
+	allowed := true
+	switch b.state {
+	case StateOpen:
+		allowed = false
+	case StateHalfOpen:
+		allowed = b.probes < b.config.HalfOpenRequests
+		if allowed {
+			b.probes++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+
+	b.notify(changes)
+	return generation, allowed
+}
+
+// done records the outcome of a request allowed in generation. Outcomes
+// of requests started before the last state change are ignored.
+func (b *Breaker) done(generation uint64, failed bool) {
+	changes := []transition{}
+	b.mu.Lock()
+	now := b.config.now()
+	if generation == b.generation {
+		switch b.state {
+		case StateClosed:
+			b.window.add(now, failed)
+			requests, failures := b.window.counts(now)
+			if requests >= b.config.MinRequests && float64(failures) >= b.config.FailureRatio*float64(requests) {
+				b.setState(StateOpen, now, &changes)
+			}
+		case StateHalfOpen:
+			if failed {
+				b.setState(StateOpen, now, &changes)
+			} else if b.successes++; b.successes >= b.config.HalfOpenRequests {
+				b.setState(StateClosed, now, &changes)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(changes)
+}
+
+// retryAfter returns the time left before the breaker probes again.
+func (b *Breaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(0, b.config.OpenTimeout-b.config.now().Sub(b.openedAt))
+}
+
+// Middleware returns a middleware guarding the routes it wraps with the
+// breaker.
+func (b *Breaker) Middleware() ngamux.MiddlewareFunc {
+	fallback := b.config.Fallback
+	if fallback == nil {
+		fallback = b.unavailable
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			generation, ok := b.allow()
+			if !ok {
+				fallback(rw, r)
+				return
+			}
+
+			o := &outcome{parent: outcomeFromContext(r.Context())}
+			sw := &statusWriter{ResponseWriter: rw}
+			completed := false
+			defer func() {
+				if !completed {
+					// The handler panicked: count it and let it propagate.
+					b.done(generation, true)
+					return
+				}
+				status := sw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				o.mu.Lock()
+				err := o.err
+				o.mu.Unlock()
+				b.done(generation, b.config.IsFailure(status, err))
+			}()
+
+			next(sw, r.WithContext(context.WithValue(r.Context(), outcomeKey{}, o)))
+			completed = true
+		}
+	}
+}
+
+// unavailable is the default fallback.
+func (b *Breaker) unavailable(rw http.ResponseWriter, r *http.Request) {
+	if wait := b.retryAfter(); wait > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	detail := "circuit breaker is open"
+	if b.config.Name != "" {
+		detail = b.config.Name + " " + detail
+	}
+	ngamux.Res(rw, r).Problem(ngamux.NewProblem(http.StatusServiceUnavailable, detail))
+}
+
+// outcome carries the error reported by the handler.
+type outcome struct {
+	mu     sync.Mutex
+	err    error
+	parent *outcome
+}
+
+type outcomeKey struct{}
+
+func outcomeFromContext(ctx context.Context) *outcome {
+	o, _ := ctx.Value(outcomeKey{}).(*outcome)
+	return o
+}
+
+// Fail reports that the request r failed with err, e.g. because a call
+// to the downstream service returned an error, for the breakers guarding
+// the route. It is classified with Config.IsFailure when the handler
+// returns. It does nothing outside of a breaker.
+func Fail(r *http.Request, err error) {
+	for o := outcomeFromContext(r.Context()); o != nil; o = o.parent {
+		o.mu.Lock()
+		o.err = err
+		o.mu.Unlock()
+	}
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController and template helpers can reach it.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,193 @@
+package breaker
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func testBreaker(config Config) (*Breaker, *clock, *bytes.Buffer) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	logs := &bytes.Buffer{}
+	config.now = c.Now
+	config.Logger = slog.New(slog.NewTextHandler(logs, nil))
+	if config.MinRequests == 0 {
+		config.MinRequests = 4
+	}
+	return NewBreaker(config), c, logs
+}
+
+func serve(handler http.HandlerFunc) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec
+}
+
+func status(code int) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(code)
+	}
+}
+
+func TestBreakerStates(t *testing.T) {
+	must := must.New(t)
+	transitions := []string{}
+	b, c, logs := testBreaker(Config{
+		Name:        "billing",
+		OpenTimeout: time.Minute,
+		OnStateChange: func(name string, from, to State) {
+			transitions = append(transitions, name+": "+from.String()+" -> "+to.String())
+		},
+	})
+	mw := b.Middleware()
+	ok := mw(status(http.StatusOK))
+	failing := mw(status(http.StatusBadGateway))
+
+	// Below MinRequests, failures do not open the breaker.
+	serve(ok)
+	serve(ok)
+	serve(failing)
+	must.Equal(StateClosed, b.State())
+	serve(failing)
+	must.Equal(StateOpen, b.State())
+
+	// Open: fail fast with the fallback.
+	called := false
+	rec := serve(mw(func(rw http.ResponseWriter, r *http.Request) { called = true }))
+	must.False(called)
+	must.Equal(http.StatusServiceUnavailable, rec.Code)
+	must.Equal("60", rec.Header().Get("Retry-After"))
+	must.True(strings.Contains(rec.Body.String(), "billing circuit breaker is open"))
+
+	// Half-open after the timeout: a failed probe reopens.
+	c.now = c.now.Add(time.Minute)
+	must.Equal(StateHalfOpen, b.State())
+	serve(failing)
+	must.Equal(StateOpen, b.State())
+
+	// A successful probe closes.
+	c.now = c.now.Add(time.Minute)
+	must.Equal(http.StatusOK, serve(ok).Code)
+	must.Equal(StateClosed, b.State())
+
+	must.Equal([]string{
+		"billing: closed -> open",
+		"billing: open -> half-open",
+		"billing: half-open -> open",
+		"billing: open -> half-open",
+		"billing: half-open -> closed",
+	}, transitions)
+	must.True(strings.Contains(logs.String(), "level=WARN msg=\"circuit breaker state changed\" name=billing from=closed to=open"))
+	must.True(strings.Contains(logs.String(), "level=INFO msg=\"circuit breaker state changed\" name=billing from=half-open to=closed"))
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	must := must.New(t)
+	b, c, _ := testBreaker(Config{OpenTimeout: time.Second, HalfOpenRequests: 1})
+	mw := b.Middleware()
+	for range 4 {
+		serve(mw(status(http.StatusInternalServerError)))
+	}
+	must.Equal(StateOpen, b.State())
+	c.now = c.now.Add(time.Second)
+
+	// While the probe is in flight, other requests get the fallback.
+	var inner *httptest.ResponseRecorder
+	rec := serve(mw(func(rw http.ResponseWriter, r *http.Request) {
+		inner = serve(mw(status(http.StatusOK)))
+	}))
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal(http.StatusServiceUnavailable, inner.Code)
+	must.Equal("", inner.Header().Get("Retry-After"))
+	must.Equal(StateClosed, b.State())
+}
+
+func TestBreakerStaleOutcomes(t *testing.T) {
+	must := must.New(t)
+	b, _, _ := testBreaker(Config{})
+	generation, ok := b.allow()
+	must.True(ok)
+
+	for range 4 {
+		g, _ := b.allow()
+		b.done(g, true)
+	}
+	must.Equal(StateOpen, b.State())
+
+	// A request started while closed finishing now does not count.
+	b.done(generation, false)
+	must.Equal(StateOpen, b.State())
+}
+
+func TestFail(t *testing.T) {
+	must := must.New(t)
+	errDown := errors.New("billing down")
+	var classified []error
+	b, _, _ := testBreaker(Config{
+		IsFailure: func(status int, err error) bool {
+			classified = append(classified, err)
+			return err != nil
+		},
+	})
+	outer, _, _ := testBreaker(Config{})
+
+	handler := outer.Middleware()(b.Middleware()(func(rw http.ResponseWriter, r *http.Request) {
+		Fail(r, errDown)
+	}))
+	for range 4 {
+		must.Equal(http.StatusOK, serve(handler).Code)
+	}
+	must.Equal([]error{errDown, errDown, errDown, errDown}, classified)
+	must.Equal(StateOpen, b.State())
+	// The outer breaker saw the error too.
+	must.Equal(StateOpen, outer.State())
+
+	// Outside of a breaker, Fail does nothing.
+	Fail(httptest.NewRequest(http.MethodGet, "/", nil), errDown)
+}
+
+func TestBreakerPanic(t *testing.T) {
+	must := must.New(t)
+	b, _, _ := testBreaker(Config{})
+	handler := b.Middleware()(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	for range 4 {
+		func() {
+			defer func() { must.Equal("boom", recover()) }()
+			serve(handler)
+		}()
+	}
+	must.Equal(StateOpen, b.State())
+}
+
+func TestFallback(t *testing.T) {
+	must := must.New(t)
+	mw := New(Config{
+		MinRequests: 1,
+		Fallback: func(rw http.ResponseWriter, r *http.Request) {
+			rw.Write([]byte("cached"))
+		},
+	})
+	serve(mw(status(http.StatusInternalServerError)))
+
+	rec := serve(mw(status(http.StatusOK)))
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal("cached", rec.Body.String())
+}
@@ -0,0 +1,61 @@
+package breaker
+
+import "time"
+
+// window counts outcomes over a rolling period split into buckets, so
+// old outcomes expire bucket by bucket rather than all at once.
+type window struct {
+	buckets []bucket
+	width   time.Duration
+}
+
+type bucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+func newWindow(period time.Duration, buckets int) window {
+	return window{
+		buckets: make([]bucket, buckets),
+		width:   max(period/time.Duration(buckets), time.Nanosecond),
+	}
+}
+
+// bucket returns the bucket of now, clearing it when it last counted an
+// older period.
+func (w *window) bucket(now time.Time) *bucket {
+	epoch := now.UnixNano() / int64(w.width)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	return b
+}
+
+func (w *window) add(now time.Time, failed bool) {
+	b := w.bucket(now)
+	if failed {
+		b.failures++
+	} else {
+		b.successes++
+	}
+}
+
+// counts returns the number of requests and failures in the period
+// ending at now.
+func (w *window) counts(now time.Time) (requests, failures int) {
+	epoch := now.UnixNano() / int64(w.width)
+	oldest := epoch - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.epoch >= oldest && b.epoch <= epoch {
+			requests += b.successes + b.failures
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+func (w *window) reset() {
+	clear(w.buckets)
+}
@@ -0,0 +1,37 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestWindow(t *testing.T) {
+	must := must.New(t)
+	w := newWindow(10*time.Second, 10)
+	start := time.Unix(1700000000, 0)
+
+	w.add(start, false)
+	w.add(start, true)
+	w.add(start.Add(5*time.Second), true)
+
+	requests, failures := w.counts(start.Add(5 * time.Second))
+	must.Equal(3, requests)
+	must.Equal(2, failures)
+
+	// The first bucket expires first.
+	requests, failures = w.counts(start.Add(10 * time.Second))
+	must.Equal(1, requests)
+	must.Equal(1, failures)
+
+	// A reused bucket is cleared.
+	w.add(start.Add(20*time.Second), false)
+	requests, failures = w.counts(start.Add(20 * time.Second))
+	must.Equal(1, requests)
+	must.Equal(0, failures)
+
+	w.reset()
+	requests, _ = w.counts(start.Add(20 * time.Second))
+	must.Equal(0, requests)
+}
@@ -0,0 +1,398 @@
+// Package cache provides a middleware caching GET and HEAD responses on
+// the server, following the HTTP caching rules of a shared cache.
+//
+// Responses are keyed by method, path, query and the request headers
+// listed in Config.Vary. They are stored when they allow it: a
+// cacheable status, no Set-Cookie, no private, no-cache or no-store
+// directive, a Vary header limited to Config.Vary and no CSP nonce.
+// Only the headers set by the handler are stored; the ones outer
+// middlewares set beforehand stay per request. Freshness comes
+// from s-maxage, max-age or Expires, falling back to Config.DefaultTTL.
+// Within the stale-while-revalidate window the stale response is served
+// while a fresh one is fetched in the background.
+//
+// Requests may bypass the cache with no-store, force a fresh response
+// with no-cache or max-age=0, and ask for a cached response only with
+// only-if-cached, unless Config.IgnoreRequestDirectives is set.
+//
+// Concurrent misses for the same key are coalesced: one request runs
+// the handler and the others wait for its response.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+// Values of the X-Cache response header.
+const (
+	Hit   = "HIT"
+	Stale = "STALE"
+	Miss  = "MISS"
+)
+
+// Config configures the cache middleware.
+type Config struct {
+	// Vary lists the request headers that are part of the key. Responses
+	// varying on other headers are not stored.
+	Vary []string
+	// DefaultTTL is the freshness of responses without an explicit one.
+	// Zero only stores responses with explicit freshness.
+	DefaultTTL time.Duration
+	// StaleWhileRevalidate applies to responses without a
+	// stale-while-revalidate directive.
+	StaleWhileRevalidate time.Duration
+	// MaxBodySize limits the size of stored responses. Larger responses
+	// are sent but not stored.
+	MaxBodySize int
+	// IgnoreRequestDirectives ignores the Cache-Control and Pragma
+	// headers of requests, so that clients cannot bypass the cache.
+	IgnoreRequestDirectives bool
+
+	now func() time.Time
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		MaxBodySize: 1 << 20,
+		now:         time.Now,
+	}
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig()
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaults.MaxBodySize
+	}
+	if c.now == nil {
+		c.now = defaults.now
+	}
+}
+
+// key returns the cache key of r.
+func (c *Config) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.EscapedPath())
+	if query := r.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	for _, name := range c.Vary {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(url.QueryEscape(strings.Join(r.Header.Values(name), ",")))
+	}
+	return b.String()
+}
+
+// call is a handler run shared by concurrent requests for a key.
+type call struct {
+	done  chan struct{}
+	entry Entry
+	ok    bool
+}
+
+type cache struct {
+	Config
+	store Store
+	next  http.HandlerFunc
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// New returns a middleware caching GET and HEAD responses in store.
+func New(store Store, config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg.setDefaults()
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		c := &cache{Config: cfg, store: store, next: next, calls: map[string]*call{}}
+		return c.serveHTTP
+	}
+}
+
+func (c *cache) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		c.next(rw, r)
+		return
+	}
+
+	d := directives{}
+	if !c.IgnoreRequestDirectives {
+		d = requestDirectives(r)
+	}
+	if d.has("no-store") {
+		c.next(rw, r)
+		return
+	}
+
+	key := c.key(r)
+	if !d.has("no-cache") {
+		if entry, ok, err := c.store.Get(r.Context(), key); err == nil && ok {
+			now := c.now()
+			maxAge, limited := d.seconds("max-age")
+			if !limited || now.Sub(entry.Stored) <= maxAge {
+				if now.Before(entry.Expires) {
+					c.serveEntry(rw, r, entry, Hit)
+					return
+				}
+				if now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)) {
+					c.serveEntry(rw, r, entry, Stale)
+					c.revalidate(key, r)
+					return
+				}
+			}
+		}
+	}
+	if d.has("only-if-cached") {
+		rw.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+
+	c.fetch(rw, r, key)
+}
+
+// join returns the call running for key, and true when the caller
+// started it and must run the handler.
+func (c *cache) join(key string) (*call, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.calls[key]; ok {
+		return cl, false
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	return cl, true
+}
+
+func (c *cache) leave(key string, cl *call) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(cl.done)
+}
+
+// fetch runs the handler for a miss, unless another request for key is
+// already running it, in which case its response is shared when it can
+// be stored.
+func (c *cache) fetch(rw http.ResponseWriter, r *http.Request, key string) {
+	cl, leader := c.join(key)
+	if !leader {
+		select {
+		case <-cl.done:
+		case <-r.Context().Done():
+			return
+		}
+		if cl.ok {
+			c.serveEntry(rw, r, cl.entry, Hit)
+			return
+		}
+		c.next(rw, r)
+		return
+	}
+	defer c.leave(key, cl)
+
+	rw.Header().Set("X-Cache", Miss)
+	// Headers set by outer middlewares, such as a per-request
+	// Content-Security-Policy, belong to this response only.
+	before := rw.Header().Clone()
+	rec := &recorder{ResponseWriter: rw, limit: c.MaxBodySize}
+	c.next(rec, r)
+	if rec.overflow {
+		return
+	}
+	if rec.status == 0 {
+		rec.header = rw.Header().Clone()
+	}
+	cl.entry, cl.ok = c.save(r, key, rec.status, rec.header, before, rec.body.Bytes())
+}
+
+// revalidate refreshes the entry of key in the background, unless a
+// request for it is already running. A panic of the handler drops the
+// entry rather than the process, since no server recovers it here.
+func (c *cache) revalidate(key string, r *http.Request) {
+	cl, leader := c.join(key)
+	if !leader {
+		return
+	}
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	go func() {
+		defer c.leave(key, cl)
+		defer func() {
+			if recover() != nil {
+				cl.ok = false
+				_ = c.store.Delete(r.Context(), key)
+			}
+		}()
+		w := &bufferWriter{header: http.Header{}}
+		c.next(w, r)
+		if w.body.Len() > c.MaxBodySize {
+			return
+		}
+		cl.entry, cl.ok = c.save(r, key, w.status, w.header, nil, w.body.Bytes())
+	}()
+}
+
+// save stores the response to r when it allows it. Only the headers
+// the handler added or changed since before are stored. Responses bound
+// to a CSP nonce are not stored, since every response needs its own.
+func (c *cache) save(r *http.Request, key string, status int, header, before http.Header, body []byte) (Entry, bool) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	now := c.now()
+	ttl, stale, ok := c.freshness(r, status, header, now)
+	if !ok || hasNonce(header) {
+		return Entry{}, false
+	}
+
+	stored := http.Header{}
+	for name, values := range header {
+		if !slices.Equal(values, before[name]) {
+			stored[name] = slices.Clone(values)
+		}
+	}
+	header = stored
+	header.Del("X-Cache")
+	entry := Entry{
+		Status:               status,
+		Header:               header,
+		Body:                 slices.Clone(body),
+		Stored:               now,
+		Expires:              now.Add(ttl),
+		StaleWhileRevalidate: stale,
+	}
+	ctx := context.WithoutCancel(r.Context())
+	if err := c.store.Set(ctx, key, entry, entry.Expires.Add(stale)); err != nil {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// hasNonce reports whether the Content-Security-Policy of header allows
+// sources by nonce.
+func hasNonce(header http.Header) bool {
+	for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		for _, value := range header.Values(name) {
+			if strings.Contains(value, "'nonce-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *cache) serveEntry(rw http.ResponseWriter, r *http.Request, entry Entry, state string) {
+	header := rw.Header()
+	maps.Copy(header, entry.Header)
+	header.Set("Age", strconv.Itoa(int(max(c.now().Sub(entry.Stored), 0)/time.Second)))
+	header.Set("X-Cache", state)
+
+	if entry.Status >= 200 && entry.Status < 300 {
+		lastModified, _ := http.ParseTime(entry.Header.Get("Last-Modified"))
+		if status := ngamux.CheckPreconditions(r, entry.Header.Get("ETag"), lastModified); status != 0 {
+			if status == http.StatusNotModified {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+			}
+			rw.WriteHeader(status)
+			return
+		}
+	}
+
+	rw.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		_, _ = rw.Write(entry.Body)
+	}
+}
+
+// recorder passes the response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *recorder) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController and template helpers can reach it.
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bufferWriter collects the response of a background revalidation.
+type bufferWriter struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+	"github.com/ngamux/ngamux/secure"
+)
+
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func counter(cacheControl string) (http.HandlerFunc, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if cacheControl != "" {
+			rw.Header().Set("Cache-Control", cacheControl)
+		}
+		rw.Header().Set("ETag", `"`+strconv.Itoa(int(n))+`"`)
+		_, _ = rw.Write([]byte("response " + strconv.Itoa(int(n))))
+	}, calls
+}
+
+func newStore(now func() time.Time) *MemoryStore {
+	store := NewMemoryStore(0, 0)
+	store.now = now
+	return store
+}
+
+func TestHit(t *testing.T) {
+	must := must.New(t)
+	now := time.Unix(1700000000, 0)
+	handler, calls := counter("max-age=60")
+	clock := func() time.Time { return now }
+	cached := New(newStore(clock), Config{now: clock})(handler)
+
+	rec := serve(cached, httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil))
+	must.Equal("response 1", rec.Body.String())
+	must.Equal(Miss, rec.Header().Get("X-Cache"))
+
+	now = now.Add(30 * time.Second)
+	rec = serve(cached, httptest.NewRequest(http.MethodGet, "/items?a=1&b=2", nil))
+	must.Equal("response 1", rec.Body.String())
+	must.Equal(Hit, rec.Header().Get("X-Cache"))
+	must.Equal("30", rec.Header().Get("Age"))
+
+	// Another query, method or an expired entry miss.
+	must.Equal("response 2", serve(cached, httptest.NewRequest(http.MethodGet, "/items?a=2", nil)).Body.String())
+	rec = serve(cached, httptest.NewRequest(http.MethodHead, "/items?a=1&b=2", nil))
+	must.Equal(Miss, rec.Header().Get("X-Cache"))
+	now = now.Add(time.Minute)
+	must.Equal("response 4", serve(cached, httptest.NewRequest(http.MethodGet, "/items?a=1&b=2", nil)).Body.String())
+	must.Equal(int32(4), calls.Load())
+
+	// Unsafe methods are passed through.
+	must.Equal("response 5", serve(cached, httptest.NewRequest(http.MethodPost, "/items?a=1&b=2", nil)).Body.String())
+
+	// Conditional requests are answered from the cache.
+	req := httptest.NewRequest(http.MethodGet, "/items?a=1&b=2", nil)
+	req.Header.Set("If-None-Match", `"4"`)
+	rec = serve(cached, req)
+	must.Equal(http.StatusNotModified, rec.Code)
+	must.Equal("", rec.Body.String())
+}
+
+func TestRequestDirectives(t *testing.T) {
+	must := must.New(t)
+	now := time.Unix(1700000000, 0)
+	handler, calls := counter("max-age=60")
+	clock := func() time.Time { return now }
+	cached := New(newStore(clock), Config{now: clock})(handler)
+	get := func(cacheControl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Cache-Control", cacheControl)
+		return serve(cached, req)
+	}
+
+	must.Equal(http.StatusGatewayTimeout, get("only-if-cached").Code)
+	get("")
+	now = now.Add(20 * time.Second)
+
+	// no-store bypasses the cache entirely.
+	must.Equal("response 2", get("no-store").Body.String())
+	must.Equal("response 1", get("").Body.String())
+	// no-cache fetches and stores a fresh response.
+	must.Equal("response 3", get("no-cache").Body.String())
+	must.Equal("response 3", get("").Body.String())
+
+	// max-age bounds the age of the cached response.
+	now = now.Add(20 * time.Second)
+	must.Equal("response 3", get("max-age=30").Body.String())
+	must.Equal("response 4", get("max-age=10").Body.String())
+
+	pragma := httptest.NewRequest(http.MethodGet, "/", nil)
+	pragma.Header.Set("Pragma", "no-cache")
+	must.Equal("response 5", serve(cached, pragma).Body.String())
+	must.Equal(int32(5), calls.Load())
+
+	ignoring := New(NewMemoryStore(0, 0), Config{IgnoreRequestDirectives: true})(handler)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	serve(ignoring, req)
+	req.Header.Set("Cache-Control", "no-cache")
+	must.Equal("response 6", serve(ignoring, req).Body.String())
+}
+
+func TestNotStored(t *testing.T) {
+	must := must.New(t)
+	for _, tc := range []struct {
+		name  string
+		setup func(rw http.ResponseWriter, r *http.Request)
+	}{
+		{"no freshness", func(rw http.ResponseWriter, r *http.Request) {}},
+		{"private", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "private, max-age=60")
+		}},
+		{"no-store", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "no-store")
+		}},
+		{"cookie", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "max-age=60")
+			rw.Header().Set("Set-Cookie", "a=b")
+		}},
+		{"vary", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "max-age=60")
+			rw.Header().Set("Vary", "Accept-Language")
+		}},
+		{"status", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "max-age=60")
+			rw.WriteHeader(http.StatusInternalServerError)
+		}},
+		{"large", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "max-age=60")
+			_, _ = rw.Write([]byte("too large"))
+		}},
+	} {
+		store := NewMemoryStore(0, 0)
+		cached := New(store, Config{MaxBodySize: 4})(tc.setup)
+		serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+		if store.Len() != 0 {
+			t.Errorf("%s: stored", tc.name)
+		}
+	}
+
+	// Authorized requests need an explicit permission.
+	store := NewMemoryStore(0, 0)
+	handler, _ := counter("max-age=60")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	serve(New(store)(handler), req)
+	must.Equal(0, store.Len())
+	handler, _ = counter("public, max-age=60")
+	serve(New(store)(handler), req)
+	must.Equal(1, store.Len())
+}
+
+func TestVary(t *testing.T) {
+	must := must.New(t)
+	cached := New(NewMemoryStore(0, 0), Config{Vary: []string{"Accept-Language"}})(
+		func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Cache-Control", "max-age=60")
+			rw.Header().Set("Vary", "Accept-Language")
+			_, _ = rw.Write([]byte(r.Header.Get("Accept-Language")))
+		})
+	get := func(language string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", language)
+		return serve(cached, req)
+	}
+
+	must.Equal("en", get("en").Body.String())
+	must.Equal("id", get("id").Body.String())
+	rec := get("en")
+	must.Equal("en", rec.Body.String())
+	must.Equal(Hit, rec.Header().Get("X-Cache"))
+}
+
+func TestExpires(t *testing.T) {
+	must := must.New(t)
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	store := newStore(clock)
+	cached := New(store, Config{now: clock})(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		rw.Header().Set("Expires", now.Add(time.Minute).UTC().Format(http.TimeFormat))
+	})
+
+	serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+	entry, ok, _ := store.Get(t.Context(), "GET /")
+	must.True(ok)
+	must.Equal(now.Add(time.Minute), entry.Expires)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	must := must.New(t)
+	var mu sync.Mutex
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	handler, calls := counter("max-age=10, stale-while-revalidate=30")
+	cached := New(newStore(clock), Config{now: clock})(handler)
+	get := func() *httptest.ResponseRecorder {
+		return serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	get()
+	mu.Lock()
+	now = now.Add(20 * time.Second)
+	mu.Unlock()
+
+	rec := get()
+	must.Equal("response 1", rec.Body.String())
+	must.Equal(Stale, rec.Header().Get("X-Cache"))
+
+	// The background refresh replaces the entry.
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for time.Now().Before(deadline) {
+		if rec = get(); rec.Header().Get("X-Cache") == Hit {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	must.Equal("response 2", rec.Body.String())
+
+	// Past the window the response is fetched again.
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	must.Equal(Miss, get().Header().Get("X-Cache"))
+}
+
+func TestRevalidatePanic(t *testing.T) {
+	must := must.New(t)
+	var mu sync.Mutex
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	store := newStore(clock)
+	calls := atomic.Int32{}
+	cached := New(store, Config{now: clock})(func(rw http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			panic("boom")
+		}
+		rw.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=30")
+		_, _ = rw.Write([]byte("response"))
+	})
+	get := func() *httptest.ResponseRecorder {
+		return serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	get()
+	mu.Lock()
+	now = now.Add(20 * time.Second)
+	mu.Unlock()
+	rec := get()
+	must.Equal(Stale, rec.Header().Get("X-Cache"))
+	must.Equal("response", rec.Body.String())
+
+	// The panicking refresh drops the entry instead of the process.
+	deadline := time.Now().Add(time.Second)
+	found := true
+	for found && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		_, found, _ = store.Get(t.Context(), "GET /")
+	}
+	must.False(found)
+	must.Equal(Miss, get().Header().Get("X-Cache"))
+}
+
+func TestCoalesce(t *testing.T) {
+	must := must.New(t)
+	release := make(chan struct{})
+	calls := atomic.Int32{}
+	cached := New(NewMemoryStore(0, 0))(func(rw http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		rw.Header().Set("Cache-Control", "max-age=60")
+		_, _ = rw.Write([]byte("shared"))
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = serve(cached, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+		}()
+	}
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	must.Equal(int32(1), calls.Load())
+	for _, body := range bodies {
+		must.Equal("shared", body)
+	}
+}
+
+func TestOuterHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	requestID := 0
+	outer := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			requestID++
+			rw.Header().Set("X-Request-Id", strconv.Itoa(requestID))
+			next(rw, r)
+		}
+	}
+
+	t.Run("not stored", func(t *testing.T) {
+		must := must.New(t)
+		handler, calls := counter("max-age=60")
+		cached := outer(New(newStore(clock), Config{now: clock})(handler))
+
+		serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+		rec := serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.Equal(Hit, rec.Header().Get("X-Cache"))
+		must.Equal(strconv.Itoa(requestID), rec.Header().Get("X-Request-Id"))
+		must.Equal(`"1"`, rec.Header().Get("ETag"))
+		must.Equal(int32(1), calls.Load())
+	})
+
+	t.Run("csp nonce", func(t *testing.T) {
+		must := must.New(t)
+		calls := 0
+		handler := func(rw http.ResponseWriter, r *http.Request) {
+			calls++
+			rw.Header().Set("Cache-Control", "max-age=60")
+			_, _ = rw.Write([]byte(`<script nonce="` + ngamux.Req(r).CSPNonce() + `"></script>`))
+		}
+		config := secure.Config{CSP: &secure.CSP{DefaultSrc: []string{"'self'"}, ScriptNonce: true}}
+		cached := secure.New(config)(New(newStore(clock), Config{now: clock})(handler))
+
+		first := serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+		second := serve(cached, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.Equal(Miss, second.Header().Get("X-Cache"))
+		must.Equal(2, calls)
+		must.NotEqual(first.Header().Get("Content-Security-Policy"), second.Header().Get("Content-Security-Policy"))
+		must.NotEqual(first.Body.String(), second.Body.String())
+	})
+}
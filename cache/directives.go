@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directives holds the parsed directives of a Cache-Control header,
+// keyed by lowercase name.
+type directives map[string]string
+
+func parseDirectives(header string) directives {
+	d := directives{}
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		d[name] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the delta-seconds value of the directive name.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// requestDirectives returns the directives of r, honoring Pragma:
+// no-cache when there is no Cache-Control header.
+func requestDirectives(r *http.Request) directives {
+	cc := r.Header.Get("Cache-Control")
+	if cc == "" && strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache") {
+		return directives{"no-cache": ""}
+	}
+	return parseDirectives(cc)
+}
+
+// cacheableStatus lists the statuses a shared cache may store.
+var cacheableStatus = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusNoContent,
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusPermanentRedirect,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusGone,
+	http.StatusRequestURITooLong,
+	http.StatusNotImplemented,
+}
+
+// freshness returns how long a response to r with status and header
+// stays fresh and how long it may be served stale while revalidating
+// afterwards. ok is false when the response must not be stored.
+func (c *Config) freshness(r *http.Request, status int, header http.Header, now time.Time) (ttl, stale time.Duration, ok bool) {
+	if !slices.Contains(cacheableStatus, status) || header.Get("Set-Cookie") != "" {
+		return 0, 0, false
+	}
+
+	d := parseDirectives(header.Get("Cache-Control"))
+	if d.has("no-store") || d.has("no-cache") || d.has("private") {
+		return 0, 0, false
+	}
+	if r.Header.Get("Authorization") != "" && !d.has("public") && !d.has("s-maxage") {
+		return 0, 0, false
+	}
+	for _, name := range header.Values("Vary") {
+		for _, name := range strings.Split(name, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !slices.ContainsFunc(c.Vary, func(v string) bool { return strings.EqualFold(v, name) }) {
+				return 0, 0, false
+			}
+		}
+	}
+
+	var explicit bool
+	if ttl, explicit = d.seconds("s-maxage"); !explicit {
+		if ttl, explicit = d.seconds("max-age"); !explicit {
+			if expires := header.Get("Expires"); expires != "" {
+				explicit = true
+				if t, err := http.ParseTime(expires); err == nil {
+					date := now
+					if t, err := http.ParseTime(header.Get("Date")); err == nil {
+						date = t
+					}
+					ttl = max(t.Sub(date), 0)
+				}
+			}
+		}
+	}
+	if !explicit {
+		ttl = c.DefaultTTL
+	}
+
+	stale, set := d.seconds("stale-while-revalidate")
+	if !set {
+		stale = c.StaleWhileRevalidate
+	}
+	if d.has("must-revalidate") || d.has("proxy-revalidate") {
+		stale = 0
+	}
+	return ttl, stale, ttl+stale > 0
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestParseDirectives(t *testing.T) {
+	must := must.New(t)
+	d := parseDirectives(`Public, max-age=60, stale-while-revalidate="30", , no-cache="Set-Cookie"`)
+	must.True(d.has("public"))
+	must.Equal("Set-Cookie", d["no-cache"])
+
+	age, ok := d.seconds("max-age")
+	must.True(ok)
+	must.Equal(time.Minute, age)
+	age, ok = d.seconds("stale-while-revalidate")
+	must.True(ok)
+	must.Equal(30*time.Second, age)
+	_, ok = d.seconds("public")
+	must.False(ok)
+}
+
+func TestFreshness(t *testing.T) {
+	must := must.New(t)
+	now := time.Unix(1700000000, 0)
+	cfg := Config{DefaultTTL: time.Second, StaleWhileRevalidate: 2 * time.Second}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	header := func(cacheControl string) http.Header {
+		return http.Header{"Cache-Control": {cacheControl}}
+	}
+
+	ttl, stale, ok := cfg.freshness(req, http.StatusOK, header("max-age=60, s-maxage=120"), now)
+	must.True(ok)
+	must.Equal(2*time.Minute, ttl)
+	must.Equal(2*time.Second, stale)
+
+	ttl, stale, ok = cfg.freshness(req, http.StatusNotFound, header(""), now)
+	must.True(ok)
+	must.Equal(time.Second, ttl)
+
+	_, stale, _ = cfg.freshness(req, http.StatusOK, header("max-age=60, must-revalidate"), now)
+	must.Equal(time.Duration(0), stale)
+
+	// An Expires in the past is explicit freshness of zero.
+	_, _, ok = cfg.freshness(req, http.StatusOK, http.Header{"Expires": {"0"}}, now)
+	must.True(ok)
+	_, _, ok = cfg.freshness(req, http.StatusOK, http.Header{"Cache-Control": {"max-age=0, must-revalidate"}}, now)
+	must.False(ok)
+}
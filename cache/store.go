@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a stored response.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Stored is when the response was generated.
+	Stored time.Time
+	// Expires is when the response stops being fresh.
+	Expires time.Time
+	// StaleWhileRevalidate is how long after Expires the response may
+	// still be served while a fresh one is fetched in the background.
+	StaleWhileRevalidate time.Duration
+}
+
+// Store persists cached responses.
+type Store interface {
+	// Get returns the entry of key and true, or false when there is none.
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	// Set stores entry under key, kept at most until expiry.
+	Set(ctx context.Context, key string, entry Entry, expiry time.Time) error
+	// Delete removes key.
+	Delete(ctx context.Context, key string) error
+}
+
+type lruItem struct {
+	key    string
+	entry  Entry
+	expiry time.Time
+	size   int
+}
+
+// MemoryStore is a Store keeping entries in process memory, evicting the
+// least recently used ones past its limits.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	size       int
+	items      map[string]*list.Element
+	order      *list.List
+	now        func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore holding at most maxEntries
+// entries with bodies of at most maxBytes in total. A limit of zero or
+// less means no limit.
+func NewMemoryStore(maxEntries, maxBytes int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		items:      map[string]*list.Element{},
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(ctx context.Context, key string) (Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.items[key]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	item := e.Value.(*lruItem)
+	if !m.now().Before(item.expiry) {
+		m.remove(e)
+		return Entry{}, false, nil
+	}
+	m.order.MoveToFront(e)
+	return item.entry, true, nil
+}
+
+// Set implements Store. Entries larger than the byte limit are not
+// stored.
+func (m *MemoryStore) Set(ctx context.Context, key string, entry Entry, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.items[key]; ok {
+		m.remove(e)
+	}
+	size := len(entry.Body)
+	if m.maxBytes > 0 && size > m.maxBytes {
+		return nil
+	}
+	m.items[key] = m.order.PushFront(&lruItem{key, entry, expiry, size})
+	m.size += size
+
+	for (m.maxEntries > 0 && m.order.Len() > m.maxEntries) || (m.maxBytes > 0 && m.size > m.maxBytes) {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.items[key]; ok {
+		m.remove(e)
+	}
+	return nil
+}
+
+// Len returns the number of entries held, including expired ones that
+// were not requested since.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *MemoryStore) remove(e *list.Element) {
+	item := m.order.Remove(e).(*lruItem)
+	delete(m.items, item.key)
+	m.size -= item.size
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestMemoryStore(t *testing.T) {
+	must := must.New(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore(2, 8)
+	store.now = func() time.Time { return now }
+	expiry := now.Add(time.Minute)
+
+	must.Nil(store.Set(ctx, "a", Entry{Body: []byte("aaa")}, expiry))
+	must.Nil(store.Set(ctx, "b", Entry{Body: []byte("bbb")}, expiry))
+	_, ok, _ := store.Get(ctx, "a")
+	must.True(ok)
+
+	// The least recently used entry is evicted past the entry limit.
+	must.Nil(store.Set(ctx, "c", Entry{Body: []byte("c")}, expiry))
+	_, ok, _ = store.Get(ctx, "b")
+	must.False(ok)
+	must.Equal(2, store.Len())
+
+	// And past the byte limit.
+	must.Nil(store.Set(ctx, "c", Entry{Body: []byte("cccccc")}, expiry))
+	_, ok, _ = store.Get(ctx, "a")
+	must.False(ok)
+	entry, ok, _ := store.Get(ctx, "c")
+	must.True(ok)
+	must.Equal("cccccc", string(entry.Body))
+
+	// Entries too large are not stored.
+	must.Nil(store.Set(ctx, "d", Entry{Body: []byte("ddddddddd")}, expiry))
+	_, ok, _ = store.Get(ctx, "d")
+	must.False(ok)
+
+	// Expired entries are dropped.
+	now = expiry
+	_, ok, _ = store.Get(ctx, "c")
+	must.False(ok)
+	must.Equal(0, store.Len())
+
+	must.Nil(store.Set(ctx, "e", Entry{}, now.Add(time.Minute)))
+	must.Nil(store.Delete(ctx, "e"))
+	must.Equal(0, store.Len())
+}
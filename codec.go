@@ -0,0 +1,186 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ngamux/ngamux/codec"
+)
+
+// DecodeError describes why Request.Decode rejected a request body that
+// is not JSON.
+type DecodeError struct {
+	// MediaType is the media type of the body.
+	MediaType string
+	// Err is the underlying error, e.g. ErrUnsupportedMediaType or an
+	// error of the codec.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.MediaType == "" {
+		return "invalid body: " + e.Err.Error()
+	}
+	return "invalid " + e.MediaType + " body: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status to answer with: 415 for unsupported
+// media types, 413 for bodies over the limit and 400 otherwise.
+func (e *DecodeError) Status() int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(e.Err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.As(e.Err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Problem returns a problem with the status of e and its message as
+// detail.
+func (e *DecodeError) Problem() Problem {
+	return NewProblem(e.Status(), e.Error())
+}
+
+// Decode decodes the request body into the pointer v with the codec of
+// its Content-Type, looked up in the router's Codecs. JSON bodies, and
+// bodies without a Content-Type, are decoded with the router's JSON
+// codec as by Request.JSON with JSONOptions limited to MaxBytes,
+// reporting errors as a *JSONError. Other bodies report errors as a
+// *DecodeError, wrapping ErrUnsupportedMediaType when no codec is
+// registered for the media type. Bodies over the router's MaxDecodeBytes
+// are rejected with a *http.MaxBytesError. Decoded values are validated
+// when the router has a Validator.
+func (r Request) Decode(v any) error {
+	config := configFromRequest(r.Request)
+	maxBytes := max(config.MaxDecodeBytes, 0)
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	switch {
+	case contentType == "" || isJSONMediaType(mediaType):
+		if err := decodeJSON(r.Request, v, JSONOptions{MaxBytes: maxBytes}); err != nil {
+			return err
+		}
+	case err != nil:
+		return &DecodeError{Err: ErrUnsupportedMediaType}
+	default:
+		c, ok := config.codecs().Lookup(mediaType)
+		if !ok {
+			return &DecodeError{MediaType: mediaType, Err: ErrUnsupportedMediaType}
+		}
+		body := r.Body
+		if body == nil {
+			body = http.NoBody
+		}
+		if maxBytes > 0 {
+			body = http.MaxBytesReader(nil, body, maxBytes)
+		}
+		if err := c.Decode(body, v); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrEmptyBody
+			}
+			return &DecodeError{MediaType: mediaType, Err: err}
+		}
+	}
+
+	if config.Validator != nil {
+		return config.Validator.Struct(v)
+	}
+	return nil
+}
+
+// Encode writes v with the codec of the router's Codecs that the Accept
+// header of the request given to Res prefers, see NegotiateMediaType.
+// JSON, encoded with the router's JSON codec, wins ties, so it is chosen
+// when the request accepts any media type or has no Accept header. When
+// no registered media type is acceptable, a 406 Not Acceptable problem is
+// written instead.
+//
+// Responses written by Encode vary by Accept, and take part in ETag
+// handling like the ones written by JSON.
+func (r *Response) Encode(v any) {
+	r.Header().Add("Vary", "Accept")
+
+	mediaType, c, ok := r.encoder()
+	if !ok {
+		r.notAcceptable(r.mediaTypes())
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := c.Encode(buf, v); err != nil {
+		http.Error(r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		mediaType += "; charset=utf-8"
+	}
+	r.send(http.Header{"Content-Type": {mediaType}}, buf.Bytes())
+}
+
+// codecs returns the codec registry of the router serving the request
+// given to Res or ETag.
+func (r *Response) codecs() *codec.Registry {
+	switch {
+	case r.config != nil:
+		return r.config.codecs()
+	case r.request != nil:
+		return configFromRequest(r.request).codecs()
+	}
+	return codec.Default()
+}
+
+// codec returns the codec of mediaType: the router's JSON codec for JSON
+// media types and the one registered in its Codecs otherwise.
+func (r *Response) codec(mediaType string) (codec.Codec, bool) {
+	if isJSONMediaType(mediaType) {
+		return codec.JSON(r.jsonCodec()), true
+	}
+	return r.codecs().Lookup(mediaType)
+}
+
+// mediaTypes returns the media types Encode can produce, JSON first.
+func (r *Response) mediaTypes() []string {
+	mediaTypes := []string{"application/json"}
+	for _, mediaType := range r.codecs().MediaTypes() {
+		if !slices.Contains(mediaTypes, mediaType) {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	return mediaTypes
+}
+
+// encoder returns the media type and codec to encode a response with,
+// negotiated among the registered media types, JSON first, and the
+// exact types of the Accept header that have a codec, such as
+// application/vnd.api+json.
+func (r *Response) encoder() (string, codec.Codec, bool) {
+	items := ParseAccept(r.accept())
+	offers := r.mediaTypes()
+	for _, item := range items {
+		if strings.Contains(item.Value, "*") || slices.Contains(offers, item.Value) {
+			continue
+		}
+		if _, ok := r.codec(item.Value); ok {
+			offers = append(offers, item.Value)
+		}
+	}
+
+	mediaType, ok := negotiate(items, offers, matchMediaRange)
+	if !ok {
+		return "", nil, false
+	}
+	c, _ := r.codec(mediaType)
+	return mediaType, c, true
+}
@@ -0,0 +1,662 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file holds what MessagePack and CBOR share: both encode Go values
+// by walking them with reflection into a writer for their format, and
+// decode by reading a generic value, which is then assigned to the
+// destination.
+
+// maxDepth limits the nesting of arrays and maps read from a stream.
+const maxDepth = 1000
+
+// allocChunk is the most memory allocated up front for a string or byte
+// string read from a stream. Longer ones grow as their bytes arrive, so
+// that a forged length cannot exhaust memory.
+const allocChunk = 64 << 10
+
+var (
+	// ErrMaxDepth is reported when a MessagePack or CBOR value nests
+	// arrays and maps too deeply.
+	ErrMaxDepth = errors.New("codec: maximum nesting depth exceeded")
+
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// binaryWriter writes the values of one binary format.
+type binaryWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(n int64)
+	writeUint(n uint64)
+	writeFloat(f float64, bits int)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeTime(t time.Time)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+}
+
+// pair is a key and value read from a map, kept in order since keys of
+// any type can be read.
+type pair struct {
+	key, value any
+}
+
+// field is a struct field encoded by a binary format.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+type fieldsKey struct {
+	typ reflect.Type
+	tag string
+}
+
+var fieldsCache sync.Map
+
+// structFields returns the encoded fields of the struct type typ, named
+// after their tag, json tag or name. Fields of embedded structs without
+// a name are promoted.
+func structFields(typ reflect.Type, tag string) []field {
+	key := fieldsKey{typ, tag}
+	if fields, ok := fieldsCache.Load(key); ok {
+		return fields.([]field)
+	}
+	fields, _ := fieldsCache.LoadOrStore(key, collectFields(typ, tag, nil))
+	return fields.([]field)
+}
+
+func collectFields(typ reflect.Type, tag string, index []int) []field {
+	var fields []field
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		value, ok := f.Tag.Lookup(tag)
+		if !ok {
+			value = f.Tag.Get("json")
+		}
+		name, options, _ := strings.Cut(value, ",")
+		if name == "-" && options == "" {
+			continue
+		}
+
+		fieldIndex := append(slices.Clone(index), i)
+		ftyp := f.Type
+		if ftyp.Kind() == reflect.Pointer {
+			ftyp = ftyp.Elem()
+		}
+		if f.Anonymous && name == "" && ftyp.Kind() == reflect.Struct {
+			fields = append(fields, collectFields(ftyp, tag, fieldIndex)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{name, fieldIndex, strings.Contains(","+options+",", ",omitempty,")})
+	}
+	return fields
+}
+
+// fieldByIndex returns the field of v at index, or an invalid value when
+// an embedded pointer on the way is nil.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// isEmpty reports whether v is empty for omitempty, as in encoding/json.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// encodeValue writes v to w, naming struct fields after tag.
+func encodeValue(w binaryWriter, v reflect.Value, tag string) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeValue(w, v.Elem(), tag)
+		}
+	}
+
+	switch {
+	case v.Type() == timeType:
+		w.writeTime(v.Interface().(time.Time))
+		return nil
+	case v.Type().Implements(textMarshalerType):
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		w.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		return encodeValue(w, v.Elem(), tag)
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		w.writeFloat(v.Float(), v.Type().Bits())
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Array {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			w.writeBytes(b)
+			return nil
+		}
+		w.writeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		keys := v.MapKeys()
+		sortKeys(keys)
+		w.writeMapHeader(len(keys))
+		for _, key := range keys {
+			if err := encodeValue(w, key, tag); err != nil {
+				return err
+			}
+			if err := encodeValue(w, v.MapIndex(key), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(v.Type(), tag)
+		values := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, f := range fields {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || (f.omitEmpty && isEmpty(fv)) {
+				continue
+			}
+			values = append(values, fv)
+			names = append(names, f.name)
+		}
+		w.writeMapHeader(len(values))
+		for i, fv := range values {
+			w.writeString(names[i])
+			if err := encodeValue(w, fv, tag); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("codec: cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+// sortKeys orders map keys so that encoding is deterministic.
+func sortKeys(keys []reflect.Value) {
+	if len(keys) == 0 {
+		return
+	}
+	switch keys[0].Kind() {
+	case reflect.String:
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(a.Int(), b.Int()) })
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(a.Uint(), b.Uint()) })
+	}
+}
+
+// binaryReader reads bytes for the decoder of one binary format.
+type binaryReader struct {
+	r     *bufio.Reader
+	depth int
+}
+
+func newBinaryReader(r io.Reader) *binaryReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &binaryReader{r: br}
+}
+
+// enter accounts for one more level of nesting.
+func (r *binaryReader) enter() error {
+	r.depth++
+	if r.depth > maxDepth {
+		return ErrMaxDepth
+	}
+	return nil
+}
+
+func (r *binaryReader) leave() {
+	r.depth--
+}
+
+func (r *binaryReader) byte() (byte, error) {
+	b, err := r.r.ReadByte()
+	return b, unexpectedEOF(err)
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (r *binaryReader) uint(n int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r.r, buf[:n]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	var v uint64
+	for _, b := range buf[:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// bytes reads n bytes, see allocChunk.
+func (r *binaryReader) bytes(n uint64) ([]byte, error) {
+	if n <= allocChunk {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r.r, b)
+		return b, unexpectedEOF(err)
+	}
+	if n > math.MaxInt64 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r.r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// capacity returns the capacity allocated up front for n elements read
+// from a stream.
+func capacity(n uint64) int {
+	return int(min(n, 1024))
+}
+
+// decodeInto assigns the generic value g, as read by a binary format,
+// to the pointer v.
+func decodeInto(g any, v any, tag string) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.IsNil() {
+		return fmt.Errorf("codec: cannot decode into %T, a non-nil pointer is required", v)
+	}
+	return assign(g, val.Elem(), tag)
+}
+
+// assign sets v from the generic value g.
+func assign(g any, v reflect.Value, tag string) error {
+	if g == nil {
+		v.SetZero()
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(g, v.Elem(), tag)
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			break
+		}
+		natural, err := naturalValue(g)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(natural))
+		return nil
+	}
+
+	if v.Type() == timeType {
+		switch g := g.(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(g))
+			return nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, g)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return mismatch(g, v)
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		switch g := g.(type) {
+		case string:
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(g))
+		case []byte:
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(g)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := g.(bool)
+		if !ok {
+			return mismatch(g, v)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch g := g.(type) {
+		case int64:
+			n = g
+		case uint64:
+			if g > math.MaxInt64 {
+				return mismatch(g, v)
+			}
+			n = int64(g)
+		default:
+			return mismatch(g, v)
+		}
+		if v.OverflowInt(n) {
+			return mismatch(g, v)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch g := g.(type) {
+		case uint64:
+			n = g
+		case int64:
+			if g < 0 {
+				return mismatch(g, v)
+			}
+			n = uint64(g)
+		default:
+			return mismatch(g, v)
+		}
+		if v.OverflowUint(n) {
+			return mismatch(g, v)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch g := g.(type) {
+		case float64:
+			v.SetFloat(g)
+		case float32:
+			v.SetFloat(float64(g))
+		case int64:
+			v.SetFloat(float64(g))
+		case uint64:
+			v.SetFloat(float64(g))
+		default:
+			return mismatch(g, v)
+		}
+	case reflect.String:
+		switch g := g.(type) {
+		case string:
+			v.SetString(g)
+		case []byte:
+			v.SetString(string(g))
+		default:
+			return mismatch(g, v)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch g := g.(type) {
+			case []byte:
+				v.SetBytes(g)
+				return nil
+			case string:
+				v.SetBytes([]byte(g))
+				return nil
+			}
+		}
+		items, ok := g.([]any)
+		if !ok {
+			return mismatch(g, v)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(item, slice.Index(i), tag); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		if b, ok := g.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetZero()
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		items, ok := g.([]any)
+		if !ok {
+			return mismatch(g, v)
+		}
+		v.SetZero()
+		for i := 0; i < min(len(items), v.Len()); i++ {
+			if err := assign(items[i], v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		pairs, ok := g.([]pair)
+		if !ok {
+			return mismatch(g, v)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(pairs)))
+		}
+		for _, p := range pairs {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := assign(p.key, key, tag); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := assign(p.value, value, tag); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		pairs, ok := g.([]pair)
+		if !ok {
+			return mismatch(g, v)
+		}
+		fields := structFields(v.Type(), tag)
+		for _, p := range pairs {
+			name, ok := p.key.(string)
+			if !ok {
+				continue
+			}
+			f := findField(fields, name)
+			if f == nil {
+				continue
+			}
+			if err := assign(p.value, fieldAlloc(v, f.index), tag); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+	default:
+		return mismatch(g, v)
+	}
+	return nil
+}
+
+// findField returns the field named name, matched exactly or else
+// case-insensitively.
+func findField(fields []field, name string) *field {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// fieldAlloc returns the field of v at index, allocating nil embedded
+// pointers on the way.
+func fieldAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// naturalValue returns g as stored in an empty interface: integers are
+// int64 unless out of its range, and maps become map[string]any when all
+// their keys are strings and map[any]any otherwise.
+func naturalValue(g any) (any, error) {
+	switch g := g.(type) {
+	case uint64:
+		if g <= math.MaxInt64 {
+			return int64(g), nil
+		}
+		return g, nil
+	case []any:
+		for i, item := range g {
+			natural, err := naturalValue(item)
+			if err != nil {
+				return nil, err
+			}
+			g[i] = natural
+		}
+		return g, nil
+	case []pair:
+		strs := make(map[string]any, len(g))
+		for _, p := range g {
+			key, ok := p.key.(string)
+			if !ok {
+				return naturalAnyMap(g)
+			}
+			value, err := naturalValue(p.value)
+			if err != nil {
+				return nil, err
+			}
+			strs[key] = value
+		}
+		return strs, nil
+	}
+	return g, nil
+}
+
+func naturalAnyMap(pairs []pair) (any, error) {
+	m := make(map[any]any, len(pairs))
+	for _, p := range pairs {
+		key, err := naturalValue(p.key)
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := key.([]byte); ok {
+			key = string(k)
+		}
+		// Arrays and maps cannot be Go map keys: hashing them panics.
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("codec: cannot decode a map key of type %s", describe(key))
+		}
+		value, err := naturalValue(p.value)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func mismatch(g any, v reflect.Value) error {
+	return fmt.Errorf("codec: cannot decode %s into %s", describe(g), v.Type())
+}
+
+// describe names the kind of the generic value g in errors.
+func describe(g any) string {
+	switch g.(type) {
+	case bool:
+		return "boolean"
+	case int64, uint64:
+		return "integer"
+	case float32, float64:
+		return "float"
+	case string:
+		return "string"
+	case []byte:
+		return "byte string"
+	case time.Time:
+		return "time"
+	case []any:
+		return "array"
+	case []pair, map[string]any, map[any]any:
+		return "map"
+	}
+	return fmt.Sprintf("%T", g)
+}
@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+// TestUnhashableMapKeys replays fuzzer inputs whose map keys are maps or
+// arrays, which used to panic when inserted in a Go map.
+func TestUnhashableMapKeys(t *testing.T) {
+	type target struct {
+		M map[string]any `json:"m"`
+	}
+
+	for _, tc := range []struct {
+		name  string
+		codec Codec
+		input string
+		v     any
+	}{
+		{"msgpack map key", MessagePack, "81 81 01 02 03", new(any)},
+		{"msgpack array key", MessagePack, "81 91 01 02", new(any)},
+		{"msgpack nested map key", MessagePack, "81 01 81 81 01 02 03", new(any)},
+		{"msgpack field", MessagePack, "81 a1 6d 81 81 01 02 03", &target{}},
+		{"msgpack field array key", MessagePack, "81 a1 6d 81 92 01 02 03", &target{}},
+		{"cbor map key", CBOR, "a1 a1 01 02 03", new(any)},
+		{"cbor array key", CBOR, "a1 81 01 02", new(any)},
+		{"cbor nested map key", CBOR, "a1 01 a1 a1 01 02 03", new(any)},
+		{"cbor field", CBOR, "a1 61 6d a1 a1 01 02 03", &target{}},
+		{"cbor field array key", CBOR, "a1 61 6d a1 82 01 02 03", &target{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			must := must.New(t)
+			must.NotNil(tc.codec.Decode(bytes.NewReader(hexBytes(tc.input)), tc.v))
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// CBOR is the Codec of application/cbor bodies, as defined by RFC 8949.
+// Struct fields are named after their cbor tags, and time.Time values
+// are written as RFC 3339 strings with tag 0. Decoding accepts
+// indefinite-length items, half-precision floats, and times with tag 0
+// or 1; other tags are ignored in favor of their content. Decoding into
+// an empty interface gives the same types as MessagePack.
+var CBOR Codec = cborCodec{}
+
+type cborCodec struct{}
+
+func (cborCodec) Encode(w io.Writer, v any) error {
+	e := &cborWriter{}
+	if err := encodeValue(e, reflect.ValueOf(v), "cbor"); err != nil {
+		return err
+	}
+	_, err := w.Write(e.Bytes())
+	return err
+}
+
+func (cborCodec) Decode(r io.Reader, v any) error {
+	d := &cborReader{newBinaryReader(r)}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		// An empty stream is io.EOF.
+		return err
+	}
+	g, err := d.read(b)
+	if err != nil {
+		return err
+	}
+	return decodeInto(g, v, "cbor")
+}
+
+// Major types of CBOR data items.
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborBreak ends indefinite-length items.
+const cborBreak = 0xff
+
+var errCBORBreak = errors.New("codec: unexpected CBOR break")
+
+type cborWriter struct {
+	bytes.Buffer
+}
+
+// head writes the initial bytes of an item of major type major with
+// argument n.
+func (e *cborWriter) head(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		e.WriteByte(major | 24)
+		e.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.WriteByte(major | 25)
+		e.put(n, 2)
+	case n <= math.MaxUint32:
+		e.WriteByte(major | 26)
+		e.put(n, 4)
+	default:
+		e.WriteByte(major | 27)
+		e.put(n, 8)
+	}
+}
+
+func (e *cborWriter) put(n uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		e.WriteByte(byte(n >> (8 * i)))
+	}
+}
+
+func (e *cborWriter) writeNil() {
+	e.WriteByte(0xf6)
+}
+
+func (e *cborWriter) writeBool(b bool) {
+	if b {
+		e.WriteByte(0xf5)
+		return
+	}
+	e.WriteByte(0xf4)
+}
+
+func (e *cborWriter) writeInt(n int64) {
+	if n >= 0 {
+		e.head(cborUint, uint64(n))
+		return
+	}
+	e.head(cborNegInt, uint64(-1-n))
+}
+
+func (e *cborWriter) writeUint(n uint64) {
+	e.head(cborUint, n)
+}
+
+func (e *cborWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		e.WriteByte(0xfa)
+		e.put(uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+	e.WriteByte(0xfb)
+	e.put(math.Float64bits(f), 8)
+}
+
+func (e *cborWriter) writeString(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.WriteString(s)
+}
+
+func (e *cborWriter) writeBytes(b []byte) {
+	e.head(cborBytes, uint64(len(b)))
+	e.Write(b)
+}
+
+func (e *cborWriter) writeTime(t time.Time) {
+	e.head(cborTag, 0)
+	e.writeString(t.Format(time.RFC3339Nano))
+}
+
+func (e *cborWriter) writeArrayHeader(n int) {
+	e.head(cborArray, uint64(n))
+}
+
+func (e *cborWriter) writeMapHeader(n int) {
+	e.head(cborMap, uint64(n))
+}
+
+type cborReader struct {
+	*binaryReader
+}
+
+// argument reads the argument of an item whose initial byte has the
+// additional information info. indefinite is reported for info 31.
+func (d *cborReader) argument(info byte) (n uint64, indefinite bool, err error) {
+	switch {
+	case info < 24:
+		return uint64(info), false, nil
+	case info <= 27:
+		n, err := d.uint(1 << (info - 24))
+		return n, false, err
+	case info == 31:
+		return 0, true, nil
+	}
+	return 0, false, fmt.Errorf("codec: invalid CBOR additional information %d", info)
+}
+
+func (d *cborReader) next() (any, error) {
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	return d.read(b)
+}
+
+// read reads the item starting with the byte b.
+func (d *cborReader) read(b byte) (any, error) {
+	major, info := b>>5, b&0x1f
+	if major == cborSimple {
+		return d.readSimple(info)
+	}
+
+	n, indefinite, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+	if indefinite && (major == cborUint || major == cborNegInt || major == cborTag) {
+		return nil, fmt.Errorf("codec: invalid indefinite-length CBOR item of major type %d", major)
+	}
+
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("codec: CBOR negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		var data []byte
+		if indefinite {
+			data, err = d.readChunks(major)
+		} else {
+			data, err = d.bytes(n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(data), nil
+		}
+		return data, nil
+	case cborArray:
+		return d.readArray(n, indefinite)
+	case cborMap:
+		return d.readMap(n, indefinite)
+	}
+	return d.readTag(n)
+}
+
+// readChunks reads the definite-length chunks of an indefinite-length
+// byte or text string of major type major.
+func (d *cborReader) readChunks(major byte) ([]byte, error) {
+	var data []byte
+	for {
+		b, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == cborBreak {
+			return data, nil
+		}
+		if b>>5 != major || b&0x1f == 31 {
+			return nil, errors.New("codec: invalid chunk in indefinite-length CBOR string")
+		}
+		n, _, err := d.argument(b & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// item reads the next item of an array or map, reporting whether the
+// break of an indefinite-length one was read instead.
+func (d *cborReader) item(indefinite bool) (any, bool, error) {
+	b, err := d.byte()
+	if err != nil {
+		return nil, false, err
+	}
+	if indefinite && b == cborBreak {
+		return nil, true, nil
+	}
+	g, err := d.read(b)
+	return g, false, err
+}
+
+func (d *cborReader) readArray(n uint64, indefinite bool) (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	items := make([]any, 0, capacity(n))
+	for i := uint64(0); indefinite || i < n; i++ {
+		item, done, err := d.item(indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *cborReader) readMap(n uint64, indefinite bool) (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	pairs := make([]pair, 0, capacity(n))
+	for i := uint64(0); indefinite || i < n; i++ {
+		key, done, err := d.item(indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		value, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+	return pairs, nil
+}
+
+// readTag reads the content of an item tagged with tag, converting
+// times and bignums.
+func (d *cborReader) readTag(tag uint64) (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	content, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case 0:
+		s, ok := content.(string)
+		if !ok {
+			return nil, fmt.Errorf("codec: invalid CBOR date/time string of type %s", describe(content))
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case 1:
+		switch n := content.(type) {
+		case uint64:
+			if n > math.MaxInt64 {
+				break
+			}
+			return time.Unix(int64(n), 0).UTC(), nil
+		case int64:
+			return time.Unix(n, 0).UTC(), nil
+		case float32:
+			return floatTime(float64(n)), nil
+		case float64:
+			return floatTime(n), nil
+		}
+		return nil, fmt.Errorf("codec: invalid CBOR epoch time of type %s", describe(content))
+	case 2, 3:
+		b, ok := content.([]byte)
+		if !ok || len(bytes.TrimLeft(b, "\x00")) > 8 {
+			return nil, errors.New("codec: CBOR bignum overflows 64 bits")
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if tag == 2 {
+			return n, nil
+		}
+		if n > math.MaxInt64 {
+			return nil, errors.New("codec: CBOR negative bignum overflows int64")
+		}
+		return -1 - int64(n), nil
+	}
+	return content, nil
+}
+
+func floatTime(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+// readSimple reads a simple value or float with additional information
+// info.
+func (d *cborReader) readSimple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		// null and undefined.
+		return nil, nil
+	case 25:
+		n, err := d.uint(2)
+		return halfFloat(uint16(n)), err
+	case 26:
+		n, err := d.uint(4)
+		return math.Float32frombits(uint32(n)), err
+	case 27:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 31:
+		return nil, errCBORBreak
+	}
+	return nil, fmt.Errorf("codec: unsupported CBOR simple value %d", info)
+}
+
+// halfFloat converts the IEEE 754 half-precision float h.
+func halfFloat(h uint16) float32 {
+	exp, mant := (h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, int(exp)-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return float32(f)
+}
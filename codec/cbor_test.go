@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestCBOREncode(t *testing.T) {
+	must := must.New(t)
+	for _, tc := range []struct {
+		value any
+		want  string
+	}{
+		{nil, "f6"},
+		{false, "f4"},
+		{10, "0a"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{float32(100000), "fa47c35000"},
+		{1.1, "fb3ff199999999999a"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]any{1, []int{2, 3}}, "82018202 03"},
+		{map[string]int{"a": 1, "b": 2}, "a2616101616202"},
+		{time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC), "c074323031332d30332d32315432303a30343a30305a"},
+	} {
+		buf := &bytes.Buffer{}
+		must.Nil(CBOR.Encode(buf, tc.value))
+		must.Equal(hex.EncodeToString(hexBytes(tc.want)), hex.EncodeToString(buf.Bytes()))
+	}
+}
+
+func TestCBORDecode(t *testing.T) {
+	must := must.New(t)
+	// Examples of RFC 8949, Appendix A.
+	for _, tc := range []struct {
+		data string
+		want any
+	}{
+		{"f97c00", float32(math.Inf(1))},
+		{"f93c00", float32(1)},
+		{"f9c400", float32(-4)},
+		{"f90001", float32(5.960464477539063e-8)},
+		{"f7", nil},
+		{"3bffffffffffffffff", nil},
+		{"c249010000000000000000", nil},
+		{"c248ffffffffffffffff", uint64(math.MaxUint64)},
+		{"c240", int64(0)},
+		{"c34101", int64(-2)},
+		{"c11a514b67b0", time.Unix(1363896240, 0)},
+		{"c1fb41d452d9ec200000", time.Unix(1363896240, 500000000)},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+	} {
+		var v any
+		err := CBOR.Decode(bytes.NewReader(hexBytes(tc.data)), &v)
+		if tc.want == nil && tc.data != "f7" {
+			must.NotNil(err)
+			continue
+		}
+		must.Nil(err)
+		if want, ok := tc.want.(time.Time); ok {
+			must.True(want.Equal(v.(time.Time)))
+			continue
+		}
+		must.Equal(tc.want, v)
+	}
+
+	var n int
+	must.Nil(CBOR.Decode(bytes.NewReader(hexBytes("3903e7")), &n))
+	must.Equal(-1000, n)
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	must := must.New(t)
+	in := binaryValue()
+	buf := &bytes.Buffer{}
+	must.Nil(CBOR.Encode(buf, in))
+
+	var out binaryStruct
+	must.Nil(CBOR.Decode(buf, &out))
+	// Without a location in RFC 3339, times decode in UTC.
+	must.True(in.When.Equal(out.When))
+	out.When = in.When
+	must.Equal(in, out)
+}
+
+func TestCBORDecodeErrors(t *testing.T) {
+	must := must.New(t)
+	var v any
+	must.Equal(io.EOF, CBOR.Decode(bytes.NewReader(nil), &v))
+	must.Equal(io.ErrUnexpectedEOF, CBOR.Decode(bytes.NewReader(hexBytes("62 61")), &v))
+	must.Equal(io.ErrUnexpectedEOF, CBOR.Decode(bytes.NewReader(hexBytes("7b 7f ff ff ff ff ff ff ff 61")), &v))
+	must.Equal(io.ErrUnexpectedEOF, CBOR.Decode(bytes.NewReader(hexBytes("9a ff ff ff ff 01")), &v))
+	must.Equal(errCBORBreak, CBOR.Decode(bytes.NewReader(hexBytes("ff")), &v))
+	must.NotNil(CBOR.Decode(bytes.NewReader(hexBytes("1c")), &v))
+	must.NotNil(CBOR.Decode(bytes.NewReader(hexBytes("5f 61 61 ff")), &v))
+	must.NotNil(CBOR.Decode(bytes.NewReader(hexBytes("c0 01")), &v))
+
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+1)
+	must.True(errors.Is(CBOR.Decode(bytes.NewReader(deep), &v), ErrMaxDepth))
+	tags := bytes.Repeat([]byte{0xd8, 0x20}, maxDepth+1)
+	must.True(errors.Is(CBOR.Decode(bytes.NewReader(tags), &v), ErrMaxDepth))
+}
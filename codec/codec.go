@@ -0,0 +1,189 @@
+// Package codec encodes and decodes message bodies by media type.
+//
+// A Registry maps media types to Codecs. Default holds the codecs
+// shipped with Ngamux:
+//
+//	application/json                   JSON, through json.Default
+//	application/xml, text/xml          XML, through encoding/xml
+//	application/x-www-form-urlencoded  Form
+//	text/csv                           CSV
+//	application/msgpack                MessagePack
+//	application/cbor                   CBOR
+//
+// Structured syntax suffixes are honored, so application/problem+json
+// is handled by the application/json codec unless registered itself.
+//
+// MessagePack and CBOR name struct fields after their msgpack and cbor
+// tags, falling back to their json tags and then to the field names,
+// and support the omitempty option.
+package codec
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ngamux/ngamux/json"
+)
+
+// Codec encodes values to and decodes values from a stream in one
+// format. Decode stores the value in the pointer v.
+type Codec interface {
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// Registry maps media types to codecs. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	codecs     map[string]Codec
+	mediaTypes []string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{codecs: map[string]Codec{}}
+}
+
+var defaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register("application/json", JSON(nil))
+	registry.Register("application/xml", XML)
+	registry.Register("text/xml", XML)
+	registry.Register("application/x-www-form-urlencoded", Form)
+	registry.Register("text/csv", CSV)
+	registry.Register("application/msgpack", MessagePack)
+	registry.Register("application/x-msgpack", MessagePack)
+	registry.Register("application/vnd.msgpack", MessagePack)
+	registry.Register("application/cbor", CBOR)
+	return registry
+}
+
+// Default returns the Registry holding the codecs shipped with Ngamux.
+// Codecs registered to it are available to every router that does not
+// have a Registry of its own.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Clone returns a copy of r, to which codecs can be registered without
+// affecting r.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	for _, mediaType := range r.mediaTypes {
+		clone.Register(mediaType, r.codecs[mediaType])
+	}
+	return clone
+}
+
+// Register maps mediaType, such as "application/yaml", to codec,
+// replacing any codec it was mapped to. A nil codec removes the
+// mapping. Parameters of mediaType are ignored.
+func (r *Registry) Register(mediaType string, codec Codec) {
+	mediaType = baseMediaType(mediaType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exists := r.codecs[mediaType]
+	switch {
+	case codec == nil:
+		delete(r.codecs, mediaType)
+		r.mediaTypes = slices.DeleteFunc(r.mediaTypes, func(m string) bool { return m == mediaType })
+	case !exists:
+		r.mediaTypes = append(r.mediaTypes, mediaType)
+		fallthrough
+	default:
+		r.codecs[mediaType] = codec
+	}
+}
+
+// Lookup returns the codec of mediaType, which may carry parameters as
+// in a Content-Type header. Media types with a structured syntax suffix,
+// such as application/vnd.api+json, that are not registered themselves
+// get the codec of the suffix: application/json, application/xml,
+// application/cbor or application/msgpack.
+func (r *Registry) Lookup(mediaType string) (Codec, bool) {
+	mediaType = baseMediaType(mediaType)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if codec, ok := r.codecs[mediaType]; ok {
+		return codec, true
+	}
+	if _, suffix, ok := strings.Cut(mediaType, "+"); ok && strings.HasPrefix(mediaType, "application/") {
+		switch suffix {
+		case "json", "xml", "cbor":
+			codec, ok := r.codecs["application/"+suffix]
+			return codec, ok
+		case "msgpack":
+			codec, ok := r.codecs["application/msgpack"]
+			return codec, ok
+		}
+	}
+	return nil, false
+}
+
+// MediaTypes returns the registered media types in registration order.
+func (r *Registry) MediaTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.mediaTypes)
+}
+
+// baseMediaType returns mediaType lowercased and without parameters.
+func baseMediaType(mediaType string) string {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return parsed
+	}
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// JSON returns a Codec encoding and decoding with c, or with
+// json.Default at the time of each call when c is nil.
+func JSON(c json.Codec) Codec {
+	return jsonCodec{c}
+}
+
+type jsonCodec struct {
+	codec json.Codec
+}
+
+func (c jsonCodec) json() json.Codec {
+	if c.codec == nil {
+		return json.Default()
+	}
+	return c.codec
+}
+
+func (c jsonCodec) Encode(w io.Writer, v any) error {
+	return c.json().NewEncoder(w).Encode(v)
+}
+
+func (c jsonCodec) Decode(r io.Reader, v any) error {
+	return c.json().NewDecoder(r).Decode(v)
+}
+
+// XML is the Codec backed by encoding/xml. It writes the XML header
+// before encoded values.
+var XML Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (xmlCodec) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,98 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/json"
+)
+
+type testItem struct {
+	Name  string `json:"name" xml:"name"`
+	Price int    `json:"price" xml:"price"`
+}
+
+func TestRegistry(t *testing.T) {
+	must := must.New(t)
+	registry := NewRegistry()
+	registry.Register("application/json", JSON(nil))
+	registry.Register("Application/XML; charset=utf-8", XML)
+
+	codec, ok := registry.Lookup("application/json; charset=utf-8")
+	must.True(ok)
+	must.Equal(JSON(nil), codec)
+
+	codec, ok = registry.Lookup("application/problem+json")
+	must.True(ok)
+	must.Equal(JSON(nil), codec)
+
+	codec, ok = registry.Lookup("application/atom+xml")
+	must.True(ok)
+	must.Equal(XML, codec)
+
+	_, ok = registry.Lookup("application/cbor")
+	must.False(ok)
+	_, ok = registry.Lookup("application/foo+cbor")
+	must.False(ok)
+	must.Equal([]string{"application/json", "application/xml"}, registry.MediaTypes())
+
+	registry.Register("application/json", nil)
+	_, ok = registry.Lookup("application/json")
+	must.False(ok)
+	must.Equal([]string{"application/xml"}, registry.MediaTypes())
+}
+
+func TestDefault(t *testing.T) {
+	must := must.New(t)
+	for mediaType, want := range map[string]Codec{
+		"application/json":                  JSON(nil),
+		"application/xml":                   XML,
+		"text/xml":                          XML,
+		"application/x-www-form-urlencoded": Form,
+		"text/csv":                          CSV,
+		"application/msgpack":               MessagePack,
+		"application/vnd.foo+msgpack":       MessagePack,
+		"application/cbor":                  CBOR,
+	} {
+		codec, ok := Default().Lookup(mediaType)
+		must.True(ok)
+		must.Equal(want, codec)
+	}
+
+	clone := Default().Clone()
+	clone.Register("application/cbor", nil)
+	_, ok := Default().Lookup("application/cbor")
+	must.True(ok)
+}
+
+func TestJSON(t *testing.T) {
+	must := must.New(t)
+	buf := &bytes.Buffer{}
+	must.Nil(JSON(json.Standard).Encode(buf, testItem{"a", 1}))
+	must.Equal("{\"name\":\"a\",\"price\":1}\n", buf.String())
+
+	var item testItem
+	must.Nil(JSON(nil).Decode(buf, &item))
+	must.Equal(testItem{"a", 1}, item)
+
+	// Without a codec, the one of the json package is used at each call.
+	buf.Reset()
+	json.Configure(func(any) ([]byte, error) { return []byte(`"configured"`), nil }, nil)
+	defer json.Configure(json.Standard.Marshal, json.Standard.Unmarshal)
+	must.Nil(JSON(nil).Encode(buf, item))
+	must.Equal("\"configured\"\n", buf.String())
+}
+
+func TestXML(t *testing.T) {
+	must := must.New(t)
+	buf := &bytes.Buffer{}
+	must.Nil(XML.Encode(buf, testItem{"a", 1}))
+	must.True(strings.HasPrefix(buf.String(), "<?xml"))
+	must.True(strings.HasSuffix(buf.String(), "<testItem><name>a</name><price>1</price></testItem>"))
+
+	var item testItem
+	must.Nil(XML.Decode(buf, &item))
+	must.Equal(testItem{"a", 1}, item)
+}
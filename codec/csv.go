@@ -0,0 +1,162 @@
+package codec
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/ngamux/ngamux/internal/convert"
+)
+
+// CSV is the Codec of text/csv bodies. It encodes and decodes [][]string
+// as is, and slices of structs, or of pointers to structs, as a header
+// row naming the columns followed by one row per element. Columns are
+// named after the csv tags of the fields, or the field names, and cells
+// are converted as by Request.QueriesParser. Decoding matches columns to
+// fields case-insensitively and ignores unknown columns.
+var CSV Codec = csvCodec{}
+
+type csvCodec struct{}
+
+type csvColumn struct {
+	name   string
+	index  int
+	layout string
+}
+
+func csvColumns(typ reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("csv"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name, i, field.Tag.Get("layout")})
+	}
+	return columns
+}
+
+// csvElem returns the struct type of the elements of the slice type typ.
+func csvElem(typ reflect.Type) (reflect.Type, bool) {
+	if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+		return nil, false
+	}
+	elem := typ.Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	return elem, elem.Kind() == reflect.Struct
+}
+
+func (csvCodec) Encode(w io.Writer, v any) error {
+	writer := csv.NewWriter(w)
+	if records, ok := v.([][]string); ok {
+		return writer.WriteAll(records)
+	}
+
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if !val.IsValid() {
+		return fmt.Errorf("codec: cannot encode %T as CSV", v)
+	}
+	elem, ok := csvElem(val.Type())
+	if !ok {
+		return fmt.Errorf("codec: cannot encode %T as CSV", v)
+	}
+
+	columns := csvColumns(elem)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.name
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+	for i := 0; i < val.Len(); i++ {
+		row := reflect.Indirect(val.Index(i))
+		for j, column := range columns {
+			record[j] = ""
+			if !row.IsValid() {
+				continue
+			}
+			cell, err := convert.FormatValue(row.Field(column.index), column.layout)
+			if err != nil {
+				return fmt.Errorf("codec: row %d, column %q: %w", i+1, column.name, err)
+			}
+			record[j] = cell
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvCodec) Decode(r io.Reader, v any) error {
+	reader := csv.NewReader(r)
+	if records, ok := v.(*[][]string); ok {
+		var err error
+		*records, err = reader.ReadAll()
+		return err
+	}
+
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.IsNil() || val.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("codec: cannot decode CSV into %T", v)
+	}
+	slice := val.Elem()
+	elem, ok := csvElem(slice.Type())
+	if !ok {
+		return fmt.Errorf("codec: cannot decode CSV into %T", v)
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columns := make([]*csvColumn, len(header))
+	fields := csvColumns(elem)
+	for i, name := range header {
+		for j := range fields {
+			if strings.EqualFold(fields[j].name, strings.TrimSpace(name)) {
+				columns[i] = &fields[j]
+				break
+			}
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := reflect.New(elem).Elem()
+		for i, cell := range record {
+			if i >= len(columns) || columns[i] == nil || cell == "" {
+				continue
+			}
+			column := columns[i]
+			if err := convert.SetValues(row.Field(column.index), []string{cell}, column.layout); err != nil {
+				return fmt.Errorf("codec: line %d, column %q: %w", line, column.name, err)
+			}
+		}
+		if slice.Type().Elem().Kind() == reflect.Pointer {
+			row = row.Addr()
+		}
+		slice.Set(reflect.Append(slice, row))
+	}
+}
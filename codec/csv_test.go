@@ -0,0 +1,62 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type csvRow struct {
+	Name  string    `csv:"name"`
+	Price float64   `csv:"price"`
+	Day   time.Time `csv:"day" layout:"2006-01-02"`
+	Note  *string
+	Skip  string `csv:"-"`
+}
+
+func TestCSV(t *testing.T) {
+	must := must.New(t)
+	note := "fresh"
+	rows := []csvRow{
+		{Name: "apple", Price: 1.5, Day: time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), Note: &note},
+		{Name: "pear, green", Price: 2, Day: time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)},
+	}
+
+	buf := &bytes.Buffer{}
+	must.Nil(CSV.Encode(buf, rows))
+	must.Equal("name,price,day,Note\napple,1.5,2024-05-06,fresh\n\"pear, green\",2,2024-05-07,\n", buf.String())
+
+	var decoded []csvRow
+	must.Nil(CSV.Decode(strings.NewReader(buf.String()), &decoded))
+	must.Equal(rows, decoded)
+
+	// Columns are matched by name, in any order and case.
+	var pointers []*csvRow
+	must.Nil(CSV.Decode(strings.NewReader("PRICE,unknown,name\n3,x,plum\n"), &pointers))
+	must.Equal(1, len(pointers))
+	must.Equal(csvRow{Name: "plum", Price: 3}, *pointers[0])
+
+	var records [][]string
+	must.Nil(CSV.Decode(strings.NewReader("a,b\n1,2\n"), &records))
+	must.Equal([][]string{{"a", "b"}, {"1", "2"}}, records)
+
+	buf.Reset()
+	must.Nil(CSV.Encode(buf, records))
+	must.Equal("a,b\n1,2\n", buf.String())
+}
+
+func TestCSVErrors(t *testing.T) {
+	must := must.New(t)
+	var rows []csvRow
+	err := CSV.Decode(strings.NewReader("name,price\napple,1\npear,cheap\n"), &rows)
+	must.NotNil(err)
+	must.True(strings.HasPrefix(err.Error(), `codec: line 3, column "price": `))
+
+	must.NotNil(CSV.Decode(strings.NewReader("a\n"), &[]string{}))
+	must.NotNil(CSV.Encode(&bytes.Buffer{}, "text"))
+	must.NotNil(CSV.Encode(&bytes.Buffer{}, nil))
+	must.NotNil(CSV.Encode(&bytes.Buffer{}, (*[]csvRow)(nil)))
+}
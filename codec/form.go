@@ -0,0 +1,80 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+
+	"github.com/ngamux/ngamux/internal/convert"
+)
+
+// Form is the Codec of application/x-www-form-urlencoded bodies. It
+// encodes and decodes url.Values, map[string][]string, map[string]string
+// and structs whose fields have form tags. Struct fields are converted
+// as by Request.QueriesParser, with nested structs written as
+// address[city].
+var Form Codec = formCodec{}
+
+type formCodec struct{}
+
+func (formCodec) Encode(w io.Writer, v any) error {
+	values := url.Values{}
+	switch v := v.(type) {
+	case url.Values:
+		values = v
+	case map[string][]string:
+		values = v
+	case map[string]string:
+		for key, value := range v {
+			values.Set(key, value)
+		}
+	default:
+		val := reflect.Indirect(reflect.ValueOf(v))
+		if val.Kind() != reflect.Struct {
+			return fmt.Errorf("codec: cannot encode %T as a form", v)
+		}
+		if err := convert.EncodeValues(val, values, "form", ""); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+func (formCodec) Decode(r io.Reader, v any) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string][]string:
+		*v = values
+	case *map[string]string:
+		if *v == nil {
+			*v = make(map[string]string, len(values))
+		}
+		for key := range values {
+			(*v)[key] = values.Get(key)
+		}
+	default:
+		val := reflect.ValueOf(v)
+		if val.Kind() != reflect.Pointer || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("codec: cannot decode a form into %T", v)
+		}
+		var errs []error
+		for _, err := range convert.DecodeValues(val.Elem(), values, "form", "", "") {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
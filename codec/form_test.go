@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+type formAddress struct {
+	City string `form:"city"`
+}
+
+type formSignup struct {
+	Name    string      `form:"name"`
+	Age     int         `form:"age"`
+	Tags    []string    `form:"tag"`
+	Address formAddress `form:"address"`
+}
+
+func TestForm(t *testing.T) {
+	must := must.New(t)
+	buf := &bytes.Buffer{}
+	signup := formSignup{Name: "alice", Age: 30, Tags: []string{"a", "b"}, Address: formAddress{"Jakarta"}}
+	must.Nil(Form.Encode(buf, &signup))
+	must.Equal("address%5Bcity%5D=Jakarta&age=30&name=alice&tag=a&tag=b", buf.String())
+
+	var decoded formSignup
+	must.Nil(Form.Decode(strings.NewReader(buf.String()), &decoded))
+	must.Equal(signup, decoded)
+
+	var values url.Values
+	must.Nil(Form.Decode(strings.NewReader("a=1&a=2"), &values))
+	must.Equal(url.Values{"a": {"1", "2"}}, values)
+
+	var flat map[string]string
+	must.Nil(Form.Decode(strings.NewReader("a=1&a=2&b=3"), &flat))
+	must.Equal(map[string]string{"a": "1", "b": "3"}, flat)
+
+	buf.Reset()
+	must.Nil(Form.Encode(buf, map[string]string{"b": "2", "a": "1"}))
+	must.Equal("a=1&b=2", buf.String())
+}
+
+func TestFormErrors(t *testing.T) {
+	must := must.New(t)
+	var signup formSignup
+	err := Form.Decode(strings.NewReader("age=old"), &signup)
+	must.NotNil(err)
+	must.True(strings.HasPrefix(err.Error(), "age: "))
+
+	must.NotNil(Form.Decode(strings.NewReader("a=1"), signup))
+	must.NotNil(Form.Encode(&bytes.Buffer{}, 42))
+}
@@ -0,0 +1,335 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MessagePack is the Codec of application/msgpack bodies. Struct fields
+// are named after their msgpack tags, and time.Time values use the
+// timestamp extension type, decoded in UTC. Decoding into an empty
+// interface gives nil, bool, int64 or, beyond its range, uint64, float32,
+// float64, string, []byte, time.Time, []any, and map[string]any or, for
+// maps with other keys, map[any]any.
+var MessagePack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	e := &msgpackWriter{}
+	if err := encodeValue(e, reflect.ValueOf(v), "msgpack"); err != nil {
+		return err
+	}
+	_, err := w.Write(e.Bytes())
+	return err
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	d := &msgpackReader{newBinaryReader(r)}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		// An empty stream is io.EOF.
+		return err
+	}
+	g, err := d.read(b)
+	if err != nil {
+		return err
+	}
+	return decodeInto(g, v, "msgpack")
+}
+
+// msgpackTimestamp is the extension type of timestamps.
+const msgpackTimestamp = -1
+
+type msgpackWriter struct {
+	bytes.Buffer
+}
+
+func (e *msgpackWriter) put(b byte, n uint64, size int) {
+	e.WriteByte(b)
+	for i := size - 1; i >= 0; i-- {
+		e.WriteByte(byte(n >> (8 * i)))
+	}
+}
+
+func (e *msgpackWriter) writeNil() {
+	e.WriteByte(0xc0)
+}
+
+func (e *msgpackWriter) writeBool(b bool) {
+	if b {
+		e.WriteByte(0xc3)
+		return
+	}
+	e.WriteByte(0xc2)
+}
+
+func (e *msgpackWriter) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.writeUint(uint64(n))
+	case n >= -32:
+		e.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		e.put(0xd0, uint64(n), 1)
+	case n >= math.MinInt16:
+		e.put(0xd1, uint64(n), 2)
+	case n >= math.MinInt32:
+		e.put(0xd2, uint64(n), 4)
+	default:
+		e.put(0xd3, uint64(n), 8)
+	}
+}
+
+func (e *msgpackWriter) writeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		e.put(0xcc, n, 1)
+	case n <= math.MaxUint16:
+		e.put(0xcd, n, 2)
+	case n <= math.MaxUint32:
+		e.put(0xce, n, 4)
+	default:
+		e.put(0xcf, n, 8)
+	}
+}
+
+func (e *msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		e.put(0xca, uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+	e.put(0xcb, math.Float64bits(f), 8)
+}
+
+func (e *msgpackWriter) writeString(s string) {
+	n := uint64(len(s))
+	switch {
+	case n <= 31:
+		e.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.put(0xd9, n, 1)
+	case n <= math.MaxUint16:
+		e.put(0xda, n, 2)
+	default:
+		e.put(0xdb, n, 4)
+	}
+	e.WriteString(s)
+}
+
+func (e *msgpackWriter) writeBytes(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		e.put(0xc4, n, 1)
+	case n <= math.MaxUint16:
+		e.put(0xc5, n, 2)
+	default:
+		e.put(0xc6, n, 4)
+	}
+	e.Write(b)
+}
+
+// writeTime writes t with the smallest timestamp format holding it.
+func (e *msgpackWriter) writeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		e.put(0xd6, 0xff, 1)
+		e.Write(binary.BigEndian.AppendUint32(nil, uint32(sec)))
+	case sec >= 0 && sec < 1<<34:
+		e.put(0xd7, 0xff, 1)
+		e.Write(binary.BigEndian.AppendUint64(nil, nsec<<34|uint64(sec)))
+	default:
+		e.put(0xc7, 12, 1)
+		e.WriteByte(0xff)
+		e.Write(binary.BigEndian.AppendUint32(nil, uint32(nsec)))
+		e.Write(binary.BigEndian.AppendUint64(nil, uint64(sec)))
+	}
+}
+
+func (e *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n <= 15:
+		e.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.put(0xdc, uint64(n), 2)
+	default:
+		e.put(0xdd, uint64(n), 4)
+	}
+}
+
+func (e *msgpackWriter) writeMapHeader(n int) {
+	switch {
+	case n <= 15:
+		e.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.put(0xde, uint64(n), 2)
+	default:
+		e.put(0xdf, uint64(n), 4)
+	}
+}
+
+type msgpackReader struct {
+	*binaryReader
+}
+
+// read reads the value starting with the byte b.
+func (d *msgpackReader) read(b byte) (any, error) {
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.readMap(uint64(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.readArray(uint64(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.readString(uint64(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(n)
+	case 0xca:
+		n, err := d.uint(4)
+		return math.Float32frombits(uint32(n)), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend the size bytes read.
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.readExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.readArray(n)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.readMap(n)
+	}
+	return nil, fmt.Errorf("codec: invalid MessagePack byte 0x%02x", b)
+}
+
+func (d *msgpackReader) next() (any, error) {
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	return d.read(b)
+}
+
+func (d *msgpackReader) readString(n uint64) (any, error) {
+	b, err := d.bytes(n)
+	return string(b), err
+}
+
+func (d *msgpackReader) readArray(n uint64) (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	items := make([]any, 0, capacity(n))
+	for ; n > 0; n-- {
+		item, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *msgpackReader) readMap(n uint64) (any, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	pairs := make([]pair, 0, capacity(n))
+	for ; n > 0; n-- {
+		key, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+	return pairs, nil
+}
+
+// readExt reads an extension value of n bytes. Only timestamps are
+// supported.
+func (d *msgpackReader) readExt(n uint64) (any, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != msgpackTimestamp {
+		return nil, fmt.Errorf("codec: unsupported MessagePack extension type %d", int8(typ))
+	}
+
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		n := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(n&(1<<34-1)), int64(n>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, fmt.Errorf("codec: invalid MessagePack timestamp of %d bytes", len(data))
+}
@@ -0,0 +1,133 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type binaryBase struct {
+	ID int `json:"id"`
+}
+
+type binaryStruct struct {
+	binaryBase
+	Name    string            `msgpack:"n" cbor:"n" json:"name"`
+	Tags    []string          `json:"tags,omitempty"`
+	Scores  map[string]int    `json:"scores"`
+	Ratio   float32           `json:"ratio"`
+	Data    []byte            `json:"data"`
+	When    time.Time         `json:"when"`
+	Next    *binaryStruct     `json:"next,omitempty"`
+	Labels  map[int]string    `json:"labels"`
+	Any     any               `json:"any"`
+	Skipped string            `json:"-"`
+	Nested  map[string][]uint `json:"nested"`
+}
+
+func binaryValue() binaryStruct {
+	return binaryStruct{
+		binaryBase: binaryBase{ID: -7},
+		Name:       "alice",
+		Scores:     map[string]int{"a": 1, "b": -300},
+		Ratio:      0.5,
+		Data:       []byte{1, 2, 3},
+		When:       time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC),
+		Next:       &binaryStruct{Name: "bob", When: time.Unix(1700000000, 0).UTC()},
+		Labels:     map[int]string{2: "two", 1: "one"},
+		Any:        []any{"x", int64(1), true, nil, map[string]any{"k": 1.5}},
+		Nested:     map[string][]uint{"n": {math.MaxUint32 + 1}},
+	}
+}
+
+func hexBytes(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestMessagePackEncode(t *testing.T) {
+	must := must.New(t)
+	for _, tc := range []struct {
+		value any
+		want  string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{127, "7f"},
+		{-32, "e0"},
+		{-33, "d0 df"},
+		{200, "cc c8"},
+		{-200, "d1 ff 38"},
+		{70000, "ce 00 01 11 70"},
+		{uint64(math.MaxUint64), "cf ff ff ff ff ff ff ff ff"},
+		{float32(1.5), "ca 3f c0 00 00"},
+		{1.5, "cb 3f f8 00 00 00 00 00 00"},
+		{"abc", "a3 61 62 63"},
+		{[]byte{1}, "c4 01 01"},
+		{[]int{1, 2}, "92 01 02"},
+		{map[string]int{"b": 2, "a": 1}, "82 a1 61 01 a1 62 02"},
+		{time.Unix(1, 0), "d6 ff 00 00 00 01"},
+		{time.Unix(1, 1), "d7 ff 00 00 00 04 00 00 00 01"},
+		{time.Unix(-1, 0), "c7 0c ff 00 00 00 00 ff ff ff ff ff ff ff ff"},
+	} {
+		buf := &bytes.Buffer{}
+		must.Nil(MessagePack.Encode(buf, tc.value))
+		must.Equal(hex.EncodeToString(hexBytes(tc.want)), hex.EncodeToString(buf.Bytes()))
+	}
+}
+
+func TestMessagePackRoundTrip(t *testing.T) {
+	must := must.New(t)
+	in := binaryValue()
+	in.Skipped = "ignored"
+	buf := &bytes.Buffer{}
+	must.Nil(MessagePack.Encode(buf, in))
+
+	var out binaryStruct
+	must.Nil(MessagePack.Decode(buf, &out))
+	in.Skipped = ""
+	must.Equal(in, out)
+
+	// Field names come from the msgpack tag, then the json tag.
+	buf.Reset()
+	must.Nil(MessagePack.Encode(buf, in))
+	var generic map[string]any
+	must.Nil(MessagePack.Decode(buf, &generic))
+	must.Equal("alice", generic["n"])
+	must.Equal(int64(-7), generic["id"])
+	_, hasTags := generic["tags"]
+	must.False(hasTags)
+	must.Equal(map[any]any{int64(1): "one", int64(2): "two"}, generic["labels"])
+}
+
+func TestMessagePackDecodeErrors(t *testing.T) {
+	must := must.New(t)
+	var v any
+	must.Equal(io.EOF, MessagePack.Decode(bytes.NewReader(nil), &v))
+	must.Equal(io.ErrUnexpectedEOF, MessagePack.Decode(bytes.NewReader(hexBytes("a3 61")), &v))
+	must.NotNil(MessagePack.Decode(bytes.NewReader(hexBytes("c1")), &v))
+	must.NotNil(MessagePack.Decode(bytes.NewReader(hexBytes("d4 01 00")), &v))
+
+	// Forged lengths fail once the stream ends, without allocating them.
+	must.Equal(io.ErrUnexpectedEOF, MessagePack.Decode(bytes.NewReader(hexBytes("db ff ff ff ff 61")), &v))
+	must.Equal(io.ErrUnexpectedEOF, MessagePack.Decode(bytes.NewReader(hexBytes("dd ff ff ff ff 01")), &v))
+
+	deep := bytes.Repeat([]byte{0x91}, maxDepth+1)
+	must.True(errors.Is(MessagePack.Decode(bytes.NewReader(deep), &v), ErrMaxDepth))
+
+	var n int8
+	must.NotNil(MessagePack.Decode(bytes.NewReader(hexBytes("cc c8")), &n))
+	var s string
+	must.NotNil(MessagePack.Decode(bytes.NewReader(hexBytes("01")), &s))
+	must.NotNil(MessagePack.Decode(bytes.NewReader(hexBytes("01")), s))
+}
@@ -0,0 +1,142 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/codec"
+)
+
+type codecItem struct {
+	Name  string `json:"name" xml:"name" form:"name" csv:"name" validate:"required"`
+	Price int    `json:"price" xml:"price" form:"price" csv:"price"`
+}
+
+func bodyRequest(contentType string, body []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req
+}
+
+func TestRequestDecode(t *testing.T) {
+	must := must.New(t)
+	msgpack := &bytes.Buffer{}
+	must.Nil(codec.MessagePack.Encode(msgpack, codecItem{"cbor", 4}))
+	cbor := &bytes.Buffer{}
+	must.Nil(codec.CBOR.Encode(cbor, codecItem{"cbor", 4}))
+
+	for _, tc := range []struct {
+		contentType string
+		body        string
+		want        codecItem
+	}{
+		{"", `{"name":"json","price":1}`, codecItem{"json", 1}},
+		{"application/vnd.api+json", `{"name":"json","price":1}`, codecItem{"json", 1}},
+		{"application/xml; charset=utf-8", `<item><name>xml</name><price>2</price></item>`, codecItem{"xml", 2}},
+		{"application/x-www-form-urlencoded", `name=form&price=3`, codecItem{"form", 3}},
+		{"application/msgpack", msgpack.String(), codecItem{"cbor", 4}},
+		{"application/cbor", cbor.String(), codecItem{"cbor", 4}},
+	} {
+		var item codecItem
+		must.Nil(Req(bodyRequest(tc.contentType, []byte(tc.body))).Decode(&item))
+		must.Equal(tc.want, item)
+	}
+
+	var items []codecItem
+	must.Nil(Req(bodyRequest("text/csv", []byte("name,price\na,1\nb,2\n"))).Decode(&items))
+	must.Equal([]codecItem{{"a", 1}, {"b", 2}}, items)
+}
+
+func TestRequestDecodeErrors(t *testing.T) {
+	must := must.New(t)
+	var item codecItem
+
+	err := Req(bodyRequest("application/yaml", []byte("name: a"))).Decode(&item)
+	must.True(errors.Is(err, ErrUnsupportedMediaType))
+	must.Equal(http.StatusUnsupportedMediaType, ErrorProblem(err).Status)
+
+	err = Req(bodyRequest("application/xml", []byte("<item>"))).Decode(&item)
+	decodeErr := &DecodeError{}
+	must.True(errors.As(err, &decodeErr))
+	must.Equal("application/xml", decodeErr.MediaType)
+	must.Equal(http.StatusBadRequest, ErrorProblem(err).Status)
+
+	err = Req(bodyRequest("application/cbor", nil)).Decode(&item)
+	must.True(errors.Is(err, ErrEmptyBody))
+
+	err = Req(bodyRequest("application/json", []byte(`{"price":"1"}`))).Decode(&item)
+	jsonErr := &JSONError{}
+	must.True(errors.As(err, &jsonErr))
+	must.Equal("price", jsonErr.Path)
+
+	// Bodies are limited whatever their media type.
+	config := NewConfig()
+	config.MaxDecodeBytes = 8
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "application/json"} {
+		req := withConfig(bodyRequest(contentType, []byte(`{"name":"long enough"}`)), &config)
+		err = Req(req).Decode(&item)
+		must.Equal(http.StatusRequestEntityTooLarge, ErrorProblem(err).Status)
+	}
+
+	// Registries and validators come from the router.
+	router := New(WithCodec("application/x-www-form-urlencoded", nil), WithValidator())
+	router.Post("/", func(rw http.ResponseWriter, r *http.Request) {
+		var item codecItem
+		Res(rw, r).Problem(ErrorProblem(Req(r).Decode(&item)))
+	})
+	for contentType, status := range map[string]int{
+		"application/x-www-form-urlencoded": http.StatusUnsupportedMediaType,
+		"application/xml":                   http.StatusUnprocessableEntity,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, bodyRequest(contentType, []byte("<item></item>")))
+		must.Equal(status, rec.Code)
+	}
+}
+
+func TestResponseEncode(t *testing.T) {
+	must := must.New(t)
+	item := codecItem{"a", 1}
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/json", "{\"name\":\"a\",\"price\":1}\n"},
+		{"*/*", "application/json", "{\"name\":\"a\",\"price\":1}\n"},
+		{"application/problem+json", "application/problem+json", "{\"name\":\"a\",\"price\":1}\n"},
+		{"text/html, application/xml;q=0.9, */*;q=0.1", "application/xml", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<codecItem><name>a</name><price>1</price></codecItem>"},
+		{"application/json;q=0.5, application/x-www-form-urlencoded", "application/x-www-form-urlencoded", "name=a&price=1"},
+		{"text/*", "text/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<codecItem><name>a</name><price>1</price></codecItem>"},
+		{"application/cbor;q=0, application/msgpack", "application/msgpack", "\x82\xa4name\xa1a\xa5price\x01"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+		Res(rec, req).Encode(item)
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal(tc.contentType, rec.Header().Get("Content-Type"))
+		must.Equal("Accept", rec.Header().Get("Vary"))
+		must.Equal(tc.body, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "image/png, application/cbor;q=0")
+	rec := httptest.NewRecorder()
+	Res(rec, req).Encode(item)
+	must.Equal(http.StatusNotAcceptable, rec.Code)
+	must.True(strings.Contains(rec.Body.String(), `"acceptable":["application/json",`))
+
+	// Responses take part in ETag handling.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	Res(rec, req).ETag(req).Encode(item)
+	must.NotEqual("", rec.Header().Get("ETag"))
+}
@@ -0,0 +1,379 @@
+// Package compress provides a response compression middleware for
+// ngamux. It negotiates the content coding from the Accept-Encoding
+// request header (honouring q-values), compresses only responses that
+// are large enough and of a configured content type, and keeps
+// http.Flusher working so streaming handlers still deliver data as it
+// is produced.
+//
+// gzip and deflate are supported out of the box. Other codings can be
+// plugged in by appending an Encoding to Config.Encodings.
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ngamux/ngamux"
+)
+
+// Encoder is a streaming compressor. Both *gzip.Writer and
+// *flate.Writer satisfy it. Reset is used to reuse pooled encoders for
+// a new destination writer.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Encoding describes a content coding that can be negotiated through
+// Accept-Encoding. Name is the coding token (for example "gzip") and
+// New constructs a fresh encoder writing to w at the given level.
+type Encoding struct {
+	Name string
+	New  func(w io.Writer, level int) (Encoder, error)
+}
+
+// Gzip is the gzip content coding backed by compress/gzip.
+var Gzip = Encoding{
+	Name: "gzip",
+	New: func(w io.Writer, level int) (Encoder, error) {
+		return gzip.NewWriterLevel(w, level)
+	},
+}
+
+// Deflate is the deflate content coding backed by compress/flate.
+var Deflate = Encoding{
+	Name: "deflate",
+	New: func(w io.Writer, level int) (Encoder, error) {
+		return flate.NewWriter(w, level)
+	},
+}
+
+// Config configures the compression middleware.
+type Config struct {
+	// Level is the compression level passed to every encoder. Zero,
+	// which would be gzip.NoCompression, means gzip.DefaultCompression.
+	Level int
+	// MinLength is the smallest response body, in bytes, that will be
+	// compressed. Smaller bodies are sent as is.
+	MinLength int
+	// ContentTypes lists the media types eligible for compression. An
+	// entry ending with "/*" matches every subtype, e.g. "text/*". Empty
+	// means the defaults of NewConfig.
+	ContentTypes []string
+	// Encodings lists supported codings in server preference order.
+	// The order breaks ties between codings with equal q-values. Empty
+	// means gzip and deflate.
+	Encodings []Encoding
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		Level:     gzip.DefaultCompression,
+		MinLength: 1024,
+		ContentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"application/problem+json",
+			"image/svg+xml",
+		},
+		Encodings: []Encoding{Gzip, Deflate},
+	}
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig()
+	if c.Level == 0 {
+		c.Level = defaults.Level
+	}
+	if len(c.ContentTypes) == 0 {
+		c.ContentTypes = defaults.ContentTypes
+	}
+	if len(c.Encodings) == 0 {
+		c.Encodings = defaults.Encodings
+	}
+}
+
+// New returns a middleware that compresses responses using the coding
+// negotiated from the request's Accept-Encoding header.
+func New(config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg.setDefaults()
+
+	pools := make(map[string]*sync.Pool, len(cfg.Encodings))
+	names := make([]string, 0, len(cfg.Encodings))
+	for _, e := range cfg.Encodings {
+		names = append(names, e.Name)
+		pools[e.Name] = &sync.Pool{
+			New: func() any {
+				enc, err := e.New(io.Discard, cfg.Level)
+				if err != nil {
+					return nil
+				}
+				return enc
+			},
+		}
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				rw.Header().Add("Vary", "Accept-Encoding")
+				next(rw, r)
+				return
+			}
+
+			name := Negotiate(r.Header.Get("Accept-Encoding"), names)
+			if name == "" {
+				rw.Header().Add("Vary", "Accept-Encoding")
+				next(rw, r)
+				return
+			}
+
+			cw := &responseWriter{
+				ResponseWriter: rw,
+				config:         &cfg,
+				encoding:       name,
+				pool:           pools[name],
+			}
+			defer cw.close()
+			next(cw, r)
+		}
+	}
+}
+
+// Negotiate picks the content coding to use from an Accept-Encoding
+// header value. supported lists the available codings in server
+// preference order. It returns an empty string when the response
+// should be sent without a content coding.
+func Negotiate(header string, supported []string) string {
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseCoding(part)
+		if name == "" {
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range supported {
+		q, ok := qualities[strings.ToLower(name)]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if !ok || q <= bestQ {
+			continue
+		}
+		best, bestQ = name, q
+	}
+
+	if identity, ok := qualities["identity"]; ok && identity > bestQ {
+		return ""
+	}
+
+	return best
+}
+
+func parseCoding(part string) (string, float64) {
+	name, params, _ := strings.Cut(part, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(k)) != "q" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return "", 0
+		}
+		q = parsed
+	}
+	return name, q
+}
+
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if a == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// responseWriter buffers the beginning of a response until it knows
+// whether the body is worth compressing, then either switches to the
+// pooled encoder or flushes the buffer to the underlying writer.
+type responseWriter struct {
+	http.ResponseWriter
+	config   *Config
+	encoding string
+	pool     *sync.Pool
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     Encoder
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.MinLength {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush commits the response and flushes any compressed data. A flush
+// before the size threshold is reached starts compression anyway, as
+// streaming responses are expected to keep growing.
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent ||
+		w.status == http.StatusNotModified || w.status == http.StatusPartialContent {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+		header.Set("Content-Type", contentType)
+	}
+	return contentTypeAllowed(contentType, w.config.ContentTypes)
+}
+
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+
+	eligible := w.compressible()
+	if eligible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if compress && eligible {
+		enc, _ := w.pool.Get().(Encoder)
+		if enc != nil {
+			enc.Reset(w.ResponseWriter)
+			w.encoder = enc
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			header.Del("Accept-Ranges")
+			if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				header.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *responseWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			// nothing was written by the handler
+			return
+		}
+		_ = w.decide(false)
+	}
+
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
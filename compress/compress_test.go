@@ -0,0 +1,164 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestNegotiate(t *testing.T) {
+	supported := []string{"gzip", "deflate"}
+	testCases := []struct {
+		desc     string
+		header   string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"single", "deflate", "deflate"},
+		{"server preference on tie", "deflate, gzip", "gzip"},
+		{"q-values", "gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"q zero excludes", "gzip;q=0, deflate;q=0", ""},
+		{"wildcard", "*", "gzip"},
+		{"wildcard with exclusion", "gzip;q=0, *;q=0.1", "deflate"},
+		{"identity preferred", "identity, gzip;q=0.5", ""},
+		{"unknown", "br", ""},
+		{"invalid q", "gzip;q=abc", ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			must.Equal(t, tC.expected, Negotiate(tC.header, supported))
+		})
+	}
+}
+
+func serve(mw func(http.HandlerFunc) http.HandlerFunc, h http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	mw(h)(rec, req)
+	return rec
+}
+
+func TestNew(t *testing.T) {
+	body := strings.Repeat(`{"message":"hello"}`, 200)
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Length", "3800")
+		_, _ = io.WriteString(rw, body)
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), handler, "gzip")
+
+		must.Equal("gzip", rec.Header().Get("Content-Encoding"))
+		must.Equal("Accept-Encoding", rec.Header().Get("Vary"))
+		must.Equal("", rec.Header().Get("Content-Length"))
+
+		zr, err := gzip.NewReader(rec.Body)
+		must.Nil(err)
+		result, err := io.ReadAll(zr)
+		must.Nil(err)
+		must.Equal(body, string(result))
+	})
+
+	t.Run("partial config", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(Config{MinLength: 10}), handler, "gzip")
+
+		must.Equal("gzip", rec.Header().Get("Content-Encoding"))
+		must.True(rec.Body.Len() < len(body))
+		zr, err := gzip.NewReader(rec.Body)
+		must.Nil(err)
+		result, err := io.ReadAll(zr)
+		must.Nil(err)
+		must.Equal(body, string(result))
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), handler, "gzip;q=0.1, deflate")
+
+		must.Equal("deflate", rec.Header().Get("Content-Encoding"))
+		result, err := io.ReadAll(flate.NewReader(rec.Body))
+		must.Nil(err)
+		must.Equal(body, string(result))
+	})
+
+	t.Run("not accepted", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), handler, "")
+
+		must.Equal("", rec.Header().Get("Content-Encoding"))
+		must.Equal(body, rec.Body.String())
+	})
+
+	t.Run("below threshold", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(rw, `{}`)
+		}, "gzip")
+
+		must.Equal(http.StatusCreated, rec.Code)
+		must.Equal("", rec.Header().Get("Content-Encoding"))
+		must.Equal("Accept-Encoding", rec.Header().Get("Vary"))
+		must.Equal(`{}`, rec.Body.String())
+	})
+
+	t.Run("content type not allowed", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(rw, body)
+		}, "gzip")
+
+		must.Equal("", rec.Header().Get("Content-Encoding"))
+		must.Equal(body, rec.Body.String())
+	})
+
+	t.Run("flush streams compressed data", func(t *testing.T) {
+		must := must.New(t)
+		rec := serve(New(), func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(rw, "data: 1\n\n")
+			rw.(http.Flusher).Flush()
+			must.True(rec0(rw).Flushed)
+			_, _ = io.WriteString(rw, "data: 2\n\n")
+		}, "gzip")
+
+		must.Equal("gzip", rec.Header().Get("Content-Encoding"))
+		zr, err := gzip.NewReader(rec.Body)
+		must.Nil(err)
+		result, err := io.ReadAll(zr)
+		must.Nil(err)
+		must.Equal("data: 1\n\ndata: 2\n\n", string(result))
+	})
+
+	t.Run("custom encoding", func(t *testing.T) {
+		must := must.New(t)
+		config := NewConfig()
+		config.MinLength = 0
+		config.Encodings = append(config.Encodings, Encoding{
+			Name: "x-test",
+			New: func(w io.Writer, level int) (Encoder, error) {
+				return gzip.NewWriterLevel(w, level)
+			},
+		})
+		rec := serve(New(config), handler, "x-test")
+		must.Equal("x-test", rec.Header().Get("Content-Encoding"))
+	})
+}
+
+func rec0(rw http.ResponseWriter) *httptest.ResponseRecorder {
+	return rw.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder)
+}
@@ -0,0 +1,114 @@
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// Sample describes a completed request.
+type Sample struct {
+	// Latency is the time spent in the handler.
+	Latency time.Duration
+	// Baseline is the long-term average latency of successful requests
+	// before this one, or zero for the first sample.
+	Baseline time.Duration
+	// InFlight is the number of requests in flight, this one included.
+	InFlight int
+	// Failed reports whether the handler answered 503 or 504, a sign
+	// that something downstream is overloaded.
+	Failed bool
+}
+
+// Algorithm adjusts the concurrency limit from observed requests. It is
+// called with the limiter lock held, so it must be fast, and must not
+// keep state since a Config may be shared by several limiters.
+type Algorithm interface {
+	// Update returns the new limit given the current one and a sample.
+	Update(limit float64, sample Sample) float64
+}
+
+// AIMD is an additive-increase/multiplicative-decrease algorithm, as
+// used by TCP congestion control. The limit grows by about one per
+// limit successful requests while it is in use, and is multiplied by
+// Backoff when a request fails or exceeds Threshold.
+type AIMD struct {
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+	// Threshold is the latency above which a request counts as a
+	// failure. Zero only reacts to failed requests.
+	Threshold time.Duration
+	// Backoff is the decrease factor, between 0 and 1. It defaults to 0.9.
+	Backoff float64
+}
+
+// Update implements Algorithm.
+func (a AIMD) Update(limit float64, sample Sample) float64 {
+	backoff := a.Backoff
+	if backoff <= 0 || backoff >= 1 {
+		backoff = 0.9
+	}
+
+	switch {
+	case sample.Failed || (a.Threshold > 0 && sample.Latency > a.Threshold):
+		limit *= backoff
+	case float64(sample.InFlight)*2 >= limit:
+		// Only grow a limit that is actually used, or it would creep up
+		// while traffic is low and offer no protection once it bursts.
+		limit += 1 / limit
+	}
+	return clamp(limit, a.MinLimit, a.MaxLimit)
+}
+
+// Gradient adjusts the limit with the ratio between the long-term
+// baseline latency and the latency of each request: when requests get
+// slower than usual, queues are building up downstream and the limit
+// shrinks proportionally; otherwise it grows by a margin of the square
+// root of the limit.
+type Gradient struct {
+	// MinLimit and MaxLimit bound the limit. They default to 1 and 1000.
+	MinLimit int
+	MaxLimit int
+	// Tolerance is the latency growth over the baseline tolerated before
+	// reducing the limit. It defaults to 1.5.
+	Tolerance float64
+	// Smoothing is the weight of each update, between 0 and 1. It
+	// defaults to 0.2.
+	Smoothing float64
+}
+
+// Update implements Algorithm.
+func (g Gradient) Update(limit float64, sample Sample) float64 {
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+
+	gradient := 1.0
+	switch {
+	case sample.Failed:
+		gradient = 0.5
+	case sample.Baseline > 0 && sample.Latency > 0:
+		gradient = math.Max(0.5, math.Min(1, tolerance*float64(sample.Baseline)/float64(sample.Latency)))
+	}
+
+	target := limit * gradient
+	if gradient == 1 && float64(sample.InFlight)*2 >= limit {
+		target += math.Sqrt(limit)
+	}
+	return clamp(limit*(1-smoothing)+target*smoothing, g.MinLimit, g.MaxLimit)
+}
+
+func clamp(limit float64, minLimit, maxLimit int) float64 {
+	if minLimit <= 0 {
+		minLimit = 1
+	}
+	if maxLimit <= 0 {
+		maxLimit = 1000
+	}
+	return math.Max(float64(minLimit), math.Min(float64(maxLimit), limit))
+}
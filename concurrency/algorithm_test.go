@@ -0,0 +1,37 @@
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestAIMD(t *testing.T) {
+	must := must.New(t)
+	a := AIMD{MinLimit: 2, MaxLimit: 20, Threshold: 100 * time.Millisecond}
+
+	must.Equal(10.1, a.Update(10, Sample{Latency: time.Millisecond, InFlight: 5}))
+	// An idle limit does not grow.
+	must.Equal(10.0, a.Update(10, Sample{Latency: time.Millisecond, InFlight: 1}))
+	must.Equal(9.0, a.Update(10, Sample{Latency: time.Second, InFlight: 5}))
+	must.Equal(9.0, a.Update(10, Sample{Latency: time.Millisecond, Failed: true}))
+	must.Equal(2.0, a.Update(2, Sample{Failed: true}))
+	must.Equal(20.0, a.Update(20, Sample{InFlight: 20}))
+}
+
+func TestGradient(t *testing.T) {
+	must := must.New(t)
+	g := Gradient{}
+
+	// Latency within tolerance of the baseline: grow.
+	must.True(g.Update(100, Sample{Latency: 12 * time.Millisecond, Baseline: 10 * time.Millisecond, InFlight: 80}) > 100)
+	// Latency tripled: shrink.
+	shrunk := g.Update(100, Sample{Latency: 30 * time.Millisecond, Baseline: 10 * time.Millisecond, InFlight: 80})
+	must.True(shrunk < 100)
+	must.True(shrunk >= 90)
+	// Failures halve the target.
+	must.Equal(90.0, g.Update(100, Sample{Failed: true}))
+	// No baseline yet: keep the limit when idle.
+	must.Equal(100.0, g.Update(100, Sample{Latency: time.Second, InFlight: 1}))
+}
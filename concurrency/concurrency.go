@@ -0,0 +1,148 @@
+// Package concurrency provides a middleware that caps the number of
+// requests handled at the same time and sheds the excess, so that a
+// service degrades under bursts instead of falling over.
+//
+// Requests over the limit wait in a bounded FIFO queue for up to
+// QueueTimeout. When the queue is full or the wait times out, the request
+// is answered 503 Service Unavailable with a Retry-After header.
+//
+// A single middleware value limits every route it wraps together: use it
+// with Ngamux.Use for a global limit, or on a group for a per-group
+// limit. Set PerRoute to give each route its own limit instead. With an
+// Algorithm, the limit adapts to the observed latency, protecting slow
+// downstream dependencies without hand-tuning.
+package concurrency
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+// Config configures the concurrency middleware.
+type Config struct {
+	// Limit is the maximum number of requests in flight, or the initial
+	// limit when Algorithm is set.
+	Limit int
+	// QueueSize is the maximum number of requests waiting for a slot.
+	// Zero sheds requests as soon as the limit is reached.
+	QueueSize int
+	// QueueTimeout is the maximum time a request waits in the queue.
+	QueueTimeout time.Duration
+	// RetryAfter is sent in the Retry-After header of shed requests,
+	// rounded up to whole seconds.
+	RetryAfter time.Duration
+
+	// PerRoute gives every route wrapped by the middleware its own
+	// limiter instead of sharing one.
+	PerRoute bool
+	// Algorithm, when set, adjusts the limit from the latency and outcome
+	// of requests. See AIMD and Gradient.
+	Algorithm Algorithm
+
+	// ErrorHandler writes the response for shed requests. err is
+	// ErrQueueFull, ErrQueueTimeout or the error of the request context.
+	// The default replies 503 with a problem response.
+	ErrorHandler func(rw http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		Limit:        100,
+		QueueSize:    100,
+		QueueTimeout: time.Second,
+		RetryAfter:   time.Second,
+	}
+}
+
+// New returns a middleware that limits concurrent requests.
+func New(config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	defaults := NewConfig()
+	if cfg.Limit <= 0 {
+		cfg.Limit = defaults.Limit
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = defaults.QueueTimeout
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = defaults.RetryAfter
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = cfg.shed
+	}
+
+	shared := newLimiter(cfg)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		l := shared
+		if cfg.PerRoute {
+			l = newLimiter(cfg)
+		}
+
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if err := l.acquire(r.Context(), cfg.QueueTimeout); err != nil {
+				cfg.ErrorHandler(rw, r, err)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: rw}
+			start := time.Now()
+			defer func() {
+				failed := sw.status == http.StatusServiceUnavailable || sw.status == http.StatusGatewayTimeout
+				l.release(time.Since(start), failed)
+			}()
+			next(sw, r)
+		}
+	}
+}
+
+// shed is the default ErrorHandler.
+func (c Config) shed(rw http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, ErrQueueFull) && !errors.Is(err, ErrQueueTimeout) {
+		// The client went away while queued; nobody reads the answer.
+		return
+	}
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(c.RetryAfter.Seconds()))))
+	ngamux.Res(rw, r).Problem(ngamux.NewProblem(http.StatusServiceUnavailable, "server overloaded, retry later"))
+}
+
+// statusWriter records the response status for the algorithm.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController and template helpers can reach it.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
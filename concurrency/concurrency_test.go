@@ -0,0 +1,141 @@
+package concurrency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+// blocking returns a handler that blocks until release is closed and
+// signals each entry on started.
+func blocking(started chan<- struct{}, release <-chan struct{}) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+}
+
+func serve(handler http.HandlerFunc) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec
+}
+
+func TestShed(t *testing.T) {
+	must := must.New(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handler := New(Config{Limit: 1, RetryAfter: 1500 * time.Millisecond})(blocking(started, release))
+
+	go serve(handler)
+	<-started
+
+	rec := serve(handler)
+	must.Equal(http.StatusServiceUnavailable, rec.Code)
+	must.Equal("2", rec.Header().Get("Retry-After"))
+	must.Equal("application/problem+json", rec.Header().Get("Content-Type"))
+}
+
+func TestQueue(t *testing.T) {
+	must := must.New(t)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	handler := New(Config{Limit: 1, QueueSize: 1, QueueTimeout: time.Minute})(blocking(started, release))
+
+	wg := sync.WaitGroup{}
+	codes := make(chan int, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve(handler).Code
+		}()
+	}
+	<-started
+	select {
+	case <-started:
+		t.Fatal("limit exceeded")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+	must.Equal(http.StatusOK, <-codes)
+	must.Equal(http.StatusOK, <-codes)
+}
+
+// waitFor polls condition until it holds, failing after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	must := must.New(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handler := New(Config{Limit: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond})(blocking(started, release))
+
+	go serve(handler)
+	<-started
+
+	rec := serve(handler)
+	must.Equal(http.StatusServiceUnavailable, rec.Code)
+	must.Equal("1", rec.Header().Get("Retry-After"))
+}
+
+func TestPerRoute(t *testing.T) {
+	must := must.New(t)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	for _, tc := range []struct {
+		perRoute bool
+		code     int
+	}{
+		{false, http.StatusServiceUnavailable},
+		{true, http.StatusOK},
+	} {
+		mw := New(Config{Limit: 1, PerRoute: tc.perRoute})
+		a := mw(blocking(started, release))
+		b := mw(func(rw http.ResponseWriter, r *http.Request) {})
+
+		go serve(a)
+		<-started
+		must.Equal(tc.code, serve(b).Code)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	must := must.New(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	var got error
+	handler := New(Config{
+		Limit: 1,
+		ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			rw.WriteHeader(http.StatusTooManyRequests)
+		},
+	})(blocking(started, release))
+
+	go serve(handler)
+	<-started
+	must.Equal(http.StatusTooManyRequests, serve(handler).Code)
+	must.Equal(ErrQueueFull, got)
+}
@@ -0,0 +1,124 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is reported when a request arrives while every slot is
+	// taken and the wait queue is full.
+	ErrQueueFull = errors.New("concurrency: queue full")
+	// ErrQueueTimeout is reported when a request waited QueueTimeout
+	// without getting a slot.
+	ErrQueueTimeout = errors.New("concurrency: queue timeout")
+)
+
+// baselineSmoothing is the weight of a new sample in the long-term
+// latency average passed to algorithms as Sample.Baseline.
+const baselineSmoothing = 0.05
+
+// limiter caps in-flight requests and queues the overflow in FIFO order.
+type limiter struct {
+	algorithm Algorithm
+	queueSize int
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+	baseline time.Duration
+}
+
+func newLimiter(config Config) *limiter {
+	return &limiter{
+		algorithm: config.Algorithm,
+		queueSize: config.QueueSize,
+		limit:     float64(config.Limit),
+	}
+}
+
+// capacity is the integral limit, never below one.
+func (l *limiter) capacity() int {
+	return max(1, int(l.limit))
+}
+
+// acquire takes a slot, waiting in the queue up to timeout.
+func (l *limiter) acquire(ctx context.Context, timeout time.Duration) error {
+	l.mu.Lock()
+	if l.inFlight < l.capacity() && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.queueSize {
+		l.mu.Unlock()
+		return ErrQueueFull
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, waiter := range l.waiters {
+		if waiter == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return err
+		}
+	}
+	// The slot was granted while giving up: hand it to the next waiter.
+	l.inFlight--
+	l.grant()
+	return err
+}
+
+// release frees a slot and feeds the algorithm with the request outcome.
+func (l *limiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.algorithm != nil {
+		sample := Sample{
+			Latency:  latency,
+			Baseline: l.baseline,
+			InFlight: l.inFlight,
+			Failed:   failed,
+		}
+		l.limit = l.algorithm.Update(l.limit, sample)
+		if !failed {
+			if l.baseline == 0 {
+				l.baseline = latency
+			} else {
+				l.baseline += time.Duration(baselineSmoothing * float64(latency-l.baseline))
+			}
+		}
+	}
+
+	l.inFlight--
+	l.grant()
+}
+
+// grant hands free slots to waiters. l.mu must be held.
+func (l *limiter) grant() {
+	for len(l.waiters) > 0 && l.inFlight < l.capacity() {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+	}
+}
@@ -0,0 +1,77 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestLimiterFIFO(t *testing.T) {
+	must := must.New(t)
+	l := newLimiter(Config{Limit: 1, QueueSize: 2})
+	must.Nil(l.acquire(context.Background(), time.Second))
+
+	order := make(chan int, 2)
+	for i := range 2 {
+		go func() {
+			if l.acquire(context.Background(), time.Second) == nil {
+				order <- i
+			}
+		}()
+		waitFor(t, func() bool {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return len(l.waiters) == i+1
+		})
+	}
+
+	l.release(time.Millisecond, false)
+	must.Equal(0, <-order)
+	l.release(time.Millisecond, false)
+	must.Equal(1, <-order)
+	l.release(time.Millisecond, false)
+
+	must.Equal(0, l.inFlight)
+}
+
+func TestLimiterCancel(t *testing.T) {
+	must := must.New(t)
+	l := newLimiter(Config{Limit: 1, QueueSize: 1})
+	must.Nil(l.acquire(context.Background(), time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	must.Equal(context.Canceled, l.acquire(ctx, time.Second))
+
+	l.mu.Lock()
+	must.Equal(0, len(l.waiters))
+	must.Equal(1, l.inFlight)
+	l.mu.Unlock()
+}
+
+func TestLimiterAdaptive(t *testing.T) {
+	must := must.New(t)
+	l := newLimiter(Config{Limit: 10, QueueSize: 10, Algorithm: AIMD{Threshold: 50 * time.Millisecond}})
+
+	for range 5 {
+		must.Nil(l.acquire(context.Background(), time.Second))
+	}
+	for range 5 {
+		l.release(time.Second, false)
+	}
+	must.True(l.limit < 10)
+	must.Equal(time.Second, l.baseline)
+	must.Equal(0, l.inFlight)
+
+	// The baseline follows the latency slowly.
+	must.Nil(l.acquire(context.Background(), time.Second))
+	l.release(10*time.Millisecond, false)
+	must.Equal(950500*time.Microsecond, l.baseline)
+
+	// Failed requests do not move it.
+	must.Nil(l.acquire(context.Background(), time.Second))
+	l.release(time.Millisecond, true)
+	must.Equal(950500*time.Microsecond, l.baseline)
+}
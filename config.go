@@ -1,16 +1,63 @@
 package ngamux
 
 import (
-	"encoding/json"
+	"context"
 	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/ngamux/ngamux/codec"
+	"github.com/ngamux/ngamux/json"
+	"github.com/ngamux/ngamux/securecookie"
+	"github.com/ngamux/ngamux/validate"
 )
 
 // Config define ngamux global configuration
 type Config struct {
 	RemoveTrailingSlash bool
 	LogLevel            slog.Level
-	JSONMarshal         func(any) ([]byte, error)
-	JSONUnmarshal       func([]byte, any) error
+
+	// JSON encodes and decodes the JSON of requests and responses served
+	// by the router. See JSONCodec.
+	JSON json.Codec
+	// JSONMarshal and JSONUnmarshal, when set, replace the corresponding
+	// functions of JSON.
+	JSONMarshal   func(any) ([]byte, error)
+	JSONUnmarshal func([]byte, any) error
+
+	// Codecs maps media types to the codecs used by Request.Decode and
+	// Response.Encode. Nil means codec.Default. JSON media types are
+	// always handled by the JSON codec of the router.
+	Codecs *codec.Registry
+	// MaxDecodeBytes limits the size of the bodies read by
+	// Request.Decode and Request.Bind, whatever their media type, since
+	// codecs may buffer them whole. It defaults to 10MB; negative means
+	// no limit.
+	MaxDecodeBytes int64
+
+	// TrustedProxies lists the networks of reverse proxies whose
+	// forwarding header, see ProxyHeader, is believed. Requests from any
+	// other peer are taken at face value.
+	TrustedProxies []netip.Prefix
+	// ProxyHeader names the header the trusted proxies write the client
+	// address into: X-Forwarded-For, the default, Forwarded or X-Real-Ip.
+	// Only that header is read, since clients may send the others. With
+	// Forwarded, the scheme and host come from its proto and host
+	// parameters rather than X-Forwarded-Proto and X-Forwarded-Host.
+	ProxyHeader string
+
+	// CookieKeys holds the secrets used by the signed and encrypted
+	// cookie helpers, newest first. See package securecookie. They are
+	// read once, when the router is built, which panics on keys shorter
+	// than securecookie.MinKeyLength.
+	CookieKeys [][]byte
+
+	// Validator, when set, checks the values decoded by Request.Bind and
+	// Request.JSON against their validate tags. See package validate.
+	Validator *validate.Validator
+
+	// cookies is the codec built from CookieKeys by build.
+	cookies *securecookie.Codec
 }
 
 // NewConfig returns Config with some default values
@@ -18,9 +65,84 @@ func NewConfig() Config {
 	config := Config{
 		RemoveTrailingSlash: true,
 		LogLevel:            slog.LevelError,
-		JSONMarshal:         json.Marshal,
-		JSONUnmarshal:       json.Unmarshal,
+		JSON:                json.Standard,
+		ProxyHeader:         "X-Forwarded-For",
+		MaxDecodeBytes:      10 << 20,
 	}
 
 	return config
 }
+
+// defaultConfig is used by request helpers when a request was not
+// served by an ngamux router.
+var defaultConfig = NewConfig()
+
+// withConfig stores config in the request context under KeyContextConfig.
+func withConfig(r *http.Request, config *Config) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), KeyContextConfig, config))
+}
+
+// configFromRequest returns the router configuration stored in the
+// request context, falling back to the defaults.
+func configFromRequest(r *http.Request) *Config {
+	if config, ok := r.Context().Value(KeyContextConfig).(*Config); ok && config != nil {
+		return config
+	}
+	return &defaultConfig
+}
+
+// JSONCodec returns the JSON codec of the router: JSON, with its
+// functions replaced by JSONMarshal and JSONUnmarshal when they are set,
+// or json.Default when JSON is nil.
+func (c *Config) JSONCodec() json.Codec {
+	codec := c.JSON
+	if codec == nil {
+		codec = json.Default()
+	}
+	if c.JSONMarshal == nil && c.JSONUnmarshal == nil {
+		return codec
+	}
+
+	marshal, unmarshal := c.JSONMarshal, c.JSONUnmarshal
+	if marshal == nil {
+		marshal = codec.Marshal
+	}
+	if unmarshal == nil {
+		unmarshal = codec.Unmarshal
+	}
+	return json.Funcs(marshal, unmarshal)
+}
+
+// codecs returns Codecs, or codec.Default when it is nil.
+func (c *Config) codecs() *codec.Registry {
+	if c.Codecs == nil {
+		return codec.Default()
+	}
+	return c.Codecs
+}
+
+// build prepares the values derived from the configuration once, when a
+// router is built with it. Invalid CookieKeys are programming errors, so
+// it panics on them rather than failing every cookie at request time.
+func (c *Config) build() {
+	if len(c.CookieKeys) == 0 {
+		return
+	}
+	cookies, err := securecookie.New(c.CookieKeys...)
+	if err != nil {
+		panic("ngamux: invalid CookieKeys: " + err.Error())
+	}
+	c.cookies = cookies
+}
+
+// cookieCodec returns the codec of CookieKeys, built by build or, for a
+// configuration no router was built with, on the spot.
+func (c *Config) cookieCodec() (*securecookie.Codec, error) {
+	if len(c.CookieKeys) == 0 {
+		return nil, ErrNoCookieKeys
+	}
+	if c.cookies != nil {
+		return c.cookies, nil
+	}
+	return securecookie.New(c.CookieKeys...)
+}
@@ -1,9 +1,12 @@
 package ngamux
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/json"
 )
 
 func TestBuildConfig(t *testing.T) {
@@ -14,3 +17,49 @@ func TestBuildConfig(t *testing.T) {
 	}
 	must.Equal(expected.RemoveTrailingSlash, result.RemoveTrailingSlash)
 }
+
+func TestJSONCodec(t *testing.T) {
+	must := must.New(t)
+	config := NewConfig()
+	must.Equal(json.Standard, config.JSONCodec())
+
+	config.JSONMarshal = func(any) ([]byte, error) { return []byte(`"marshaled"`), nil }
+	b, err := config.JSONCodec().Marshal(1)
+	must.Nil(err)
+	must.Equal(`"marshaled"`, string(b))
+	var n int
+	must.Nil(config.JSONCodec().Unmarshal([]byte("2"), &n))
+	must.Equal(2, n)
+
+	must.Equal(json.Default(), (&Config{}).JSONCodec())
+}
+
+func TestJSONCodecPerRouter(t *testing.T) {
+	must := must.New(t)
+	upper := New(func(c *Config) {
+		c.JSONMarshal = func(v any) ([]byte, error) { return []byte(`"UPPER"`), nil }
+	})
+	plain := New()
+	mux := NewHttpServeMux(&Config{JSONMarshal: func(v any) ([]byte, error) { return []byte(`"mux"`), nil }})
+	for _, router := range []interface {
+		Get(string, http.HandlerFunc, ...MiddlewareFunc)
+	}{upper, plain, mux} {
+		router.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+			Res(rw, r).JSON("value")
+		})
+	}
+
+	for _, tc := range []struct {
+		handler http.Handler
+		body    string
+	}{{upper, `"UPPER"`}, {plain, `"value"`}, {mux, `"mux"`}} {
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.Equal(tc.body, rec.Body.String())
+	}
+
+	// Without the request, the package-level codec is used.
+	rec := httptest.NewRecorder()
+	Res(rec).JSON("value")
+	must.Equal(`"value"`, rec.Body.String())
+}
@@ -0,0 +1,129 @@
+package ngamux
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrNoCookieKeys is returned by the signed and encrypted cookie helpers
+// when Config.CookieKeys is empty.
+var ErrNoCookieKeys = errors.New("ngamux: no cookie keys configured")
+
+// CookieError reports a cookie that could not be read back with
+// integrity. Err is http.ErrNoCookie, ErrNoCookieKeys or one of the
+// securecookie errors, such as securecookie.ErrInvalidSignature for a
+// tampered value, and can be tested with errors.Is.
+type CookieError struct {
+	Name string
+	Err  error
+}
+
+func (e *CookieError) Error() string {
+	return "cookie " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *CookieError) Unwrap() error {
+	return e.Err
+}
+
+// newCookie returns a cookie with secure defaults: Path "/", HttpOnly,
+// Secure and SameSite=Lax. options run last and may override them.
+func newCookie(name, value string, options ...func(*http.Cookie)) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, option := range options {
+		option(cookie)
+	}
+	return cookie
+}
+
+// Cookie sets a cookie on the response. It defaults to Path "/",
+// HttpOnly, Secure and SameSite=Lax; pass options to adjust the cookie,
+// e.g. func(c *http.Cookie) { c.MaxAge = 3600 }.
+func (r *Response) Cookie(name, value string, options ...func(*http.Cookie)) {
+	http.SetCookie(r, newCookie(name, value, options...))
+}
+
+// ClearCookie asks the client to delete a cookie. Options must set the
+// same Path and Domain as when the cookie was created.
+func (r *Response) ClearCookie(name string, options ...func(*http.Cookie)) {
+	options = append(options, func(c *http.Cookie) {
+		c.Value = ""
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+	})
+	http.SetCookie(r, newCookie(name, "", options...))
+}
+
+// SignedCookie sets a cookie whose value is signed with the router's
+// Config.CookieKeys. The value stays readable by the client but cannot
+// be altered; read it back with Request.SignedCookie.
+func (r *Response) SignedCookie(req *http.Request, name, value string, options ...func(*http.Cookie)) error {
+	codec, err := configFromRequest(req).cookieCodec()
+	if err != nil {
+		return &CookieError{name, err}
+	}
+	r.Cookie(name, codec.Sign(name, value), options...)
+	return nil
+}
+
+// EncryptedCookie sets a cookie whose value is encrypted with the
+// router's Config.CookieKeys, so the client can neither read nor alter
+// it; read it back with Request.EncryptedCookie.
+func (r *Response) EncryptedCookie(req *http.Request, name, value string, options ...func(*http.Cookie)) error {
+	codec, err := configFromRequest(req).cookieCodec()
+	if err != nil {
+		return &CookieError{name, err}
+	}
+	sealed, err := codec.Encrypt(name, value)
+	if err != nil {
+		return &CookieError{name, err}
+	}
+	r.Cookie(name, sealed, options...)
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set with
+// Response.SignedCookie after verifying its signature against every key
+// in Config.CookieKeys. Errors are *CookieError.
+func (r Request) SignedCookie(name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	codec, err := configFromRequest(r.Request).cookieCodec()
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	value, err := codec.Verify(name, cookie.Value)
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	return value, nil
+}
+
+// EncryptedCookie returns the decrypted value of a cookie set with
+// Response.EncryptedCookie, trying every key in Config.CookieKeys.
+// Errors are *CookieError.
+func (r Request) EncryptedCookie(name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	codec, err := configFromRequest(r.Request).cookieCodec()
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	value, err := codec.Decrypt(name, cookie.Value)
+	if err != nil {
+		return "", &CookieError{name, err}
+	}
+	return value, nil
+}
@@ -0,0 +1,157 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/securecookie"
+)
+
+func TestResCookie(t *testing.T) {
+	must := must.New(t)
+	rec := httptest.NewRecorder()
+	Res(rec).Cookie("theme", "dark", func(c *http.Cookie) {
+		c.MaxAge = 60
+		c.HttpOnly = false
+	})
+
+	cookies := rec.Result().Cookies()
+	must.Equal(1, len(cookies))
+	must.Equal("theme", cookies[0].Name)
+	must.Equal("dark", cookies[0].Value)
+	must.Equal("/", cookies[0].Path)
+	must.Equal(60, cookies[0].MaxAge)
+	must.True(cookies[0].Secure)
+	must.False(cookies[0].HttpOnly)
+	must.Equal(http.SameSiteLaxMode, cookies[0].SameSite)
+}
+
+func TestResClearCookie(t *testing.T) {
+	must := must.New(t)
+	rec := httptest.NewRecorder()
+	Res(rec).ClearCookie("theme", func(c *http.Cookie) { c.Path = "/app" })
+
+	cookies := rec.Result().Cookies()
+	must.Equal(1, len(cookies))
+	must.Equal("", cookies[0].Value)
+	must.Equal("/app", cookies[0].Path)
+	must.Equal(-1, cookies[0].MaxAge)
+}
+
+func TestSecureCookies(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	roundTrip := func(keys [][]byte, set func(rw http.ResponseWriter, r *http.Request), get func(r *http.Request)) {
+		mux := New(WithLogLevel(LogLevelQuiet), WithCookieKeys(keys...))
+		mux.Get("/set", set)
+		mux.Get("/get", func(rw http.ResponseWriter, r *http.Request) { get(r) })
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set", nil))
+		req := httptest.NewRequest(http.MethodGet, "/get", nil)
+		for _, cookie := range rec.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		must := must.New(t)
+		roundTrip([][]byte{oldKey}, func(rw http.ResponseWriter, r *http.Request) {
+			must.Nil(Res(rw).SignedCookie(r, "user", "42"))
+		}, func(r *http.Request) {
+			value, err := Req(r).SignedCookie("user")
+			must.Nil(err)
+			must.Equal("42", value)
+		})
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		must := must.New(t)
+		roundTrip([][]byte{oldKey}, func(rw http.ResponseWriter, r *http.Request) {
+			must.Nil(Res(rw).EncryptedCookie(r, "cart", "3 items"))
+		}, func(r *http.Request) {
+			value, err := Req(r).EncryptedCookie("cart")
+			must.Nil(err)
+			must.Equal("3 items", value)
+		})
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		must := must.New(t)
+		codec, _ := securecookie.New(oldKey)
+		mux := New(WithLogLevel(LogLevelQuiet), WithCookieKeys(newKey, oldKey))
+		mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+			value, err := Req(r).SignedCookie("user")
+			must.Nil(err)
+			must.Equal("42", value)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "user", Value: codec.Sign("user", "42")})
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		must := must.New(t)
+		mux := New(WithLogLevel(LogLevelQuiet), WithCookieKeys(oldKey))
+		mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+			_, err := Req(r).SignedCookie("user")
+			var cookieErr *CookieError
+			must.True(errors.As(err, &cookieErr))
+			must.Equal("user", cookieErr.Name)
+			must.True(errors.Is(err, securecookie.ErrMalformed))
+
+			_, err = Req(r).EncryptedCookie("user")
+			must.True(errors.Is(err, securecookie.ErrMalformed))
+
+			_, err = Req(r).SignedCookie("missing")
+			must.True(errors.Is(err, http.ErrNoCookie))
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "user", Value: "admin"})
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("codec built once", func(t *testing.T) {
+		must := must.New(t)
+		config := NewConfig()
+		config.CookieKeys = [][]byte{newKey}
+		for _, router := range []interface {
+			http.Handler
+			Get(string, http.HandlerFunc, ...MiddlewareFunc)
+		}{New(WithCookieKeys(newKey)), NewHttpServeMux(&config)} {
+			var codecs []*securecookie.Codec
+			router.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+				codec, err := configFromRequest(r).cookieCodec()
+				must.Nil(err)
+				codecs = append(codecs, codec)
+			})
+			for range 2 {
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+			must.Equal(2, len(codecs))
+			must.NotNil(codecs[0])
+			must.True(codecs[0] == codecs[1])
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		must := must.New(t)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "user", Value: "x"})
+
+		err := Res(httptest.NewRecorder()).SignedCookie(req, "user", "42")
+		must.True(errors.Is(err, ErrNoCookieKeys))
+		err = Res(httptest.NewRecorder()).EncryptedCookie(req, "user", "42")
+		must.True(errors.Is(err, ErrNoCookieKeys))
+		_, err = Req(req).SignedCookie("user")
+		must.True(errors.Is(err, ErrNoCookieKeys))
+		_, err = Req(req).EncryptedCookie("user")
+		must.True(errors.Is(err, ErrNoCookieKeys))
+	})
+}
@@ -0,0 +1,291 @@
+// Package csrf provides a cross-site request forgery protection
+// middleware for ngamux. Two complementary defenses are offered and
+// enabled by default:
+//
+//   - Synchronizer token: a random secret is kept in a cookie and every
+//     unsafe request must echo it back, masked, in a form field or request
+//     header. The masked token is exposed through
+//     ngamux.Req(r).CSRFToken() and, for templates rendered with
+//     ngamux.Response.HTML, as {{csrfToken}} and {{csrfField}}.
+//   - Fetch metadata and origin checking: unsafe requests whose
+//     Sec-Fetch-Site, Origin or Referer header shows they come from
+//     another site are rejected unless the origin is trusted.
+//
+// Safe methods (GET, HEAD, OPTIONS and TRACE) are never rejected.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ngamux/ngamux"
+)
+
+const tokenLength = 32
+
+var (
+	// ErrTokenMissing is reported when an unsafe request carries no token.
+	ErrTokenMissing = errors.New("csrf: token missing")
+	// ErrTokenInvalid is reported when the token does not match the cookie.
+	ErrTokenInvalid = errors.New("csrf: token invalid")
+	// ErrCrossSite is reported when Sec-Fetch-Site marks the request as
+	// coming from another site.
+	ErrCrossSite = errors.New("csrf: cross-site request")
+	// ErrOriginMismatch is reported when the Origin or Referer header
+	// names an origin that is neither the application nor trusted.
+	ErrOriginMismatch = errors.New("csrf: origin mismatch")
+)
+
+// Config configures the csrf middleware.
+type Config struct {
+	// Token enables the synchronizer token check.
+	Token bool
+	// FetchMetadata enables the Sec-Fetch-Site, Origin and Referer check.
+	FetchMetadata bool
+
+	// TrustedOrigins lists additional origins, such as
+	// "https://admin.example.com", allowed to send unsafe requests.
+	TrustedOrigins []string
+
+	// CookieName is the name of the cookie holding the token secret.
+	CookieName string
+	// CookiePath is the path attribute of the cookie.
+	CookiePath string
+	// CookieDomain is the domain attribute of the cookie.
+	CookieDomain string
+	// CookieSecure forces the Secure attribute. It is set anyway when the
+	// client reached the application over HTTPS.
+	CookieSecure bool
+	// CookieSameSite is the SameSite attribute of the cookie.
+	CookieSameSite http.SameSite
+
+	// FieldName is the form field carrying the token.
+	FieldName string
+	// HeaderName is the request header carrying the token. It is checked
+	// before the form field.
+	HeaderName string
+
+	// ErrorHandler writes the response for rejected requests. err is one
+	// of the errors exported by this package. The default replies with
+	// a 403 Forbidden problem response.
+	ErrorHandler func(rw http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		Token:          true,
+		FetchMetadata:  true,
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieSameSite: http.SameSiteLaxMode,
+		FieldName:      "csrf_token",
+		HeaderName:     "X-CSRF-Token",
+		ErrorHandler:   defaultErrorHandler,
+	}
+}
+
+func defaultErrorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	ngamux.Res(rw, r).Problem(ngamux.NewProblem(http.StatusForbidden, err.Error()))
+}
+
+// New returns a middleware that rejects cross-site unsafe requests.
+func New(config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = defaultErrorHandler
+	}
+
+	trusted := make(map[string]bool, len(cfg.TrustedOrigins))
+	for _, origin := range cfg.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			var secret []byte
+			fresh := false
+			if cfg.Token {
+				secret, fresh = cfg.secret(r)
+				if fresh {
+					cfg.setCookie(rw, r, secret)
+				}
+
+				token := mask(secret)
+				r = r.WithContext(context.WithValue(r.Context(), ngamux.KeyContextCSRFToken, token))
+				rw = &tokenWriter{rw, token, cfg.FieldName}
+			}
+
+			if !isSafeMethod(r.Method) {
+				if err := cfg.checkOrigin(r, trusted); err != nil {
+					cfg.ErrorHandler(rw, r, err)
+					return
+				}
+				if cfg.Token {
+					if err := cfg.checkToken(r, secret, fresh); err != nil {
+						cfg.ErrorHandler(rw, r, err)
+						return
+					}
+				}
+			}
+
+			next(rw, r)
+		}
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// secret returns the token secret from the request cookie, or a new one
+// when the cookie is missing or malformed. fresh reports the latter.
+func (c Config) secret(r *http.Request) (secret []byte, fresh bool) {
+	if cookie, err := r.Cookie(c.CookieName); err == nil {
+		if b, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(b) == tokenLength {
+			return b, false
+		}
+	}
+
+	secret = make([]byte, tokenLength)
+	_, _ = rand.Read(secret)
+	return secret, true
+}
+
+func (c Config) setCookie(rw http.ResponseWriter, r *http.Request, secret []byte) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     c.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Path:     c.CookiePath,
+		Domain:   c.CookieDomain,
+		Secure:   c.CookieSecure || ngamux.Req(r).Scheme() == "https",
+		HttpOnly: true,
+		SameSite: c.CookieSameSite,
+	})
+}
+
+func (c Config) checkToken(r *http.Request, secret []byte, fresh bool) error {
+	provided := r.Header.Get(c.HeaderName)
+	if provided == "" {
+		provided = r.PostFormValue(c.FieldName)
+	}
+	if provided == "" || fresh {
+		return ErrTokenMissing
+	}
+
+	unmasked := unmask(provided)
+	if unmasked == nil || subtle.ConstantTimeCompare(unmasked, secret) != 1 {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+// checkOrigin applies the fetch metadata and origin checks. Requests
+// carrying none of Sec-Fetch-Site, Origin and Referer are not browser
+// requests and are let through.
+func (c Config) checkOrigin(r *http.Request, trusted map[string]bool) error {
+	if !c.FetchMetadata {
+		return nil
+	}
+
+	origin := strings.ToLower(r.Header.Get("Origin"))
+	if origin != "" && trusted[origin] {
+		return nil
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	case "":
+	default:
+		return ErrCrossSite
+	}
+
+	if origin == "" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil || referer.Host == "" {
+			return nil
+		}
+		origin = strings.ToLower(referer.Scheme + "://" + referer.Host)
+		if trusted[origin] {
+			return nil
+		}
+	}
+
+	if origin != strings.ToLower(ngamux.Req(r).BaseURL().String()) {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+// mask returns a per-request encoding of secret, a random one-time pad
+// followed by the secret XORed with it, so the value sent in responses
+// changes every time and does not leak the secret to compression-based
+// attacks such as BREACH.
+func mask(secret []byte) string {
+	b := make([]byte, 2*len(secret))
+	pad := b[:len(secret)]
+	_, _ = rand.Read(pad)
+	for i := range secret {
+		b[len(secret)+i] = pad[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func unmask(token string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 2*tokenLength {
+		return nil
+	}
+	secret := make([]byte, tokenLength)
+	for i := range secret {
+		secret[i] = b[i] ^ b[tokenLength+i]
+	}
+	return secret
+}
+
+// tokenWriter exposes the masked token to templates rendered with
+// ngamux.Response.HTML.
+type tokenWriter struct {
+	http.ResponseWriter
+	token     string
+	fieldName string
+}
+
+// TemplateFuncs implements ngamux.TemplateFuncProvider.
+func (w *tokenWriter) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return w.token },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(w.fieldName) +
+				`" value="` + template.HTMLEscapeString(w.token) + `">`)
+		},
+	}
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *tokenWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *tokenWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package csrf
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+)
+
+func TestMask(t *testing.T) {
+	must := must.New(t)
+	secret := []byte(strings.Repeat("s", tokenLength))
+
+	a, b := mask(secret), mask(secret)
+	must.NotEqual(a, b)
+	must.Equal(secret, unmask(a))
+	must.Equal(secret, unmask(b))
+	must.Nil(unmask("short"))
+	must.Nil(unmask("!!!"))
+}
+
+// issue performs a safe request and returns the cookie and masked token.
+func issue(t *testing.T, mw ngamux.MiddlewareFunc) (*http.Cookie, string) {
+	var token string
+	rec := httptest.NewRecorder()
+	mw(func(rw http.ResponseWriter, r *http.Request) {
+		token = ngamux.Req(r).CSRFToken()
+	})(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	cookies := rec.Result().Cookies()
+	must.Equal(t, 1, len(cookies))
+	must.NotEqual(t, "", token)
+	return cookies[0], token
+}
+
+func TestNew(t *testing.T) {
+	var reason error
+	config := NewConfig()
+	config.TrustedOrigins = []string{"https://admin.example.com/"}
+	config.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
+		reason = err
+		rw.WriteHeader(http.StatusForbidden)
+	}
+	mw := New(config)
+	ok := func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}
+
+	cookie, token := issue(t, mw)
+	must.True(t, cookie.HttpOnly)
+	must.Equal(t, "_csrf", cookie.Name)
+
+	post := func(header http.Header, form url.Values, withCookie bool) int {
+		reason = nil
+		body := ""
+		if form != nil {
+			body = form.Encode()
+		}
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(body))
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if withCookie {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		mw(ok)(rec, req)
+		return rec.Code
+	}
+
+	t.Run("token in header", func(t *testing.T) {
+		must.Equal(t, http.StatusNoContent, post(http.Header{"X-Csrf-Token": {token}}, nil, true))
+	})
+
+	t.Run("token in form", func(t *testing.T) {
+		must.Equal(t, http.StatusNoContent, post(nil, url.Values{"csrf_token": {token}}, true))
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		must.Equal(t, http.StatusForbidden, post(nil, nil, true))
+		must.True(t, errors.Is(reason, ErrTokenMissing))
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		must.Equal(t, http.StatusForbidden, post(http.Header{"X-Csrf-Token": {token}}, nil, false))
+		must.True(t, errors.Is(reason, ErrTokenMissing))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, other := issue(t, mw)
+		must.Equal(t, http.StatusForbidden, post(http.Header{"X-Csrf-Token": {other}}, nil, true))
+		must.True(t, errors.Is(reason, ErrTokenInvalid))
+	})
+
+	t.Run("cross-site fetch metadata", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Sec-Fetch-Site": {"cross-site"}}
+		must.Equal(t, http.StatusForbidden, post(header, nil, true))
+		must.True(t, errors.Is(reason, ErrCrossSite))
+	})
+
+	t.Run("same-origin fetch metadata", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Sec-Fetch-Site": {"same-origin"}, "Origin": {"https://evil.com"}}
+		must.Equal(t, http.StatusNoContent, post(header, nil, true))
+	})
+
+	t.Run("origin mismatch", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Origin": {"https://evil.com"}}
+		must.Equal(t, http.StatusForbidden, post(header, nil, true))
+		must.True(t, errors.Is(reason, ErrOriginMismatch))
+	})
+
+	t.Run("referer mismatch", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Referer": {"https://evil.com/page"}}
+		must.Equal(t, http.StatusForbidden, post(header, nil, true))
+		must.True(t, errors.Is(reason, ErrOriginMismatch))
+	})
+
+	t.Run("same origin", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Origin": {"http://example.com"}}
+		must.Equal(t, http.StatusNoContent, post(header, nil, true))
+	})
+
+	t.Run("trusted origin", func(t *testing.T) {
+		header := http.Header{"X-Csrf-Token": {token}, "Origin": {"https://admin.example.com"}, "Sec-Fetch-Site": {"same-site"}}
+		must.Equal(t, http.StatusNoContent, post(header, nil, true))
+	})
+}
+
+func TestNewFetchMetadataOnly(t *testing.T) {
+	must := must.New(t)
+	config := NewConfig()
+	config.Token = false
+	mw := New(config)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/", nil)
+	mw(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal(0, len(rec.Result().Cookies()))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "http://example.com/", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	mw(func(rw http.ResponseWriter, r *http.Request) {})(rec, req)
+	must.Equal(http.StatusForbidden, rec.Code)
+	must.Equal("application/problem+json", rec.Header().Get("Content-Type"))
+	must.True(strings.Contains(rec.Body.String(), `"status":403`))
+}
+
+func TestTemplateField(t *testing.T) {
+	must := must.New(t)
+	var token string
+	rec := httptest.NewRecorder()
+	New()(func(rw http.ResponseWriter, r *http.Request) {
+		token = ngamux.Req(r).CSRFToken()
+		ngamux.Res(rw).HTML("./testdata/form.html", nil)
+	})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	must.Equal(`<form><input type="hidden" name="csrf_token" value="`+token+`"></form>`, strings.TrimSpace(rec.Body.String()))
+
+	// Without the middleware the template still renders.
+	rec = httptest.NewRecorder()
+	ngamux.Res(rec).HTML("./testdata/form.html", nil)
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal(`<form><input type="hidden"></form>`, strings.TrimSpace(rec.Body.String()))
+}
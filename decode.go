@@ -0,0 +1,183 @@
+package ngamux
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedMediaType is reported by Request.JSON when
+	// JSONOptions.RequireContentType is set and the request is not JSON.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrTrailingData is reported by Request.JSON when
+	// JSONOptions.DisallowTrailingData is set and the body holds more than
+	// one JSON value.
+	ErrTrailingData = errors.New("unexpected data after the JSON value")
+	// ErrEmptyBody is reported by Request.JSON when decoding with options
+	// and the body is empty.
+	ErrEmptyBody = errors.New("empty body")
+)
+
+// JSONOptions configures how Request.JSON decodes a request body. Given
+// any options, the body is decoded as a stream rather than read whole.
+type JSONOptions struct {
+	// DisallowUnknownFields rejects object keys that do not match a
+	// field of the destination struct.
+	DisallowUnknownFields bool
+	// UseNumber decodes numbers into interface values as json.Number
+	// instead of float64.
+	UseNumber bool
+	// DisallowTrailingData rejects bodies holding anything but
+	// whitespace after the JSON value.
+	DisallowTrailingData bool
+	// RequireContentType rejects requests whose Content-Type is not
+	// application/json or a +json type.
+	RequireContentType bool
+	// MaxBytes limits the size of the body. Zero means no limit.
+	MaxBytes int64
+}
+
+// StrictJSON returns JSONOptions rejecting unknown fields, trailing data
+// and requests that are not JSON.
+func StrictJSON() JSONOptions {
+	return JSONOptions{
+		DisallowUnknownFields: true,
+		DisallowTrailingData:  true,
+		RequireContentType:    true,
+	}
+}
+
+// JSONError describes why a JSON request body was rejected.
+type JSONError struct {
+	// Path locates the offending value, e.g. "items.0.name", when known.
+	Path string
+	// Offset is the byte offset in the body where decoding failed.
+	Offset int64
+	// Err is the underlying error, e.g. a *json.SyntaxError,
+	// ErrTrailingData or ErrUnsupportedMediaType.
+	Err error
+}
+
+func (e *JSONError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid JSON body")
+	if e.Path != "" {
+		b.WriteString(" at ")
+		b.WriteString(e.Path)
+	}
+	if e.Offset > 0 {
+		b.WriteString(" (offset ")
+		b.WriteString(strconv.FormatInt(e.Offset, 10))
+		b.WriteString(")")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status to answer with: 415 for unsupported
+// media types, 413 for bodies over the limit and 400 otherwise.
+func (e *JSONError) Status() int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(e.Err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.As(e.Err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Problem returns a problem with the status of e, its message as detail
+// and, when known, its path and offset as "path" and "offset" members.
+func (e *JSONError) Problem() Problem {
+	problem := NewProblem(e.Status(), e.Error())
+	problem.Extensions = map[string]any{}
+	if e.Path != "" {
+		problem.Extensions["path"] = e.Path
+	}
+	if e.Offset > 0 {
+		problem.Extensions["offset"] = e.Offset
+	}
+	return problem
+}
+
+// decodeJSON streams the JSON body of r into store with the router's
+// JSON codec, following options. DisallowUnknownFields and UseNumber
+// need a codec whose decoders support them, as encoding/json ones do.
+func decodeJSON(r *http.Request, store any, options JSONOptions) error {
+	if options.RequireContentType {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if !isJSONMediaType(mediaType) {
+			return &JSONError{Err: ErrUnsupportedMediaType}
+		}
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	if options.MaxBytes > 0 {
+		body = http.MaxBytesReader(nil, body, options.MaxBytes)
+	}
+
+	decoder := configFromRequest(r).JSONCodec().NewDecoder(body)
+	if d, ok := decoder.(interface{ DisallowUnknownFields() }); ok && options.DisallowUnknownFields {
+		d.DisallowUnknownFields()
+	}
+	if d, ok := decoder.(interface{ UseNumber() }); ok && options.UseNumber {
+		d.UseNumber()
+	}
+	offset := func() int64 {
+		if d, ok := decoder.(interface{ InputOffset() int64 }); ok {
+			return d.InputOffset()
+		}
+		return 0
+	}
+
+	if err := decoder.Decode(store); err != nil {
+		return jsonError(err, offset())
+	}
+	if options.DisallowTrailingData {
+		end := offset()
+		var extra any
+		if err := decoder.Decode(&extra); !errors.Is(err, io.EOF) {
+			return &JSONError{Offset: end, Err: ErrTrailingData}
+		}
+	}
+	return nil
+}
+
+// jsonError wraps an error of encoding/json in a *JSONError.
+func jsonError(err error, offset int64) error {
+	var syntaxErr *stdjson.SyntaxError
+	var typeErr *stdjson.UnmarshalTypeError
+	var invalidErr *stdjson.InvalidUnmarshalError
+	switch {
+	case errors.As(err, &invalidErr):
+		// A programming error, not a bad request.
+		return err
+	case errors.Is(err, io.EOF):
+		return &JSONError{Err: ErrEmptyBody}
+	case errors.As(err, &syntaxErr):
+		return &JSONError{Offset: syntaxErr.Offset, Err: err}
+	case errors.As(err, &typeErr):
+		return &JSONError{Path: typeErr.Field, Offset: typeErr.Offset, Err: err}
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, err := strconv.Unquote(field); err == nil {
+			field = unquoted
+		}
+		return &JSONError{Path: field, Offset: offset, Err: err}
+	}
+	return &JSONError{Offset: offset, Err: err}
+}
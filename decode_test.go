@@ -0,0 +1,108 @@
+package ngamux
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+type decodeItem struct {
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+type decodeOrder struct {
+	Items []decodeItem `json:"items"`
+	Extra any          `json:"extra"`
+}
+
+func jsonRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestJSONOptions(t *testing.T) {
+	must := must.New(t)
+
+	var order decodeOrder
+	must.Nil(Req(jsonRequest(`{"items":[{"name":"a","price":1}],"extra":12345678901234567890}`)).JSON(&order, JSONOptions{UseNumber: true}))
+	must.Equal("a", order.Items[0].Name)
+	must.Equal(stdjson.Number("12345678901234567890"), order.Extra)
+
+	// Lenient by default.
+	must.Nil(Req(jsonRequest(`{"unknown":1}`)).JSON(&order))
+	must.Nil(Req(jsonRequest(`{"unknown":1}`)).JSON(&order, JSONOptions{}))
+}
+
+func TestJSONErrors(t *testing.T) {
+	must := must.New(t)
+	for _, tc := range []struct {
+		name    string
+		body    string
+		options JSONOptions
+		err     error
+		path    string
+		offset  int64
+		status  int
+	}{
+		{"syntax", `{"items":[}`, StrictJSON(), nil, "", 11, http.StatusBadRequest},
+		{"type", `{"items":[{"name":"a","price":"1"}]}`, StrictJSON(), nil, "items.0.price", 33, http.StatusBadRequest},
+		{"unknown field", `{"item":[]}`, StrictJSON(), nil, "item", 0, http.StatusBadRequest},
+		{"trailing data", `{"items":[]} {}`, StrictJSON(), ErrTrailingData, "", 12, http.StatusBadRequest},
+		{"empty", ``, StrictJSON(), ErrEmptyBody, "", 0, http.StatusBadRequest},
+		{"too large", `{"items":[]}`, JSONOptions{MaxBytes: 4}, nil, "", 0, http.StatusRequestEntityTooLarge},
+	} {
+		var order decodeOrder
+		err := Req(jsonRequest(tc.body)).JSON(&order, tc.options)
+		jsonErr := &JSONError{}
+		if !errors.As(err, &jsonErr) {
+			t.Fatalf("%s: got %v", tc.name, err)
+		}
+		if tc.err != nil {
+			must.True(errors.Is(err, tc.err))
+		}
+		must.Equal(tc.path, jsonErr.Path)
+		if tc.offset > 0 {
+			must.Equal(tc.offset, jsonErr.Offset)
+		}
+		must.Equal(tc.status, jsonErr.Status())
+		must.Equal(tc.status, ErrorProblem(err).Status)
+	}
+
+	// Trailing whitespace is fine.
+	var order decodeOrder
+	must.Nil(Req(jsonRequest("{\"items\":[]} \n")).JSON(&order, StrictJSON()))
+
+	// The content type is enforced.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "text/plain")
+	err := Req(req).JSON(&order, StrictJSON())
+	must.True(errors.Is(err, ErrUnsupportedMediaType))
+	problem := ErrorProblem(err)
+	must.Equal(http.StatusUnsupportedMediaType, problem.Status)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/vnd.api+json; charset=utf-8")
+	must.Nil(Req(req).JSON(&order, StrictJSON()))
+
+	// Destinations that are not pointers are programming errors.
+	var invalid *stdjson.InvalidUnmarshalError
+	must.True(errors.As(Req(jsonRequest(`{}`)).JSON(order, StrictJSON()), &invalid))
+	must.True(errors.As(Req(jsonRequest(`{}`)).JSON(order), &invalid))
+}
+
+func TestJSONErrorProblem(t *testing.T) {
+	must := must.New(t)
+	err := &JSONError{Path: "items.price", Offset: 33, Err: errors.New("wrong type")}
+	must.Equal("invalid JSON body at items.price (offset 33): wrong type", err.Error())
+
+	problem := err.Problem()
+	must.Equal(http.StatusBadRequest, problem.Status)
+	must.Equal(map[string]any{"path": "items.price", "offset": int64(33)}, problem.Extensions)
+}
@@ -0,0 +1,100 @@
+package ngamux
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GenerateETag returns an entity tag computed from body. The tag is
+// strong unless weak is true, in which case it is prefixed with W/.
+func GenerateETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// CheckPreconditions evaluates the conditional request headers of r
+// against the current representation, identified by etag and
+// lastModified, following the order defined in RFC 9110 section 13.2.2.
+// Either etag or lastModified may be zero when unknown.
+//
+// It returns http.StatusNotModified or http.StatusPreconditionFailed
+// when the request should be answered with that status instead of the
+// representation, and 0 when the request should proceed.
+func CheckPreconditions(r *http.Request, etag string, lastModified time.Time) int {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" {
+		if !matchETag(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag, false) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && safe && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// matchETag reports whether etag matches any entity tag in the header
+// list. A "*" member matches any existing representation. strong
+// selects the strong comparison function used by If-Match; otherwise
+// the weak comparison used by If-None-Match applies.
+func matchETag(header string, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong {
+			if candidate == etag {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteConditional strips representation headers that must not be sent
+// with a 304 response and writes status, as returned by
+// CheckPreconditions.
+func WriteConditional(rw http.ResponseWriter, status int) {
+	header := rw.Header()
+	if status == http.StatusNotModified {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+	}
+	rw.WriteHeader(status)
+}
@@ -0,0 +1,133 @@
+// Package etag provides a middleware that adds entity tags to buffered
+// GET and HEAD responses and answers conditional requests with 304 Not
+// Modified or 412 Precondition Failed, as described in RFC 9110.
+//
+// The whole response body is buffered to compute the tag. Handlers that
+// stream with http.Flusher bypass the middleware from their first flush.
+package etag
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+// Config configures the etag middleware.
+type Config struct {
+	// Weak makes generated tags weak validators (W/"...").
+	Weak bool
+}
+
+// New returns a middleware that generates an ETag for successful GET
+// and HEAD responses that do not already carry one, and evaluates the
+// If-Match, If-None-Match, If-Modified-Since and If-Unmodified-Since
+// request headers against it. HEAD responses whose body was discarded
+// before reaching the middleware, as on routes registered with
+// Ngamux.Head, are only checked against an ETag set by the handler.
+func New(config ...Config) ngamux.MiddlewareFunc {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next(rw, r)
+				return
+			}
+
+			bw := &bufferedWriter{ResponseWriter: rw}
+			next(bw, r)
+			if bw.streaming {
+				return
+			}
+
+			status := bw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status < 200 || status >= 300 {
+				rw.WriteHeader(status)
+				_, _ = rw.Write(bw.buf.Bytes())
+				return
+			}
+
+			header := rw.Header()
+			etag := header.Get("ETag")
+			if etag == "" && r.Method == http.MethodHead && bw.buf.Len() == 0 {
+				// The body was discarded before reaching us, e.g. by a
+				// route registered with Ngamux.Head: a tag of nothing
+				// would never match the one of GET.
+				rw.WriteHeader(status)
+				return
+			}
+			if etag == "" {
+				etag = ngamux.GenerateETag(bw.buf.Bytes(), cfg.Weak)
+				header.Set("ETag", etag)
+			}
+
+			var lastModified time.Time
+			if lm := header.Get("Last-Modified"); lm != "" {
+				lastModified, _ = http.ParseTime(lm)
+			}
+
+			if code := ngamux.CheckPreconditions(r, etag, lastModified); code != 0 {
+				ngamux.WriteConditional(rw, code)
+				return
+			}
+			rw.WriteHeader(status)
+			_, _ = rw.Write(bw.buf.Bytes())
+		}
+	}
+}
+
+// bufferedWriter holds the status and body written by the handler until
+// the middleware decides what to send.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       bytes.Buffer
+	streaming bool
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush switches the writer to pass-through mode, sending everything
+// buffered so far without an ETag.
+func (w *bufferedWriter) Flush() {
+	if !w.streaming {
+		w.streaming = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *bufferedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
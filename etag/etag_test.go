@@ -0,0 +1,142 @@
+package etag
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+)
+
+func TestNew(t *testing.T) {
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(rw, "hello")
+	}
+
+	t.Run("generates etag", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New()(handler)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal(ngamux.GenerateETag([]byte("hello"), false), rec.Header().Get("ETag"))
+		must.Equal("hello", rec.Body.String())
+	})
+
+	t.Run("weak", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New(Config{Weak: true})(handler)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.Equal(ngamux.GenerateETag([]byte("hello"), true), rec.Header().Get("ETag"))
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", ngamux.GenerateETag([]byte("hello"), false))
+		New()(handler)(rec, req)
+
+		must.Equal(http.StatusNotModified, rec.Code)
+		must.Equal("", rec.Body.String())
+		must.Equal("", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("precondition failed", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-Match", `"nope"`)
+		New()(handler)(rec, req)
+
+		must.Equal(http.StatusPreconditionFailed, rec.Code)
+	})
+
+	t.Run("keeps handler etag", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", `"v1"`)
+		New()(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("ETag", `"v1"`)
+			_, _ = io.WriteString(rw, "hello")
+		})(rec, req)
+
+		must.Equal(http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("error status passes through", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New()(func(rw http.ResponseWriter, r *http.Request) {
+			http.NotFound(rw, r)
+		})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.Equal(http.StatusNotFound, rec.Code)
+		must.Equal("", rec.Header().Get("ETag"))
+	})
+
+	t.Run("unsafe method is skipped", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New()(handler)(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		must.Equal("", rec.Header().Get("ETag"))
+		must.Equal("hello", rec.Body.String())
+	})
+
+	t.Run("flush streams without etag", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New()(func(rw http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(rw, "a")
+			rw.(http.Flusher).Flush()
+			_, _ = io.WriteString(rw, "b")
+		})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.True(rec.Flushed)
+		must.Equal("", rec.Header().Get("ETag"))
+		must.Equal("ab", rec.Body.String())
+	})
+}
+
+func TestHeadRoute(t *testing.T) {
+	must := must.New(t)
+	mux := ngamux.New()
+	mux.Use(New())
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(rw, "hello")
+	})
+	mux.Head("/", func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(rw, "hello")
+	})
+	mux.Head("/tagged", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(rw, "hello")
+	})
+	serve := func(method, target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tag := serve(http.MethodGet, "/", "").Header().Get("ETag")
+	must.Equal(ngamux.GenerateETag([]byte("hello"), false), tag)
+
+	// The head wrapper discards the body, so no tag of it is made up.
+	rec := serve(http.MethodHead, "/", "")
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal("", rec.Header().Get("ETag"))
+	must.Equal(http.StatusOK, serve(http.MethodHead, "/", tag).Code)
+
+	rec = serve(http.MethodHead, "/tagged", `"v1"`)
+	must.Equal(http.StatusNotModified, rec.Code)
+}
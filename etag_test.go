@@ -0,0 +1,65 @@
+package ngamux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestGenerateETag(t *testing.T) {
+	must := must.New(t)
+
+	strong := GenerateETag([]byte("ok"), false)
+	must.True(strings.HasPrefix(strong, `"`))
+	must.True(strings.HasSuffix(strong, `"`))
+	must.Equal(strong, GenerateETag([]byte("ok"), false))
+	must.NotEqual(strong, GenerateETag([]byte("ko"), false))
+
+	weak := GenerateETag([]byte("ok"), true)
+	must.Equal("W/"+strong, weak)
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	etag := `"abc"`
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	testCases := []struct {
+		desc     string
+		method   string
+		header   map[string]string
+		etag     string
+		expected int
+	}{
+		{"no conditions", http.MethodGet, nil, etag, 0},
+		{"if-none-match hit", http.MethodGet, map[string]string{"If-None-Match": `"x", "abc"`}, etag, http.StatusNotModified},
+		{"if-none-match weak hit", http.MethodGet, map[string]string{"If-None-Match": `W/"abc"`}, etag, http.StatusNotModified},
+		{"if-none-match miss", http.MethodGet, map[string]string{"If-None-Match": `"x"`}, etag, 0},
+		{"if-none-match star", http.MethodGet, map[string]string{"If-None-Match": `*`}, etag, http.StatusNotModified},
+		{"if-none-match unsafe", http.MethodPut, map[string]string{"If-None-Match": `"abc"`}, etag, http.StatusPreconditionFailed},
+		{"if-match hit", http.MethodPut, map[string]string{"If-Match": `"abc"`}, etag, 0},
+		{"if-match miss", http.MethodPut, map[string]string{"If-Match": `"x"`}, etag, http.StatusPreconditionFailed},
+		{"if-match weak never matches", http.MethodPut, map[string]string{"If-Match": `W/"abc"`}, `W/"abc"`, http.StatusPreconditionFailed},
+		{"if-match star without representation", http.MethodPut, map[string]string{"If-Match": `*`}, "", http.StatusPreconditionFailed},
+		{"if-modified-since not modified", http.MethodGet, map[string]string{"If-Modified-Since": after}, etag, http.StatusNotModified},
+		{"if-modified-since modified", http.MethodGet, map[string]string{"If-Modified-Since": before}, etag, 0},
+		{"if-modified-since ignored with if-none-match", http.MethodGet, map[string]string{"If-Modified-Since": after, "If-None-Match": `"x"`}, etag, 0},
+		{"if-unmodified-since failed", http.MethodPut, map[string]string{"If-Unmodified-Since": before}, etag, http.StatusPreconditionFailed},
+		{"if-unmodified-since ok", http.MethodPut, map[string]string{"If-Unmodified-Since": after}, etag, 0},
+		{"if-unmodified-since ignored with if-match", http.MethodPut, map[string]string{"If-Unmodified-Since": before, "If-Match": `"abc"`}, etag, 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tC.method, "/", nil)
+			for k, v := range tC.header {
+				req.Header.Set(k, v)
+			}
+			must.Equal(t, tC.expected, CheckPreconditions(req, tC.etag, modified))
+		})
+	}
+}
@@ -0,0 +1,345 @@
+// Package idempotency provides a middleware honoring the Idempotency-Key
+// request header, so that clients can safely retry unsafe requests such
+// as POST without creating duplicates.
+//
+// The first request with a key runs the handler; its response status,
+// headers and body are stored and replayed to later requests with the
+// same key, marked with an Idempotent-Replayed header. While the first
+// request is still being handled, duplicates get 409 Conflict. A key
+// reused for a different request, as told by its fingerprint (method,
+// URL and body by default), gets 422 Unprocessable Content.
+//
+// Keys are scoped to the authenticated principal, if any, so that a
+// client cannot replay the response of another one.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+var (
+	// ErrMissingKey is reported when Required is set and a request has
+	// no key.
+	ErrMissingKey = errors.New("idempotency: missing key")
+	// ErrInvalidKey is reported for keys longer than MaxKeyLength.
+	ErrInvalidKey = errors.New("idempotency: invalid key")
+	// ErrInFlight is reported while the first request with the key is
+	// being handled.
+	ErrInFlight = errors.New("idempotency: request in flight")
+	// ErrFingerprintMismatch is reported when a key is reused for a
+	// different request.
+	ErrFingerprintMismatch = errors.New("idempotency: key reused with a different request")
+	// ErrBodyTooLarge is reported when the request body exceeds
+	// MaxBodySize.
+	ErrBodyTooLarge = errors.New("idempotency: body too large")
+)
+
+// Config configures the idempotency middleware.
+type Config struct {
+	// HeaderName is the request header carrying the key.
+	HeaderName string
+	// Methods lists the methods the middleware applies to.
+	Methods []string
+	// Required rejects requests without a key.
+	Required bool
+	// MaxKeyLength is the maximum key length.
+	MaxKeyLength int
+
+	// TTL is how long completed responses are replayed.
+	TTL time.Duration
+	// LockTimeout bounds how long a key stays reserved by an in-flight
+	// request, in case the process dies before it completes.
+	LockTimeout time.Duration
+
+	// MaxBodySize limits the request body read to compute the
+	// fingerprint.
+	MaxBodySize int64
+	// MaxResponseSize limits the size of stored responses. Larger
+	// responses are sent but not stored, so retries run the handler again.
+	MaxResponseSize int
+	// Fingerprint identifies a request. The default hashes the method,
+	// path, query and body.
+	Fingerprint func(r *http.Request, body []byte) string
+	// Scope namespaces keys. The default is the subject of the
+	// authenticated principal.
+	Scope func(r *http.Request) string
+	// ShouldStore reports whether a response with status is stored. The
+	// default stores everything but 5xx responses, so that retries of
+	// requests that failed on the server run again.
+	ShouldStore func(status int) bool
+
+	// ErrorHandler writes the response for rejected requests and store
+	// failures. The default replies with a problem response: 400 for
+	// missing or invalid keys, 409 for requests in flight, 413 for large
+	// bodies, 422 for fingerprint mismatches and 500 otherwise.
+	ErrorHandler func(rw http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		HeaderName:      "Idempotency-Key",
+		Methods:         []string{http.MethodPost, http.MethodPatch},
+		MaxKeyLength:    255,
+		TTL:             24 * time.Hour,
+		LockTimeout:     time.Minute,
+		MaxBodySize:     1 << 20,
+		MaxResponseSize: 1 << 20,
+		Fingerprint:     fingerprint,
+		Scope:           scope,
+		ShouldStore:     shouldStore,
+		ErrorHandler:    defaultErrorHandler,
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func scope(r *http.Request) string {
+	if principal := ngamux.Req(r).Principal(); principal != nil {
+		return principal.Subject
+	}
+	return ""
+}
+
+func shouldStore(status int) bool {
+	return status < 500
+}
+
+func defaultErrorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrMissingKey), errors.Is(err, ErrInvalidKey):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrInFlight):
+		status = http.StatusConflict
+		rw.Header().Set("Retry-After", "1")
+	case errors.Is(err, ErrBodyTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrFingerprintMismatch):
+		status = http.StatusUnprocessableEntity
+	}
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		detail = ""
+	}
+	ngamux.Res(rw, r).Problem(ngamux.NewProblem(status, detail))
+}
+
+// New returns a middleware that makes requests with an idempotency key
+// safe to retry, keeping responses in store.
+func New(store Store, config ...Config) ngamux.MiddlewareFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg.setDefaults()
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(cfg.Methods, r.Method) {
+				next(rw, r)
+				return
+			}
+
+			key := r.Header.Get(cfg.HeaderName)
+			if key == "" {
+				if cfg.Required {
+					cfg.ErrorHandler(rw, r, ErrMissingKey)
+					return
+				}
+				next(rw, r)
+				return
+			}
+			if len(key) > cfg.MaxKeyLength {
+				cfg.ErrorHandler(rw, r, ErrInvalidKey)
+				return
+			}
+			if s := cfg.Scope(r); s != "" {
+				key = s + "\n" + key
+			}
+
+			body, err := readBody(r, cfg.MaxBodySize)
+			if err != nil {
+				cfg.ErrorHandler(rw, r, err)
+				return
+			}
+			fp := cfg.Fingerprint(r, body)
+
+			now := time.Now()
+			record, reserved, err := store.Reserve(r.Context(), key, fp, now.Add(cfg.LockTimeout))
+			if err != nil {
+				cfg.ErrorHandler(rw, r, err)
+				return
+			}
+			if !reserved {
+				switch {
+				case record.Fingerprint != fp:
+					cfg.ErrorHandler(rw, r, ErrFingerprintMismatch)
+				case !record.Completed:
+					cfg.ErrorHandler(rw, r, ErrInFlight)
+				default:
+					replay(rw, record)
+				}
+				return
+			}
+
+			rec := &recorder{ResponseWriter: rw, limit: cfg.MaxResponseSize}
+			completed := false
+			defer func() {
+				// The response is kept even if the client went away.
+				ctx := context.WithoutCancel(r.Context())
+				status := rec.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if !completed || rec.overflow || !cfg.ShouldStore(status) {
+					// Let retries run the handler again.
+					_ = store.Delete(ctx, key)
+					return
+				}
+				_ = store.Save(ctx, key, Record{
+					Fingerprint: fp,
+					Completed:   true,
+					Status:      status,
+					Header:      rec.header,
+					Body:        rec.body.Bytes(),
+				}, time.Now().Add(cfg.TTL))
+			}()
+
+			next(rec, r)
+			completed = true
+		}
+	}
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig()
+	if c.HeaderName == "" {
+		c.HeaderName = defaults.HeaderName
+	}
+	if len(c.Methods) == 0 {
+		c.Methods = defaults.Methods
+	}
+	if c.MaxKeyLength <= 0 {
+		c.MaxKeyLength = defaults.MaxKeyLength
+	}
+	if c.TTL <= 0 {
+		c.TTL = defaults.TTL
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = defaults.LockTimeout
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaults.MaxBodySize
+	}
+	if c.MaxResponseSize <= 0 {
+		c.MaxResponseSize = defaults.MaxResponseSize
+	}
+	if c.Fingerprint == nil {
+		c.Fingerprint = defaults.Fingerprint
+	}
+	if c.Scope == nil {
+		c.Scope = defaults.Scope
+	}
+	if c.ShouldStore == nil {
+		c.ShouldStore = defaults.ShouldStore
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = defaults.ErrorHandler
+	}
+}
+
+// readBody reads the request body for the fingerprint and restores it
+// for the handler.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func replay(rw http.ResponseWriter, record Record) {
+	header := rw.Header()
+	maps.Copy(header, record.Header)
+	header.Set("Idempotent-Replayed", "true")
+	rw.WriteHeader(record.Status)
+	_, _ = rw.Write(record.Body)
+}
+
+// recorder passes the response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *recorder) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController and template helpers can reach it.
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,164 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/auth"
+)
+
+func request(method, key, body string) *http.Request {
+	req := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return req
+}
+
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	must := must.New(t)
+	created := atomic.Int32{}
+	handler := New(NewMemoryStore())(func(rw http.ResponseWriter, r *http.Request) {
+		n := created.Add(1)
+		rw.Header().Set("Location", "/orders/"+strconv.Itoa(int(n)))
+		rw.WriteHeader(http.StatusCreated)
+		_, _ = rw.Write([]byte("order " + strconv.Itoa(int(n))))
+	})
+
+	first := serve(handler, request(http.MethodPost, "k1", `{"item":1}`))
+	must.Equal(http.StatusCreated, first.Code)
+	must.Equal("", first.Header().Get("Idempotent-Replayed"))
+
+	retry := serve(handler, request(http.MethodPost, "k1", `{"item":1}`))
+	must.Equal(http.StatusCreated, retry.Code)
+	must.Equal("/orders/1", retry.Header().Get("Location"))
+	must.Equal("order 1", retry.Body.String())
+	must.Equal("true", retry.Header().Get("Idempotent-Replayed"))
+	must.Equal(int32(1), created.Load())
+
+	// Another key, or no key, runs the handler.
+	must.Equal("order 2", serve(handler, request(http.MethodPost, "k2", `{"item":1}`)).Body.String())
+	must.Equal("order 3", serve(handler, request(http.MethodPost, "", `{"item":1}`)).Body.String())
+	// Safe methods are left alone.
+	must.Equal("order 4", serve(handler, request(http.MethodGet, "k1", "")).Body.String())
+}
+
+func TestFingerprintMismatch(t *testing.T) {
+	must := must.New(t)
+	handler := New(NewMemoryStore())(func(rw http.ResponseWriter, r *http.Request) {})
+
+	serve(handler, request(http.MethodPost, "k1", `{"item":1}`))
+	rec := serve(handler, request(http.MethodPost, "k1", `{"item":2}`))
+	must.Equal(http.StatusUnprocessableEntity, rec.Code)
+	must.Equal("application/problem+json", rec.Header().Get("Content-Type"))
+
+	rec = serve(handler, request(http.MethodPatch, "k1", `{"item":1}`))
+	must.Equal(http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestInFlight(t *testing.T) {
+	must := must.New(t)
+	var handler http.HandlerFunc
+	var inner *httptest.ResponseRecorder
+	handler = New(NewMemoryStore())(func(rw http.ResponseWriter, r *http.Request) {
+		if inner == nil {
+			inner = serve(handler, request(http.MethodPost, "k1", "a"))
+		}
+	})
+
+	must.Equal(http.StatusOK, serve(handler, request(http.MethodPost, "k1", "a")).Code)
+	must.Equal(http.StatusConflict, inner.Code)
+	must.Equal("1", inner.Header().Get("Retry-After"))
+}
+
+func TestNotStored(t *testing.T) {
+	must := must.New(t)
+	store := NewMemoryStore()
+	calls := 0
+	handler := New(store, Config{MaxResponseSize: 4})(func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Query().Get("case") {
+		case "error":
+			rw.WriteHeader(http.StatusInternalServerError)
+		case "large":
+			_, _ = rw.Write([]byte("too large"))
+		case "panic":
+			panic("boom")
+		}
+	})
+
+	for _, c := range []string{"error", "large", "panic"} {
+		req := request(http.MethodPost, c, "")
+		req.URL.RawQuery = "case=" + c
+		func() {
+			defer func() { _ = recover() }()
+			serve(handler, req)
+		}()
+		must.Equal(0, store.Len())
+	}
+	must.Equal(3, calls)
+
+	// The large response was still sent in full.
+	req := request(http.MethodPost, "large", "")
+	req.URL.RawQuery = "case=large"
+	must.Equal("too large", serve(handler, req).Body.String())
+}
+
+func TestScope(t *testing.T) {
+	must := must.New(t)
+	handler := New(NewMemoryStore())(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write([]byte(subject(r)))
+	})
+
+	as := func(subject string) *http.Request {
+		req := request(http.MethodPost, "k1", "")
+		return req.WithContext(auth.NewContext(req.Context(), &auth.Principal{Subject: subject}))
+	}
+	must.Equal("alice", serve(handler, as("alice")).Body.String())
+	rec := serve(handler, as("bob"))
+	must.Equal("bob", rec.Body.String())
+	must.Equal("", rec.Header().Get("Idempotent-Replayed"))
+}
+
+func subject(r *http.Request) string {
+	return auth.FromContext(r.Context()).Subject
+}
+
+func TestKeyValidation(t *testing.T) {
+	must := must.New(t)
+	var got error
+	handler := New(NewMemoryStore(), Config{
+		Required:    true,
+		MaxBodySize: 4,
+		ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			defaultErrorHandler(rw, r, err)
+		},
+	})(func(rw http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		key, body string
+		status    int
+		err       error
+	}{
+		{"", "", http.StatusBadRequest, ErrMissingKey},
+		{strings.Repeat("k", 256), "", http.StatusBadRequest, ErrInvalidKey},
+		{"k1", "too large", http.StatusRequestEntityTooLarge, ErrBodyTooLarge},
+	} {
+		rec := serve(handler, request(http.MethodPost, tc.key, tc.body))
+		must.Equal(tc.status, rec.Code)
+		must.True(errors.Is(got, tc.err))
+	}
+}
@@ -0,0 +1,106 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record is what a Store keeps for an idempotency key.
+type Record struct {
+	// Fingerprint identifies the request that used the key first.
+	Fingerprint string
+	// Completed is false while the first request is being handled.
+	Completed bool
+	// Status, Header and Body hold the response of the completed request.
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store persists idempotency records. Implementations must make
+// Reserve atomic, so that only one of several concurrent requests with
+// the same key gets to run the handler.
+type Store interface {
+	// Reserve records an in-flight request for key with fingerprint,
+	// held until expiry, and returns true. When key is already known, it
+	// returns the existing record and false instead.
+	Reserve(ctx context.Context, key, fingerprint string, expiry time.Time) (Record, bool, error)
+	// Save replaces the reservation of key with the completed record,
+	// kept until expiry.
+	Save(ctx context.Context, key string, record Record, expiry time.Time) error
+	// Delete removes key, releasing the reservation of a request whose
+	// response is not kept.
+	Delete(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	record Record
+	expiry time.Time
+}
+
+// MemoryStore is a Store keeping records in process memory. Records are
+// lost on restart and are not shared between processes, so retries must
+// reach the same instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]memoryEntry{},
+		now:     time.Now,
+	}
+}
+
+// Reserve implements Store. Expired records are swept at most once a
+// minute while reserving.
+func (m *MemoryStore) Reserve(ctx context.Context, key, fingerprint string, expiry time.Time) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, entry := range m.entries {
+			if !now.Before(entry.expiry) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expiry) {
+		return entry.record, false, nil
+	}
+	m.entries[key] = memoryEntry{Record{Fingerprint: fingerprint}, expiry}
+	return Record{}, true, nil
+}
+
+// Save implements Store.
+func (m *MemoryStore) Save(ctx context.Context, key string, record Record, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryEntry{record, expiry}
+	return nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Len returns the number of records held, including expired ones that
+// were not swept yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestMemoryStore(t *testing.T) {
+	must := must.New(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, reserved, err := store.Reserve(ctx, "k1", "fp", now.Add(time.Minute))
+	must.Nil(err)
+	must.True(reserved)
+
+	record, reserved, err := store.Reserve(ctx, "k1", "other", now.Add(time.Minute))
+	must.Nil(err)
+	must.False(reserved)
+	must.Equal(Record{Fingerprint: "fp"}, record)
+
+	must.Nil(store.Save(ctx, "k1", Record{Fingerprint: "fp", Completed: true, Status: 201}, now.Add(time.Hour)))
+	record, _, _ = store.Reserve(ctx, "k1", "fp", now.Add(time.Minute))
+	must.True(record.Completed)
+	must.Equal(201, record.Status)
+
+	// Expired records can be reserved again, and are swept.
+	now = now.Add(2 * time.Hour)
+	_, reserved, _ = store.Reserve(ctx, "k2", "fp", now.Add(time.Minute))
+	must.True(reserved)
+	must.Equal(1, store.Len())
+	_, reserved, _ = store.Reserve(ctx, "k1", "fp", now.Add(time.Minute))
+	must.True(reserved)
+
+	must.Nil(store.Delete(ctx, "k1"))
+	must.Equal(1, store.Len())
+}
@@ -0,0 +1,269 @@
+// Package convert converts between strings, as found in query strings,
+// forms, headers and CSV files, and Go values, following struct tags.
+package convert
+
+import (
+	"encoding"
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedType is reported for fields of a type that cannot be
+// converted from a string, such as channels.
+var ErrUnsupportedType = errors.New("unsupported field type")
+
+// Error describes a value that could not be set to a struct field.
+type Error struct {
+	// Field is the path of the struct field, e.g. "Address.City".
+	Field string
+	// Key is the name of the value, e.g. "address[city]".
+	Key string
+	Err error
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// DecodeValues fills the fields of the struct val tagged with tag from
+// values. Within a nested struct named prefix, keys are looked up
+// as prefix[key] or prefix.key; fieldPrefix is prepended to the field
+// names reported in errors.
+func DecodeValues(val reflect.Value, values url.Values, tag, prefix, fieldPrefix string) []Error {
+	typ := val.Type()
+	var errs []Error
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "[" + name + "]"
+		}
+		errs = append(errs, DecodeField(val.Field(i), field, values, tag, key, fieldPrefix+field.Name)...)
+	}
+	return errs
+}
+
+// DecodeField fills v, the struct field field, from the values named
+// key. Nested structs are filled from their own keys, or from a single
+// URL-encoded value such as address=city%3DJakarta.
+func DecodeField(v reflect.Value, field reflect.StructField, values url.Values, tag, key, name string) []Error {
+	if isNestedStruct(v.Type()) {
+		if raw, ok := lookupValues(values, key); ok {
+			nested, err := url.ParseQuery(raw[0])
+			if err != nil {
+				return []Error{{Field: name, Key: key, Err: err}}
+			}
+			return DecodeValues(structValue(v), nested, tag, "", name+".")
+		}
+		if v.Kind() == reflect.Struct || hasNestedKeys(values, key) {
+			return DecodeValues(structValue(v), values, tag, key, name+".")
+		}
+		return nil
+	}
+
+	found, ok := lookupValues(values, key)
+	return AssignField(v, field, found, ok, key, name)
+}
+
+// AssignField sets v from values, or from the default tag of field when
+// values were not found and v is still zero.
+func AssignField(v reflect.Value, field reflect.StructField, values []string, found bool, key, name string) []Error {
+	if !found {
+		def, ok := field.Tag.Lookup("default")
+		if !ok || !v.IsZero() {
+			return nil
+		}
+		values = defaultValues(v.Type(), def)
+	}
+	if err := SetValues(v, values, field.Tag.Get("layout")); err != nil {
+		return []Error{{Field: name, Key: key, Err: err}}
+	}
+	return nil
+}
+
+// lookupValues returns the values of key, written either with brackets,
+// e.g. filter[status], or with dots, e.g. filter.status.
+func lookupValues(values url.Values, key string) ([]string, bool) {
+	if found := values[key]; len(found) > 0 {
+		return found, true
+	}
+	if dotted := dottedKey(key); dotted != key {
+		if found := values[dotted]; len(found) > 0 {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// hasNestedKeys reports whether values holds keys nested under key.
+func hasNestedKeys(values url.Values, key string) bool {
+	dotted := dottedKey(key)
+	for k := range values {
+		if strings.HasPrefix(k, key+"[") || strings.HasPrefix(k, dotted+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func dottedKey(key string) string {
+	return strings.NewReplacer("[", ".", "]", "").Replace(key)
+}
+
+// isNestedStruct reports whether typ, or the type it points to, is a
+// struct decoded field by field rather than from a single value.
+func isNestedStruct(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && typ != timeType && !reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
+
+// structValue returns the struct v holds or points to, allocating it.
+func structValue(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Pointer {
+		return v
+	}
+	if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return v.Elem()
+}
+
+// defaultValues splits the default tag def of a field of type typ,
+// comma-separated for slices.
+func defaultValues(typ reflect.Type, def string) []string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if isSliceOfValues(typ) {
+		return strings.Split(def, ",")
+	}
+	return []string{def}
+}
+
+// isSliceOfValues reports whether typ is a slice filled from repeated
+// values, as opposed to []byte or a slice implementing
+// encoding.TextUnmarshaler, which are filled from a single value.
+func isSliceOfValues(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice &&
+		typ.Elem().Kind() != reflect.Uint8 &&
+		!reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
+
+// SetValues sets v from values. Pointers are allocated, slices get one
+// element per value and other types use the first value. layout is the
+// time.Parse layout for time.Time, RFC 3339 by default, or "unix" for
+// seconds since the epoch.
+func SetValues(v reflect.Value, values []string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := SetValues(elem.Elem(), values, layout); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if isSliceOfValues(v.Type()) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := SetValues(slice.Index(i), []string{value}, layout); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	return setValue(v, values[0], layout)
+}
+
+// setValue converts value to the type of v and sets it.
+func setValue(v reflect.Value, value string, layout string) error {
+	switch {
+	case v.Type() == timeType:
+		t, err := parseTime(value, layout)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// []byte, see isSliceOfValues.
+		v.SetBytes([]byte(value))
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+func parseTime(value, layout string) (time.Time, error) {
+	switch layout {
+	case "":
+		return time.Parse(time.RFC3339, value)
+	case "unix":
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(layout, value)
+}
+
+func (e Error) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,127 @@
+package convert
+
+import (
+	"encoding"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// EncodeValues adds the fields of the struct val tagged with tag to
+// values, the reverse of DecodeValues. Nested structs are written as
+// prefix[key], nil pointers and fields with omitempty holding a zero
+// value are skipped.
+func EncodeValues(val reflect.Value, values url.Values, tag, prefix string) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "[" + name + "]"
+		}
+
+		v := val.Field(i)
+		if (v.Kind() == reflect.Pointer && v.IsNil()) || (options == "omitempty" && v.IsZero()) {
+			continue
+		}
+		if isNestedStruct(v.Type()) {
+			if err := EncodeValues(reflect.Indirect(v), values, tag, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		formatted, err := FormatValues(v, field.Tag.Get("layout"))
+		if err != nil {
+			return err
+		}
+		values[key] = append(values[key], formatted...)
+	}
+	return nil
+}
+
+// FormatValues returns the strings v is set from by SetValues: one per
+// element for slices and a single one otherwise. Nil pointers give no
+// string.
+func FormatValues(v reflect.Value, layout string) ([]string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	if isSliceOfValues(v.Type()) {
+		values := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, err := FormatValue(v.Index(i), layout)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	value, err := FormatValue(v, layout)
+	if err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+// FormatValue returns the string v is set from by SetValues.
+func FormatValue(v reflect.Value, layout string) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == timeType:
+		t := v.Interface().(time.Time)
+		switch layout {
+		case "":
+			return t.Format(time.RFC3339), nil
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), nil
+		}
+		return t.Format(layout), nil
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), nil
+	case v.Type().Implements(textMarshalerType):
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	case v.CanAddr() && v.Addr().Type().Implements(textMarshalerType):
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
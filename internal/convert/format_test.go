@@ -0,0 +1,78 @@
+package convert
+
+import (
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type formatAddress struct {
+	City string `form:"city"`
+}
+
+type formatStruct struct {
+	Name    string         `form:"name"`
+	Age     uint8          `form:"age"`
+	Score   float32        `form:"score"`
+	Tags    []string       `form:"tag"`
+	Day     time.Time      `form:"day" layout:"2006-01-02"`
+	Timeout time.Duration  `form:"timeout"`
+	Addr    netip.Addr     `form:"addr"`
+	Note    *string        `form:"note"`
+	Empty   string         `form:"empty,omitempty"`
+	Address formatAddress  `form:"address"`
+	Billing *formatAddress `form:"billing"`
+	Skipped string
+}
+
+func TestEncodeValues(t *testing.T) {
+	must := must.New(t)
+	in := formatStruct{
+		Name:    "alice",
+		Age:     30,
+		Score:   1.5,
+		Tags:    []string{"a", "b"},
+		Day:     time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+		Timeout: time.Minute,
+		Addr:    netip.MustParseAddr("10.0.0.1"),
+		Address: formatAddress{City: "Jakarta"},
+		Skipped: "x",
+	}
+
+	values := url.Values{}
+	must.Nil(EncodeValues(reflect.ValueOf(in), values, "form", ""))
+	must.Equal(url.Values{
+		"name":          {"alice"},
+		"age":           {"30"},
+		"score":         {"1.5"},
+		"tag":           {"a", "b"},
+		"day":           {"2024-05-06"},
+		"timeout":       {"1m0s"},
+		"addr":          {"10.0.0.1"},
+		"address[city]": {"Jakarta"},
+	}, values)
+
+	// What is encoded decodes back.
+	var out formatStruct
+	must.Equal(0, len(DecodeValues(reflect.ValueOf(&out).Elem(), values, "form", "", "")))
+	in.Skipped = ""
+	must.Equal(in, out)
+}
+
+func TestFormatValue(t *testing.T) {
+	must := must.New(t)
+	_, err := FormatValue(reflect.ValueOf(make(chan int)), "")
+	must.Equal(ErrUnsupportedType, err)
+
+	value, err := FormatValue(reflect.ValueOf(time.Unix(1700000000, 0)), "unix")
+	must.Nil(err)
+	must.Equal("1700000000", value)
+
+	values, err := FormatValues(reflect.ValueOf((*int)(nil)), "")
+	must.Nil(err)
+	must.Equal(0, len(values))
+}
@@ -1,46 +1,179 @@
-// Package json provides a small wrapper around Go's encoding/json
-// package to allow the application to override the global marshalling
-// and unmarshalling functions used throughout the Ngamux project.
+// Package json defines the Codec interface through which Ngamux encodes
+// and decodes JSON, so that a consumer can use a different JSON
+// implementation (for example, a faster or custom serializer) without
+// changing callsites across the codebase.
 //
-// It exposes Configure to replace the underlying functions and thin
-// helpers Marshal and Unmarshal that delegate to the configured
-// implementations. This is useful when a consumer wants to use a
-// different JSON implementation (for example, a faster or custom
-// serializer) without changing callsites across the codebase.
+// Each router holds its own Codec in its Config, reachable from request
+// helpers through the request context, so that routers in one process
+// do not interfere with each other. Standard is backed by encoding/json
+// and Funcs adapts a pair of marshal and unmarshal functions.
+//
+// Marshal and Unmarshal delegate to a package-level Codec, Standard
+// unless replaced with the deprecated Configure, for code that has no
+// request at hand.
 package json
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+)
+
+// Encoder writes JSON values to a stream.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder reads JSON values from a stream. Decoders may also implement
+// DisallowUnknownFields(), UseNumber() and InputOffset() int64 like
+// *encoding/json.Decoder, which strict request decoding takes advantage
+// of.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Codec encodes and decodes JSON.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Standard is the Codec backed by encoding/json. Its encoders and
+// decoders are *encoding/json.Encoder and *encoding/json.Decoder.
+var Standard Codec = standard{}
+
+type standard struct{}
+
+func (standard) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (standard) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (standard) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (standard) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// Funcs returns a Codec built on marshal and unmarshal, taking the
+// functions of Standard for nil ones. Its encoders marshal each value
+// and write it followed by a newline, and its decoders read the whole
+// stream before unmarshaling it, so they do not stream.
+func Funcs(marshal func(any) ([]byte, error), unmarshal func([]byte, any) error) Codec {
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	return funcs{marshal, unmarshal}
+}
+
+type funcs struct {
+	marshal   func(any) ([]byte, error)
+	unmarshal func([]byte, any) error
+}
+
+func (c funcs) Marshal(v any) ([]byte, error) {
+	return c.marshal(v)
+}
+
+func (c funcs) Unmarshal(data []byte, v any) error {
+	return c.unmarshal(data, v)
+}
+
+func (c funcs) NewEncoder(w io.Writer) Encoder {
+	return &funcsEncoder{c.marshal, w}
+}
+
+func (c funcs) NewDecoder(r io.Reader) Decoder {
+	return &funcsDecoder{unmarshal: c.unmarshal, r: r}
+}
+
+type funcsEncoder struct {
+	marshal func(any) ([]byte, error)
+	w       io.Writer
+}
+
+func (e *funcsEncoder) Encode(v any) error {
+	b, err := e.marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
 
-// globalMarshaler is the function used by Marshal. It defaults to
-// encoding/json.Marshal but can be replaced with Configure.
-var globalMarshaler = json.Marshal
+type funcsDecoder struct {
+	unmarshal func([]byte, any) error
+	r         io.Reader
+	done      bool
+}
+
+// Decode unmarshals the whole stream on the first call and returns
+// io.EOF afterwards.
+func (d *funcsDecoder) Decode(v any) error {
+	if d.done {
+		return io.EOF
+	}
+	d.done = true
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return io.EOF
+	}
+	return d.unmarshal(data, v)
+}
 
-// globalUnmarshaler is the function used by Unmarshal. It defaults to
-// encoding/json.Unmarshal but can be replaced with Configure.
-var globalUnmarshaler = json.Unmarshal
+// global is the Codec used by Marshal and Unmarshal.
+var global atomic.Value
 
-// Configure replaces the global marshaler and/or unmarshaler used by
-// this package. Pass nil for either parameter to leave that function
+func init() {
+	global.Store(&Standard)
+}
+
+// Default returns the Codec used by Marshal and Unmarshal.
+func Default() Codec {
+	return *global.Load().(*Codec)
+}
+
+// Configure replaces the marshaler and/or unmarshaler used by Marshal
+// and Unmarshal. Pass nil for either parameter to leave that function
 // unchanged. The returned function is a no-op cleanup placeholder to
 // encourage symmetry with other Configure helpers in the codebase.
+//
+// Deprecated: Configure changes the whole process. Set Config.JSON on
+// the router instead.
 func Configure(marshaler func(any) ([]byte, error), unmarshaler func([]byte, any) error) func() {
-	if marshaler != nil {
-		globalMarshaler = marshaler
+	current := Default()
+	if marshaler == nil {
+		marshaler = current.Marshal
 	}
-
-	if unmarshaler != nil {
-		globalUnmarshaler = unmarshaler
+	if unmarshaler == nil {
+		unmarshaler = current.Unmarshal
 	}
 
+	codec := Funcs(marshaler, unmarshaler)
+	global.Store(&codec)
 	return func() {}
 }
 
-// Marshal delegates to the configured global marshaler.
+// Marshal delegates to the package-level Codec.
 func Marshal(v any) ([]byte, error) {
-	return globalMarshaler(v)
+	return Default().Marshal(v)
 }
 
-// Unmarshal delegates to the configured global unmarshaler.
+// Unmarshal delegates to the package-level Codec.
 func Unmarshal(data []byte, v any) error {
-	return globalUnmarshaler(data, v)
+	return Default().Unmarshal(data, v)
 }
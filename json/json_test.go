@@ -1,8 +1,11 @@
 package json
 
 import (
+	"bytes"
 	stdjson "encoding/json"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/golang-must/must"
@@ -28,10 +31,9 @@ func TestMarshalUnmarshal_Default(t *testing.T) {
 
 func TestConfigure_OverrideMarshalUnmarshal(t *testing.T) {
 	m := must.New(t)
-	origMarshal := globalMarshaler
-	origUnmarshal := globalUnmarshaler
+	orig := Default()
 	defer func() {
-		Configure(origMarshal, origUnmarshal)
+		global.Store(&orig)
 	}()
 	mockMarshal := func(v any) ([]byte, error) {
 		return []byte("__mocked__"), nil
@@ -54,3 +56,38 @@ func TestConfigure_OverrideMarshalUnmarshal(t *testing.T) {
 	m.Nil(Unmarshal([]byte("irrelevant"), &p))
 	m.Equal(p, Person{Name: "Injected", Age: 99})
 }
+
+func TestStandard(t *testing.T) {
+	m := must.New(t)
+	var buf bytes.Buffer
+	m.Nil(Standard.NewEncoder(&buf).Encode(Person{Name: "Alice", Age: 30}))
+	m.Equal("{\"name\":\"Alice\",\"age\":30}\n", buf.String())
+
+	var p Person
+	decoder := Standard.NewDecoder(&buf)
+	m.Nil(decoder.Decode(&p))
+	m.Equal(Person{Name: "Alice", Age: 30}, p)
+	_, ok := decoder.(interface{ DisallowUnknownFields() })
+	m.True(ok)
+}
+
+func TestFuncs(t *testing.T) {
+	m := must.New(t)
+	calls := 0
+	codec := Funcs(nil, func(data []byte, v any) error {
+		calls++
+		return stdjson.Unmarshal(data, v)
+	})
+
+	var buf bytes.Buffer
+	m.Nil(codec.NewEncoder(&buf).Encode(Person{Name: "Bob"}))
+	m.Equal("{\"name\":\"Bob\",\"age\":0}\n", buf.String())
+
+	var p Person
+	decoder := codec.NewDecoder(&buf)
+	m.Nil(decoder.Decode(&p))
+	m.Equal("Bob", p.Name)
+	m.True(errors.Is(decoder.Decode(&p), io.EOF))
+	m.True(errors.Is(codec.NewDecoder(strings.NewReader(" ")).Decode(&p), io.EOF))
+	m.Equal(1, calls)
+}
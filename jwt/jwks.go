@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeySet provides verification keys: a []byte secret for the HS
+// algorithms, an *rsa.PublicKey for RS256 or an *ecdsa.PublicKey for
+// ES256.
+type KeySet interface {
+	// Key returns the key for a token signed with alg whose header
+	// carries kid, which may be empty. It returns ErrUnknownKey when
+	// there is none.
+	Key(alg, kid string) (any, error)
+}
+
+// Keys is a static KeySet mapping key IDs to keys. A token without kid
+// is verified with the key stored under "", or with the only key when
+// there is a single one.
+type Keys map[string]any
+
+// Key implements KeySet.
+func (k Keys) Key(alg, kid string) (any, error) {
+	if key, ok := k[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// jwk is a key of a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+type jwkEntry struct {
+	alg string
+	key any
+}
+
+// ParseJWKS parses a JSON Web Key Set and returns its signature keys by
+// kid. RSA, EC (P-256) and symmetric ("oct") keys are supported; keys
+// for encryption and of other types are skipped.
+func ParseJWKS(data []byte) (Keys, error) {
+	entries, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(Keys, len(entries))
+	for kid, entry := range entries {
+		keys[kid] = entry.key
+	}
+	return keys, nil
+}
+
+func parseJWKS(data []byte) (map[string]jwkEntry, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwt: parse jwks: %w", err)
+	}
+
+	entries := make(map[string]jwkEntry, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwt: parse jwks: key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			entries[k.Kid] = jwkEntry{alg: k.Alg, key: key}
+		}
+	}
+	return entries, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid ec key")
+		}
+		// crypto/ecdh rejects points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, nil
+}
+
+// jwksRefresh is the minimum delay between two checks of the JWKS file
+// triggered by unknown key IDs.
+const jwksRefresh = time.Second
+
+// JWKS is a KeySet loaded from a JSON Web Key Set file. When a token
+// names a key ID that is not in the set, the file is reloaded if it
+// changed, so keys can be rotated by publishing the new key in the file
+// before issuing tokens with it.
+type JWKS struct {
+	path string
+
+	mu        sync.RWMutex
+	entries   map[string]jwkEntry
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// LoadJWKS reads the JSON Web Key Set at path.
+func LoadJWKS(path string) (*JWKS, error) {
+	s := &JWKS{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the file again. On error the previous keys are kept.
+func (s *JWKS) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	entries, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// Key implements KeySet. A key whose JWK declares an alg is only used
+// for that algorithm.
+func (s *JWKS) Key(alg, kid string) (any, error) {
+	entry, ok := s.lookup(kid)
+	if !ok && s.changed() {
+		_ = s.Reload()
+		entry, ok = s.lookup(kid)
+	}
+	if !ok || (entry.alg != "" && entry.alg != alg) {
+		return nil, ErrUnknownKey
+	}
+	return entry.key, nil
+}
+
+func (s *JWKS) lookup(kid string) (jwkEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if entry, ok := s.entries[kid]; ok {
+		return entry, true
+	}
+	if kid == "" && len(s.entries) == 1 {
+		for _, entry := range s.entries {
+			return entry, true
+		}
+	}
+	return jwkEntry{}, false
+}
+
+// changed reports whether the file was modified since it was loaded,
+// checking at most once per jwksRefresh so that tokens with made-up key
+// IDs do not hit the disk on every request.
+func (s *JWKS) changed() bool {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastCheck) < jwksRefresh {
+		s.mu.Unlock()
+		return false
+	}
+	s.lastCheck = now
+	modTime := s.modTime
+	s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	return err == nil && !info.ModTime().Equal(modTime)
+}
@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]any {
+	return map[string]any{"kty": "RSA", "kid": kid, "alg": RS256, "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]any {
+	return map[string]any{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]any) {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	must := must.New(t)
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]any{
+		rsaJWK("rsa", &rsaKey.PublicKey),
+		ecJWK("ec", &ecKey.PublicKey),
+		{"kty": "oct", "kid": "hs", "k": b64(secret)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+	}})
+
+	keys, err := ParseJWKS(data)
+	must.Nil(err)
+	must.Equal(3, len(keys))
+	must.True(rsaKey.PublicKey.Equal(keys["rsa"]))
+	must.True(ecKey.PublicKey.Equal(keys["ec"]))
+	must.Equal(secret, keys["hs"])
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	must := must.New(t)
+	bad := ecJWK("ec", &ecKey.PublicKey)
+	bad["y"] = b64(make([]byte, 32))
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]any{bad}})
+	_, err := ParseJWKS(data)
+	must.NotNil(err)
+
+	_, err = ParseJWKS([]byte("{"))
+	must.NotNil(err)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	must := must.New(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("2024", &rsaKey.PublicKey))
+
+	jwks, err := LoadJWKS(path)
+	must.Nil(err)
+	verifier := NewVerifier(testConfig(jwks))
+
+	_, err = verifier.Verify(sign(t, RS256, "2024", rsaKey, claimsAt(time.Hour)))
+	must.Nil(err)
+
+	// The JWK alg binds the key to that algorithm.
+	_, err = jwks.Key(HS256, "2024")
+	must.True(errors.Is(err, ErrUnknownKey))
+
+	// Publish a new key: tokens signed with it are accepted once the
+	// file changed, without restarting.
+	writeJWKS(t, path, rsaJWK("2024", &rsaKey.PublicKey), ecJWK("2025", &ecKey.PublicKey))
+	must.Nil(os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	jwks.lastCheck = time.Time{}
+
+	_, err = verifier.Verify(sign(t, ES256, "2025", ecKey, claimsAt(time.Hour)))
+	must.Nil(err)
+
+	// Unknown key IDs do not reload the file more than once per
+	// jwksRefresh.
+	must.Nil(os.WriteFile(path, []byte("{"), 0o600))
+	must.Nil(os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	_, err = verifier.Verify(sign(t, ES256, "2026", ecKey, claimsAt(time.Hour)))
+	must.True(errors.Is(err, ErrUnknownKey))
+
+	// A broken file keeps the previous keys.
+	jwks.lastCheck = time.Time{}
+	_, err = verifier.Verify(sign(t, ES256, "2025", ecKey, claimsAt(time.Hour)))
+	must.Nil(err)
+	must.NotNil(jwks.Reload())
+}
+
+func TestLoadJWKSMissingFile(t *testing.T) {
+	must := must.New(t)
+	_, err := LoadJWKS(filepath.Join(t.TempDir(), "missing.json"))
+	must.NotNil(err)
+}
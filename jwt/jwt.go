@@ -0,0 +1,153 @@
+// Package jwt verifies JSON Web Tokens (RFC 7519) signed with HS256,
+// HS384, HS512, RS256 or ES256, using only the standard library.
+//
+// New returns a middleware that authenticates bearer tokens. Keys come
+// from a KeySet: a static Keys map, or a JWKS file loaded with LoadJWKS
+// that is reloaded when a token names an unknown key ID, so signing keys
+// can be rotated without a restart. The exp, nbf, iat, iss and aud
+// claims are checked with a configurable clock skew.
+//
+// Claims are decoded with the JSONUnmarshal configured on the ngamux
+// router into the value returned by Config.Claims, readable by handlers
+// with Claims, while the caller is stored as an *auth.Principal like with
+// the other authentication middlewares.
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ngamux/ngamux"
+	"github.com/ngamux/ngamux/auth"
+)
+
+// Config configures the Verifier and the middleware.
+type Config struct {
+	// Keys provides the verification keys. It is required.
+	Keys KeySet
+	// Algorithms lists the accepted algorithms. It defaults to every
+	// supported algorithm; restrict it to the algorithms the issuer
+	// actually uses.
+	Algorithms []string
+
+	// Issuer, when set, must equal the iss claim.
+	Issuer string
+	// Audience, when set, lists accepted audiences; the aud claim must
+	// contain one of them.
+	Audience []string
+	// Required lists registered claims that must be present. NewConfig
+	// requires exp.
+	Required []string
+	// ClockSkew is the tolerance applied to exp, nbf and iat.
+	ClockSkew time.Duration
+
+	// Claims returns a pointer to the value the claims are decoded into,
+	// e.g. func() any { return &MyClaims{} }. By default they are decoded
+	// into a map[string]any.
+	Claims func() any
+	// JSONUnmarshal decodes the header and claims. The middleware
+	// defaults to the JSONUnmarshal of the router configuration, and
+	// Verifier.Verify to encoding/json.
+	JSONUnmarshal func([]byte, any) error
+
+	// Realm is sent in the WWW-Authenticate challenge.
+	Realm string
+	// Query, when set, names a query parameter used as a fallback when
+	// the Authorization header is absent.
+	Query string
+	// ErrorHandler writes the response for rejected requests. The default
+	// replies 401 with a Bearer challenge.
+	ErrorHandler auth.ErrorHandler
+
+	now func() time.Time
+}
+
+// NewConfig returns Config with some default values
+func NewConfig(keys KeySet) Config {
+	return Config{
+		Keys:       keys,
+		Algorithms: []string{HS256, HS384, HS512, RS256, ES256},
+		Required:   []string{"exp"},
+		ClockSkew:  time.Minute,
+	}
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig(c.Keys)
+	if len(c.Algorithms) == 0 {
+		c.Algorithms = defaults.Algorithms
+	}
+	if c.ClockSkew <= 0 {
+		c.ClockSkew = defaults.ClockSkew
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+// New returns a middleware that authenticates requests with a JWT
+// bearer token. The principal subject is the sub claim; its roles come
+// from the roles claim and its scopes from the scope or scp claim. It
+// panics when config.Keys is nil.
+func New(config Config) ngamux.MiddlewareFunc {
+	verifier := NewVerifier(config)
+
+	return ngamux.MiddlewareFunc(auth.Bearer(auth.TokenConfig{
+		Realm:        config.Realm,
+		Query:        config.Query,
+		ErrorHandler: config.ErrorHandler,
+		Validator: func(r *http.Request, raw string) (*auth.Principal, error) {
+			token, err := verifier.verify(raw, verifier.unmarshal(r))
+			if err != nil {
+				return nil, err
+			}
+			return &auth.Principal{
+				Subject:    token.Registered.Subject,
+				Method:     "jwt",
+				Roles:      token.roles,
+				Scopes:     token.scopes,
+				Attributes: map[string]any{attributeToken: token},
+			}, nil
+		},
+	}))
+}
+
+// unmarshal returns the JSON decoder for a request: the configured one,
+// else the router's.
+func (v *Verifier) unmarshal(r *http.Request) func([]byte, any) error {
+	if v.config.JSONUnmarshal != nil {
+		return v.config.JSONUnmarshal
+	}
+	if config, ok := r.Context().Value(ngamux.KeyContextConfig).(*ngamux.Config); ok {
+		return config.JSONCodec().Unmarshal
+	}
+	return json.Unmarshal
+}
+
+// attributeToken is the principal attribute holding the *Token.
+const attributeToken = "jwt"
+
+// FromContext returns the token verified by the middleware for the
+// request of ctx, or nil.
+func FromContext(ctx context.Context) *Token {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return nil
+	}
+	token, _ := principal.Attributes[attributeToken].(*Token)
+	return token
+}
+
+// Claims returns the decoded claims of the token verified for r, when
+// they are of type T, typically the pointer returned by Config.Claims.
+func Claims[T any](r *http.Request) (T, bool) {
+	var claims T
+	token := FromContext(r.Context())
+	if token == nil {
+		return claims, false
+	}
+	claims, ok := token.Claims.(T)
+	return claims, ok
+}
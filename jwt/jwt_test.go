@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+	"github.com/ngamux/ngamux/auth"
+)
+
+func TestNew(t *testing.T) {
+	config := testConfig(Keys{"": secret})
+	config.Realm = "api"
+	config.Claims = func() any { return &userClaims{} }
+
+	unmarshalled := 0
+	mux := ngamux.New(func(c *ngamux.Config) {
+		c.JSONUnmarshal = func(data []byte, v any) error {
+			unmarshalled++
+			return json.Unmarshal(data, v)
+		}
+	})
+	mux.Use(New(config))
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		principal := ngamux.Req(r).Principal()
+		claims, ok := Claims[*userClaims](r)
+		if !ok {
+			ngamux.Res(rw).Status(http.StatusInternalServerError).Text("no claims")
+			return
+		}
+		ngamux.Res(rw).Text(principal.Method + " " + principal.Subject + " " + claims.Email + " " + principal.Scopes[0])
+	})
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		must := must.New(t)
+		claims := claimsAt(time.Hour)
+		claims["email"] = "alice@example.com"
+		claims["scp"] = []string{"read"}
+		rec := serve("Bearer " + sign(t, HS256, "", secret, claims))
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal("jwt alice alice@example.com read", rec.Body.String())
+		must.True(unmarshalled > 0)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		must := must.New(t)
+		for _, authorization := range []string{
+			"",
+			"Bearer garbage",
+			"Bearer " + sign(t, HS256, "", secret, claimsAt(-time.Hour)),
+			"Bearer " + sign(t, HS256, "", []byte("another secret"), claimsAt(time.Hour)),
+		} {
+			rec := serve(authorization)
+			must.Equal(http.StatusUnauthorized, rec.Code)
+			must.Equal(`Bearer realm="api"`, rec.Header().Get("WWW-Authenticate"))
+		}
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	must.Nil(FromContext(req.Context()))
+	_, ok := Claims[map[string]any](req)
+	must.False(ok)
+
+	// Principals set by other middlewares carry no token.
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{Subject: "bob"}))
+	must.Nil(FromContext(req.Context()))
+}
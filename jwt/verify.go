@@ -0,0 +1,398 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // register the hashes used by hashes
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed is returned for tokens that are not well-formed JWS
+	// compact serializations with JSON header and claims.
+	ErrMalformed = errors.New("jwt: malformed token")
+	// ErrAlgorithm is returned when the token algorithm is not supported
+	// or not allowed by the configuration.
+	ErrAlgorithm = errors.New("jwt: algorithm not allowed")
+	// ErrUnknownKey is returned when the key set has no key for the token.
+	ErrUnknownKey = errors.New("jwt: unknown key")
+	// ErrSignature is returned when the signature does not verify.
+	ErrSignature = errors.New("jwt: invalid signature")
+	// ErrExpired is returned when the exp claim is in the past.
+	ErrExpired = errors.New("jwt: token expired")
+	// ErrNotYetValid is returned when the nbf claim is in the future.
+	ErrNotYetValid = errors.New("jwt: token not yet valid")
+	// ErrIssuedInFuture is returned when the iat claim is in the future.
+	ErrIssuedInFuture = errors.New("jwt: token issued in the future")
+	// ErrIssuer is returned when the iss claim is not the expected issuer.
+	ErrIssuer = errors.New("jwt: invalid issuer")
+	// ErrAudience is returned when the aud claim names none of the
+	// accepted audiences.
+	ErrAudience = errors.New("jwt: invalid audience")
+	// ErrMissingClaim is returned when a required claim is absent.
+	ErrMissingClaim = errors.New("jwt: missing required claim")
+)
+
+// Supported signature algorithms.
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var hashes = map[string]crypto.Hash{
+	HS256: crypto.SHA256,
+	HS384: crypto.SHA384,
+	HS512: crypto.SHA512,
+	RS256: crypto.SHA256,
+	ES256: crypto.SHA256,
+}
+
+// Header is the JOSE header of a token.
+type Header struct {
+	Algorithm string   `json:"alg"`
+	KeyID     string   `json:"kid,omitempty"`
+	Type      string   `json:"typ,omitempty"`
+	Critical  []string `json:"crit,omitempty"`
+}
+
+// RegisteredClaims holds the registered claims of a token (RFC 7519
+// section 4.1). Absent time claims are zero.
+type RegisteredClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+}
+
+// Token is a verified token.
+type Token struct {
+	// Raw is the token as received.
+	Raw    string
+	Header Header
+	// Registered holds the validated registered claims.
+	Registered RegisteredClaims
+	// Claims holds the claims decoded into the value returned by
+	// Config.Claims, or a map[string]any by default.
+	Claims any
+
+	scopes []string
+	roles  []string
+}
+
+// payload is the part of the claims read by the verifier. Numbers are
+// decoded as float64 and polymorphic claims as any so that any
+// encoding/json compatible JSONUnmarshal can decode it.
+type payload struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  any      `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	IssuedAt  *float64 `json:"iat"`
+	ID        string   `json:"jti"`
+	Scope     any      `json:"scope"`
+	Scp       any      `json:"scp"`
+	Roles     any      `json:"roles"`
+}
+
+// Verifier checks token signatures and registered claims.
+type Verifier struct {
+	config Config
+}
+
+// NewVerifier returns a Verifier for config. It panics when config.Keys
+// is nil.
+func NewVerifier(config Config) *Verifier {
+	if config.Keys == nil {
+		panic("jwt: Config.Keys is required")
+	}
+	config.setDefaults()
+	return &Verifier{config: config}
+}
+
+// Verify checks the signature and registered claims of token and
+// decodes its claims with Config.JSONUnmarshal, or encoding/json when it
+// is nil.
+func (v *Verifier) Verify(token string) (*Token, error) {
+	unmarshal := v.config.JSONUnmarshal
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	return v.verify(token, unmarshal)
+}
+
+func (v *Verifier) verify(raw string, unmarshal func([]byte, any) error) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	token := &Token{Raw: raw}
+	if err := unmarshal(headerJSON, &token.Header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	// No critical extension is understood, so any is fatal (RFC 7515
+	// section 4.1.11).
+	if len(token.Header.Critical) > 0 {
+		return nil, ErrMalformed
+	}
+	if !slices.Contains(v.config.Algorithms, token.Header.Algorithm) {
+		return nil, ErrAlgorithm
+	}
+
+	key, err := v.config.Keys.Key(token.Header.Algorithm, token.Header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(token.Header.Algorithm, key, raw[:len(parts[0])+1+len(parts[1])], signature); err != nil {
+		return nil, err
+	}
+
+	var p payload
+	if err := unmarshal(claimsJSON, &p); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	if err := v.validate(token, &p); err != nil {
+		return nil, err
+	}
+
+	if v.config.Claims != nil {
+		token.Claims = v.config.Claims()
+	} else {
+		token.Claims = &map[string]any{}
+	}
+	if err := unmarshal(claimsJSON, token.Claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	if m, ok := token.Claims.(*map[string]any); ok {
+		token.Claims = *m
+	}
+	return token, nil
+}
+
+func (v *Verifier) validate(token *Token, p *payload) error {
+	audience, ok := stringList(p.Audience, false)
+	if !ok {
+		return ErrMalformed
+	}
+	token.Registered = RegisteredClaims{
+		Issuer:    p.Issuer,
+		Subject:   p.Subject,
+		Audience:  audience,
+		ExpiresAt: numericDate(p.ExpiresAt),
+		NotBefore: numericDate(p.NotBefore),
+		IssuedAt:  numericDate(p.IssuedAt),
+		ID:        p.ID,
+	}
+	token.scopes, _ = stringList(p.Scope, true)
+	if scp, _ := stringList(p.Scp, true); len(scp) > 0 {
+		token.scopes = append(token.scopes, scp...)
+	}
+	token.roles, _ = stringList(p.Roles, false)
+
+	for _, claim := range v.config.Required {
+		present := false
+		switch claim {
+		case "exp":
+			present = p.ExpiresAt != nil
+		case "nbf":
+			present = p.NotBefore != nil
+		case "iat":
+			present = p.IssuedAt != nil
+		case "iss":
+			present = p.Issuer != ""
+		case "sub":
+			present = p.Subject != ""
+		case "aud":
+			present = len(audience) > 0
+		case "jti":
+			present = p.ID != ""
+		}
+		if !present {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, claim)
+		}
+	}
+
+	now := v.config.now()
+	skew := v.config.ClockSkew
+	claims := token.Registered
+	if !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt.Add(skew)) {
+		return ErrExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(skew).Before(claims.NotBefore) {
+		return ErrNotYetValid
+	}
+	if !claims.IssuedAt.IsZero() && now.Add(skew).Before(claims.IssuedAt) {
+		return ErrIssuedInFuture
+	}
+	if v.config.Issuer != "" && claims.Issuer != v.config.Issuer {
+		return ErrIssuer
+	}
+	if len(v.config.Audience) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.config.Audience, aud)
+	}) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// numericDate converts a NumericDate claim to a time, keeping
+// sub-second precision.
+func numericDate(seconds *float64) time.Time {
+	if seconds == nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(*seconds * 1000))
+}
+
+// stringList normalizes a claim holding a string or an array of
+// strings. With spaces, a single string is split on spaces as the scope
+// claim is (RFC 8693 section 4.2).
+func stringList(value any, spaces bool) ([]string, bool) {
+	switch value := value.(type) {
+	case nil:
+		return nil, true
+	case string:
+		if spaces {
+			return strings.Fields(value), true
+		}
+		return []string{value}, true
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+func digest(alg, signingInput string) []byte {
+	h := hashes[alg].New()
+	h.Write([]byte(signingInput))
+	return h.Sum(nil)
+}
+
+func verifySignature(alg string, key any, signingInput string, signature []byte) error {
+	switch alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(hashes[alg].New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrSignature
+		}
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest(alg, signingInput), signature) != nil {
+			return ErrSignature
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().BitSize != 256 {
+			return ErrUnknownKey
+		}
+		if len(signature) != 64 {
+			return ErrSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest(alg, signingInput), r, s) {
+			return ErrSignature
+		}
+	default:
+		return ErrAlgorithm
+	}
+	return nil
+}
+
+// Sign returns a token for claims signed with alg. key is a []byte
+// secret for the HS algorithms, an *rsa.PrivateKey for RS256 or an
+// *ecdsa.PrivateKey on P-256 for ES256. Claims are encoded with
+// encoding/json. It is meant for issuers and tests.
+func Sign(alg, kid string, key any, claims any) (string, error) {
+	header, err := json.Marshal(Header{Algorithm: alg, KeyID: kid, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	var signature []byte
+	switch alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.([]byte)
+		if !ok {
+			return "", ErrUnknownKey
+		}
+		mac := hmac.New(hashes[alg].New, secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case RS256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", ErrUnknownKey
+		}
+		signature, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest(alg, signingInput))
+		if err != nil {
+			return "", err
+		}
+	case ES256:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok || priv.Curve.Params().BitSize != 256 {
+			return "", ErrUnknownKey
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest(alg, signingInput))
+		if err != nil {
+			return "", err
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		return "", ErrAlgorithm
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,232 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+var (
+	secret  = []byte("0123456789abcdef0123456789abcdef")
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fixedAt = time.Unix(1700000000, 0)
+)
+
+func init() {
+	var err error
+	if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+func testConfig(keys KeySet) Config {
+	config := NewConfig(keys)
+	config.now = func() time.Time { return fixedAt }
+	return config
+}
+
+func claimsAt(offset time.Duration) map[string]any {
+	return map[string]any{
+		"sub": "alice",
+		"exp": fixedAt.Add(offset).Unix(),
+	}
+}
+
+func sign(t *testing.T, alg, kid string, key any, claims any) string {
+	t.Helper()
+	token, err := Sign(alg, kid, key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	keys := Keys{
+		"hs":  secret,
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+	}
+	verifier := NewVerifier(testConfig(keys))
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      any
+	}{
+		{HS256, "hs", secret},
+		{HS384, "hs", secret},
+		{HS512, "hs", secret},
+		{RS256, "rsa", rsaKey},
+		{ES256, "ec", ecKey},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			must := must.New(t)
+			raw := sign(t, tc.alg, tc.kid, tc.key, claimsAt(time.Hour))
+
+			token, err := verifier.Verify(raw)
+			must.Nil(err)
+			must.Equal("alice", token.Registered.Subject)
+			must.Equal(tc.alg, token.Header.Algorithm)
+			must.Equal("alice", token.Claims.(map[string]any)["sub"])
+
+			parts := strings.Split(raw, ".")
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			sig[0] ^= 1
+			_, err = verifier.Verify(parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(sig))
+			must.True(errors.Is(err, ErrSignature))
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	verifier := NewVerifier(testConfig(Keys{"hs": secret, "rsa": &rsaKey.PublicKey}))
+
+	t.Run("malformed", func(t *testing.T) {
+		must := must.New(t)
+		for _, raw := range []string{"", "a.b", "a.b.c", "e30.e30.!!", "!!.e30.sig"} {
+			_, err := verifier.Verify(raw)
+			must.True(errors.Is(err, ErrMalformed))
+		}
+	})
+
+	t.Run("none algorithm", func(t *testing.T) {
+		must := must.New(t)
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+		body := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+		_, err := verifier.Verify(header + "." + body + ".")
+		must.True(errors.Is(err, ErrAlgorithm))
+	})
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		must := must.New(t)
+		// An HMAC token keyed with the RSA key ID must not verify.
+		raw := sign(t, HS256, "rsa", secret, claimsAt(time.Hour))
+		_, err := verifier.Verify(raw)
+		must.True(errors.Is(err, ErrUnknownKey))
+	})
+
+	t.Run("disallowed algorithm", func(t *testing.T) {
+		must := must.New(t)
+		config := testConfig(Keys{"hs": secret})
+		config.Algorithms = []string{RS256}
+		_, err := NewVerifier(config).Verify(sign(t, HS256, "hs", secret, claimsAt(time.Hour)))
+		must.True(errors.Is(err, ErrAlgorithm))
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		must := must.New(t)
+		_, err := verifier.Verify(sign(t, HS256, "other", secret, claimsAt(time.Hour)))
+		must.True(errors.Is(err, ErrUnknownKey))
+	})
+
+	t.Run("crit header", func(t *testing.T) {
+		must := must.New(t)
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"hs","crit":["exp"]}`))
+		_, err := verifier.Verify(header + ".e30.sig")
+		must.True(errors.Is(err, ErrMalformed))
+	})
+}
+
+func TestVerifyClaims(t *testing.T) {
+	config := testConfig(Keys{"": secret})
+	config.Issuer = "https://issuer.example"
+	config.Audience = []string{"api", "admin"}
+	config.ClockSkew = 30 * time.Second
+	verifier := NewVerifier(config)
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": "https://issuer.example",
+			"aud": "api",
+			"exp": fixedAt.Add(time.Minute).Unix(),
+			"nbf": fixedAt.Add(-time.Minute).Unix(),
+			"iat": fixedAt.Add(-time.Minute).Unix(),
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(map[string]any)
+		err    error
+	}{
+		{"valid", func(map[string]any) {}, nil},
+		{"audience list", func(c map[string]any) { c["aud"] = []string{"other", "admin"} }, nil},
+		{"expired within skew", func(c map[string]any) { c["exp"] = fixedAt.Add(-10 * time.Second).Unix() }, nil},
+		{"expired", func(c map[string]any) { c["exp"] = fixedAt.Add(-time.Minute).Unix() }, ErrExpired},
+		{"missing exp", func(c map[string]any) { delete(c, "exp") }, ErrMissingClaim},
+		{"not yet valid within skew", func(c map[string]any) { c["nbf"] = fixedAt.Add(10 * time.Second).Unix() }, nil},
+		{"not yet valid", func(c map[string]any) { c["nbf"] = fixedAt.Add(time.Minute).Unix() }, ErrNotYetValid},
+		{"issued in the future", func(c map[string]any) { c["iat"] = fixedAt.Add(time.Minute).Unix() }, ErrIssuedInFuture},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example" }, ErrIssuer},
+		{"wrong audience", func(c map[string]any) { c["aud"] = []string{"other"} }, ErrAudience},
+		{"missing audience", func(c map[string]any) { delete(c, "aud") }, ErrAudience},
+		{"malformed audience", func(c map[string]any) { c["aud"] = 42 }, ErrMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			must := must.New(t)
+			claims := valid()
+			tc.modify(claims)
+			_, err := verifier.Verify(sign(t, HS256, "", secret, claims))
+			if tc.err == nil {
+				must.Nil(err)
+				return
+			}
+			must.True(errors.Is(err, tc.err))
+		})
+	}
+}
+
+type userClaims struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+}
+
+func TestVerifyDecodesClaims(t *testing.T) {
+	must := must.New(t)
+	called := false
+	config := testConfig(Keys{"": secret})
+	config.Claims = func() any { return &userClaims{} }
+	config.JSONUnmarshal = func(data []byte, v any) error {
+		called = true
+		return json.Unmarshal(data, v)
+	}
+
+	claims := claimsAt(time.Hour)
+	claims["email"] = "alice@example.com"
+	claims["scope"] = "read write"
+	claims["roles"] = []string{"admin"}
+	token, err := NewVerifier(config).Verify(sign(t, HS256, "", secret, claims))
+	must.Nil(err)
+	must.True(called)
+	must.Equal(&userClaims{Subject: "alice", Email: "alice@example.com"}, token.Claims)
+	must.Equal([]string{"read", "write"}, token.scopes)
+	must.Equal([]string{"admin"}, token.roles)
+	must.Equal(fixedAt.Add(time.Hour), token.Registered.ExpiresAt)
+}
+
+func TestSign(t *testing.T) {
+	must := must.New(t)
+	_, err := Sign(RS256, "", secret, nil)
+	must.True(errors.Is(err, ErrUnknownKey))
+	_, err = Sign("none", "", nil, nil)
+	must.True(errors.Is(err, ErrAlgorithm))
+}
+
+func TestNewVerifierRequiresKeys(t *testing.T) {
+	must := must.New(t)
+	defer func() { must.NotNil(recover()) }()
+	NewVerifier(Config{})
+}
@@ -0,0 +1,55 @@
+package ngamux
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// locals holds the values set with Req(r).Locals or SetLocal while a
+// request is served. It is safe for concurrent use, as handlers may hand
+// the request to other goroutines.
+type locals struct {
+	mu     sync.RWMutex
+	values map[any]any
+}
+
+func (l *locals) get(key any) (any, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	value, ok := l.values[key]
+	return value, ok
+}
+
+func (l *locals) set(key, value any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.values[key] = value
+}
+
+// withLocals stores new locals in the request context under
+// KeyContextLocals, unless it already holds some, e.g. when a router
+// serves a request for another one.
+func withLocals(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(KeyContextLocals).(*locals); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), KeyContextLocals, &locals{values: map[any]any{}}))
+}
+
+// Local returns the value of the request locals, or of the context, for
+// key when it is a T. It reports false when key is missing or holds
+// another type.
+//
+//	user, ok := ngamux.Local[*User](r, "user")
+func Local[T any](r *http.Request, key any) (T, bool) {
+	value, ok := Req(r).Locals(key).(T)
+	return value, ok
+}
+
+// SetLocal sets the value of the request locals for key, visible to the
+// middlewares and handlers serving the request after this call. The
+// request must be served by a router; use Req(r).Locals otherwise.
+func SetLocal(r *http.Request, key, value any) {
+	Req(r).Locals(key, value)
+}
@@ -0,0 +1,284 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNotMultipart is reported by Request.Multipart for requests
+	// whose body is not multipart.
+	ErrNotMultipart = errors.New("request body is not multipart")
+	// ErrPartTooLarge is reported by Request.Multipart when a part
+	// exceeds MultipartOptions.MaxPartSize or MaxFieldSize.
+	ErrPartTooLarge = errors.New("multipart part too large")
+	// ErrTooManyParts is reported by Request.Multipart when the body
+	// holds more than MultipartOptions.MaxParts parts.
+	ErrTooManyParts = errors.New("too many multipart parts")
+	// ErrFieldsTooLarge is reported by Request.Multipart when the values
+	// of the fields that are not files exceed MultipartOptions.MaxMemory
+	// together.
+	ErrFieldsTooLarge = errors.New("multipart fields too large")
+	// ErrContentTypeNotAllowed is reported by Request.Multipart for files
+	// whose sniffed content type is not in MultipartOptions.AllowedTypes.
+	ErrContentTypeNotAllowed = errors.New("file content type not allowed")
+)
+
+// MultipartOptions configures how Request.Multipart reads a body.
+type MultipartOptions struct {
+	// MaxPartSize limits the size of each file. Zero means no limit.
+	MaxPartSize int64
+	// MaxFieldSize limits the size of each value that is not a file,
+	// since those are held in memory. It defaults to 1MB.
+	MaxFieldSize int64
+	// MaxMemory limits the total size of the values that are not files,
+	// like the maxMemory of http.Request.ParseMultipartForm. It defaults
+	// to 10MB.
+	MaxMemory int64
+	// MaxTotalSize limits the size of the whole body. Zero means no
+	// limit.
+	MaxTotalSize int64
+	// MaxParts limits the number of parts. It defaults to 1000.
+	MaxParts int
+	// AllowedTypes lists the media types, or ranges such as image/*,
+	// that the content of files may have, as sniffed from their first
+	// bytes. Empty means any.
+	AllowedTypes []string
+}
+
+func (o *MultipartOptions) setDefaults() {
+	if o.MaxFieldSize == 0 {
+		o.MaxFieldSize = 1 << 20
+	}
+	if o.MaxMemory == 0 {
+		o.MaxMemory = 10 << 20
+	}
+	if o.MaxParts == 0 {
+		o.MaxParts = 1000
+	}
+}
+
+// MultipartFile is a file of a multipart body being streamed. Reading
+// it reads the file from the request body, up to
+// MultipartOptions.MaxPartSize.
+type MultipartFile struct {
+	io.Reader
+	// FieldName is the name of the form field holding the file.
+	FieldName string
+	// FileName is the name of the file given by the client. It must not
+	// be trusted as a path.
+	FileName string
+	// Header is the MIME header of the part.
+	Header textproto.MIMEHeader
+	// DeclaredType is the Content-Type the client gave for the file.
+	DeclaredType string
+	// ContentType is the type sniffed from the first bytes of the file
+	// with http.DetectContentType.
+	ContentType string
+}
+
+// MultipartError describes why Request.Multipart rejected a body.
+type MultipartError struct {
+	// Field and FileName locate the offending part, when known.
+	Field    string
+	FileName string
+	// Err is the underlying error, e.g. ErrPartTooLarge or a
+	// *http.MaxBytesError.
+	Err error
+}
+
+func (e *MultipartError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid multipart body")
+	if e.Field != "" {
+		b.WriteString(" at field ")
+		b.WriteString(e.Field)
+	}
+	if e.FileName != "" {
+		b.WriteString(" (file ")
+		b.WriteString(e.FileName)
+		b.WriteString(")")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *MultipartError) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status to answer with: 413 for bodies and
+// parts over their limits, 415 for bodies that are not multipart and
+// files of types not allowed, and 400 otherwise.
+func (e *MultipartError) Status() int {
+	switch {
+	case isLimitError(e.Err), errors.Is(e.Err, ErrTooManyParts), errors.Is(e.Err, ErrFieldsTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(e.Err, ErrNotMultipart), errors.Is(e.Err, ErrContentTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// Problem returns a problem with the status of e, its message as detail
+// and, when known, the field and file name as "field" and "filename"
+// members.
+func (e *MultipartError) Problem() Problem {
+	problem := NewProblem(e.Status(), e.Error())
+	problem.Extensions = map[string]any{}
+	if e.Field != "" {
+		problem.Extensions["field"] = e.Field
+	}
+	if e.FileName != "" {
+		problem.Extensions["filename"] = e.FileName
+	}
+	return problem
+}
+
+// Multipart streams a multipart/form-data body part by part, without
+// buffering files in memory or on disk as Request.FormFile does. It
+// calls onFile for each file, in the order of the body, and returns the
+// values of the other fields. Whatever onFile leaves unread of a file is
+// discarded, and a nil onFile discards every file. An error returned by
+// onFile stops reading and is returned as is, unless it comes from
+// reading past a limit.
+//
+// Limits and allow-lists are set by options. Rejected bodies are
+// reported as a *MultipartError.
+//
+//	values, err := ngamux.Req(r).Multipart(ngamux.MultipartOptions{
+//		MaxPartSize:  4 << 30,
+//		AllowedTypes: []string{"video/*"},
+//	}, func(file *ngamux.MultipartFile) error {
+//		_, err := io.Copy(dst, file)
+//		return err
+//	})
+func (r Request) Multipart(options MultipartOptions, onFile func(file *MultipartFile) error) (url.Values, error) {
+	options.setDefaults()
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, &MultipartError{Err: ErrNotMultipart}
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	if options.MaxTotalSize > 0 {
+		body = http.MaxBytesReader(nil, body, options.MaxTotalSize)
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	values := url.Values{}
+	memory := options.MaxMemory
+	for parts := 0; ; parts++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, &MultipartError{Err: err}
+		}
+		if parts == options.MaxParts {
+			return nil, &MultipartError{Err: ErrTooManyParts}
+		}
+
+		field, fileName := part.FormName(), part.FileName()
+		if fileName == "" {
+			value, err := io.ReadAll(&limitedPart{r: part, remaining: min(options.MaxFieldSize, memory)})
+			if errors.Is(err, ErrPartTooLarge) && memory < options.MaxFieldSize {
+				err = ErrFieldsTooLarge
+			}
+			if err != nil {
+				return nil, &MultipartError{Field: field, Err: err}
+			}
+			memory -= int64(len(value))
+			values.Add(field, string(value))
+			continue
+		}
+
+		file, err := newMultipartFile(part, options)
+		if err == nil && onFile != nil {
+			err = onFile(file)
+			if err != nil && !isLimitError(err) {
+				return nil, err
+			}
+		}
+		if err == nil {
+			_, err = io.Copy(io.Discard, file)
+		}
+		if err != nil {
+			return nil, &MultipartError{Field: field, FileName: fileName, Err: err}
+		}
+	}
+}
+
+// newMultipartFile sniffs the content type of part and checks it against
+// the allowed types.
+func newMultipartFile(part *multipart.Part, options MultipartOptions) (*MultipartFile, error) {
+	content := io.Reader(part)
+	if options.MaxPartSize > 0 {
+		content = &limitedPart{r: part, remaining: options.MaxPartSize}
+	}
+
+	sniffed := make([]byte, 512)
+	n, err := io.ReadFull(content, sniffed)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	sniffed = sniffed[:n]
+
+	file := &MultipartFile{
+		Reader:       io.MultiReader(bytes.NewReader(sniffed), content),
+		FieldName:    part.FormName(),
+		FileName:     part.FileName(),
+		Header:       part.Header,
+		DeclaredType: part.Header.Get("Content-Type"),
+		ContentType:  http.DetectContentType(sniffed),
+	}
+	if len(options.AllowedTypes) == 0 {
+		return file, nil
+	}
+	for _, allowed := range options.AllowedTypes {
+		if matchMediaRange(AcceptItem{Value: strings.ToLower(allowed)}, file.ContentType) {
+			return file, nil
+		}
+	}
+	return nil, ErrContentTypeNotAllowed
+}
+
+// isLimitError reports whether err comes from reading past
+// MultipartOptions.MaxPartSize or MaxTotalSize.
+func isLimitError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.Is(err, ErrPartTooLarge) || errors.As(err, &maxBytesErr)
+}
+
+// limitedPart reads from r up to remaining bytes, failing with
+// ErrPartTooLarge rather than io.EOF when r holds more.
+type limitedPart struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedPart) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) <= l.remaining {
+		l.remaining -= int64(n)
+		return n, err
+	}
+	n, l.remaining = int(l.remaining), 0
+	return n, ErrPartTooLarge
+}
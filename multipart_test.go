@@ -0,0 +1,138 @@
+package ngamux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+type multipartPart struct {
+	field, fileName string
+	content         []byte
+}
+
+func multipartRequest(parts ...multipartPart) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range parts {
+		var w io.Writer
+		if part.fileName == "" {
+			w, _ = writer.CreateFormField(part.field)
+		} else {
+			w, _ = writer.CreateFormFile(part.field, part.fileName)
+		}
+		_, _ = w.Write(part.content)
+	}
+	_ = writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestMultipart(t *testing.T) {
+	must := must.New(t)
+	image := append(bytes.Clone(pngHeader), bytes.Repeat([]byte{1}, 2000)...)
+	req := multipartRequest(
+		multipartPart{"title", "", []byte("holiday")},
+		multipartPart{"photo", "a.png", image},
+		multipartPart{"note", "note.txt", []byte("hello")},
+		multipartPart{"tag", "", []byte("a")},
+		multipartPart{"tag", "", []byte("b")},
+	)
+
+	var files []MultipartFile
+	var contents [][]byte
+	values, err := Req(req).Multipart(MultipartOptions{}, func(file *MultipartFile) error {
+		if file.FieldName == "note" {
+			// Unread content is skipped.
+			files = append(files, *file)
+			contents = append(contents, nil)
+			return nil
+		}
+		content, err := io.ReadAll(file)
+		files = append(files, *file)
+		contents = append(contents, content)
+		return err
+	})
+	must.Nil(err)
+	must.Equal(url.Values{"title": {"holiday"}, "tag": {"a", "b"}}, values)
+	must.Equal(2, len(files))
+	must.Equal("photo", files[0].FieldName)
+	must.Equal("a.png", files[0].FileName)
+	must.Equal("image/png", files[0].ContentType)
+	must.Equal("application/octet-stream", files[0].DeclaredType)
+	must.Equal(image, contents[0])
+	must.Equal("text/plain; charset=utf-8", files[1].ContentType)
+}
+
+func TestMultipartErrors(t *testing.T) {
+	must := must.New(t)
+	readAll := func(file *MultipartFile) error {
+		_, err := io.Copy(io.Discard, file)
+		return err
+	}
+	image := multipartPart{"photo", "a.png", append(bytes.Clone(pngHeader), make([]byte, 100)...)}
+
+	for _, tc := range []struct {
+		name    string
+		req     *http.Request
+		options MultipartOptions
+		onFile  func(*MultipartFile) error
+		err     error
+		status  int
+	}{
+		{"part too large", multipartRequest(image), MultipartOptions{MaxPartSize: 50}, readAll, ErrPartTooLarge, http.StatusRequestEntityTooLarge},
+		{"part too large unread", multipartRequest(image), MultipartOptions{MaxPartSize: 50}, func(*MultipartFile) error { return nil }, ErrPartTooLarge, http.StatusRequestEntityTooLarge},
+		{"field too large", multipartRequest(multipartPart{"title", "", []byte("long title")}), MultipartOptions{MaxFieldSize: 4}, readAll, ErrPartTooLarge, http.StatusRequestEntityTooLarge},
+		{"fields too large", multipartRequest(multipartPart{"a", "", []byte("1234")}, multipartPart{"b", "", []byte("5678")}), MultipartOptions{MaxMemory: 6}, readAll, ErrFieldsTooLarge, http.StatusRequestEntityTooLarge},
+		{"body too large", multipartRequest(image), MultipartOptions{MaxTotalSize: 100}, readAll, nil, http.StatusRequestEntityTooLarge},
+		{"too many parts", multipartRequest(image, image), MultipartOptions{MaxParts: 1}, readAll, ErrTooManyParts, http.StatusRequestEntityTooLarge},
+		{"type not allowed", multipartRequest(multipartPart{"photo", "a.png", []byte("plain text")}), MultipartOptions{AllowedTypes: []string{"image/*"}}, readAll, ErrContentTypeNotAllowed, http.StatusUnsupportedMediaType},
+		{"not multipart", jsonRequest(`{}`), MultipartOptions{}, readAll, ErrNotMultipart, http.StatusUnsupportedMediaType},
+	} {
+		_, err := Req(tc.req).Multipart(tc.options, tc.onFile)
+		multipartErr := &MultipartError{}
+		if !errors.As(err, &multipartErr) {
+			t.Fatalf("%s: got %v", tc.name, err)
+		}
+		if tc.err != nil {
+			must.True(errors.Is(err, tc.err))
+		}
+		must.Equal(tc.status, ErrorProblem(err).Status)
+	}
+
+	// Allowed types match the sniffed type, not the declared one.
+	_, err := Req(multipartRequest(image)).Multipart(MultipartOptions{AllowedTypes: []string{"image/png"}}, readAll)
+	must.Nil(err)
+
+	// Without a callback files are discarded.
+	values, err := Req(multipartRequest(image, multipartPart{"title", "", []byte("a")})).Multipart(MultipartOptions{}, nil)
+	must.Nil(err)
+	must.Equal(url.Values{"title": {"a"}}, values)
+
+	// Errors of the callback are returned as is.
+	errStop := errors.New("stop")
+	_, err = Req(multipartRequest(image)).Multipart(MultipartOptions{}, func(*MultipartFile) error { return errStop })
+	must.Equal(errStop, err)
+}
+
+func TestMultipartErrorProblem(t *testing.T) {
+	must := must.New(t)
+	err := &MultipartError{Field: "photo", FileName: "a.png", Err: ErrPartTooLarge}
+	must.Equal("invalid multipart body at field photo (file a.png): multipart part too large", err.Error())
+	problem := err.Problem()
+	must.Equal(http.StatusRequestEntityTooLarge, problem.Status)
+	must.Equal(map[string]any{"field": "photo", "filename": "a.png"}, problem.Extensions)
+	must.True(strings.HasPrefix(problem.Detail, "invalid multipart body"))
+}
@@ -0,0 +1,266 @@
+package ngamux
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AcceptItem is an element of an Accept, Accept-Language,
+// Accept-Charset or Accept-Encoding header, such as
+// "text/html;level=1;q=0.8".
+type AcceptItem struct {
+	// Value is the media range, language range, charset or coding,
+	// lowercased, e.g. "text/html", "en-us" or "*".
+	Value string
+	// Params holds the parameters of Value other than q, with lowercased
+	// names, or is nil.
+	Params map[string]string
+	// Q is the quality, between 0 and 1. Zero means not acceptable.
+	Q float64
+}
+
+// ParseAccept parses header, the value of an Accept-like header, into its
+// elements sorted by decreasing quality and then by decreasing
+// specificity, e.g. text/html before text/* before */*. Elements in a tie
+// keep their order in header. Malformed elements are skipped.
+func ParseAccept(header string) []AcceptItem {
+	var items []AcceptItem
+	for _, element := range strings.Split(header, ",") {
+		value, rest, _ := strings.Cut(element, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+
+		item := AcceptItem{Value: value, Q: 1}
+		valid := true
+		for rest != "" {
+			var param string
+			param, rest, _ = strings.Cut(rest, ";")
+			name, paramValue, _ := strings.Cut(param, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			paramValue = strings.TrimSpace(paramValue)
+			if unquoted, err := strconv.Unquote(paramValue); err == nil && strings.HasPrefix(paramValue, `"`) {
+				paramValue = unquoted
+			}
+			switch name {
+			case "":
+			case "q":
+				q, err := strconv.ParseFloat(paramValue, 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+				}
+				item.Q = q
+			default:
+				if item.Params == nil {
+					item.Params = map[string]string{}
+				}
+				item.Params[name] = paramValue
+			}
+		}
+		if valid {
+			items = append(items, item)
+		}
+	}
+
+	slices.SortStableFunc(items, func(a, b AcceptItem) int {
+		switch {
+		case a.Q != b.Q:
+			if a.Q > b.Q {
+				return -1
+			}
+			return 1
+		}
+		return specificity(b) - specificity(a)
+	})
+	return items
+}
+
+// specificity ranks how narrow item is: */* below type/* below
+// type/subtype below type/subtype with parameters, and * below en below
+// en-us.
+func specificity(item AcceptItem) int {
+	if typ, subtype, ok := strings.Cut(item.Value, "/"); ok {
+		switch {
+		case typ == "*":
+			return 0
+		case subtype == "*":
+			return 1
+		case len(item.Params) > 0:
+			return 3
+		}
+		return 2
+	}
+	if item.Value == "*" {
+		return 0
+	}
+	return 1 + strings.Count(item.Value, "-")
+}
+
+// negotiate returns the offer with the highest quality in items, the
+// quality of an offer being the one of the most specific element match
+// reports it matching. Offers that no element matches are not
+// acceptable, and ties go to the earliest offer. Without items, the
+// first offer is returned.
+func negotiate(items []AcceptItem, offers []string, match func(item AcceptItem, offer string) bool) (string, bool) {
+	if len(items) == 0 {
+		if len(offers) == 0 {
+			return "", false
+		}
+		return offers[0], true
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, found := 0.0, -1
+		for _, item := range items {
+			if s := specificity(item); s > found && match(item, offer) {
+				q, found = item.Q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// matchMediaRange reports whether the media type offer falls within the
+// media range of item. Parameters of the range must be present in offer.
+func matchMediaRange(item AcceptItem, offer string) bool {
+	mediaType, params, err := mime.ParseMediaType(offer)
+	if err != nil {
+		return false
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	rangeType, rangeSubtype, _ := strings.Cut(item.Value, "/")
+	switch {
+	case rangeType == "*":
+	case rangeType != typ:
+		return false
+	case rangeSubtype != "*" && rangeSubtype != subtype:
+		return false
+	}
+	for name, value := range item.Params {
+		if !strings.EqualFold(params[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLanguageRange reports whether the language tag offer matches the
+// language range of item: equally, by extending it as en-US does en, or
+// for *.
+func matchLanguageRange(item AcceptItem, offer string) bool {
+	offer = strings.ToLower(offer)
+	return item.Value == "*" || item.Value == offer ||
+		strings.HasPrefix(offer, item.Value+"-")
+}
+
+// matchToken reports whether offer equals the value of item, ignoring
+// case, or item is *.
+func matchToken(item AcceptItem, offer string) bool {
+	return item.Value == "*" || strings.EqualFold(item.Value, offer)
+}
+
+// NegotiateMediaType returns the media type of offers preferred by accept,
+// the value of an Accept header, following RFC 9110: each offer takes the
+// quality of the most specific media range matching it, the offer with
+// the highest quality wins and ties go to the earliest offer. It reports
+// false when no offer is acceptable. Any offer is acceptable when accept
+// is empty.
+func NegotiateMediaType(accept string, offers ...string) (string, bool) {
+	return negotiate(ParseAccept(accept), offers, matchMediaRange)
+}
+
+// Accepts returns the media type of offers preferred by the Accept header
+// of the request, see NegotiateMediaType.
+func (r Request) Accepts(offers ...string) (string, bool) {
+	return NegotiateMediaType(strings.Join(r.Header.Values("Accept"), ","), offers...)
+}
+
+// AcceptsLanguage returns the language tag of offers, such as "en" or
+// "id-ID", preferred by the Accept-Language header of the request. A
+// language range matches the tags it is a prefix of, so "en" matches
+// "en-GB", and when no range matches an offer that way, the ranges it is
+// a prefix of are used instead, so an offer of "en" satisfies "en-GB".
+// Ties go to the earliest offer, and the first offer is returned when the
+// header is missing. It reports false when no offer is acceptable.
+func (r Request) AcceptsLanguage(offers ...string) (string, bool) {
+	items := ParseAccept(strings.Join(r.Header.Values("Accept-Language"), ","))
+	if offer, ok := negotiate(items, offers, matchLanguageRange); ok || len(items) == 0 {
+		return offer, ok
+	}
+	// Fall back to truncated ranges, as RFC 4647 lookup does.
+	return negotiate(items, offers, func(item AcceptItem, offer string) bool {
+		return strings.HasPrefix(item.Value, strings.ToLower(offer)+"-")
+	})
+}
+
+// AcceptsCharset returns the charset of offers preferred by the
+// Accept-Charset header of the request. Ties go to the earliest offer,
+// and the first offer is returned when the header is missing. It reports
+// false when no offer is acceptable.
+func (r Request) AcceptsCharset(offers ...string) (string, bool) {
+	return negotiate(ParseAccept(strings.Join(r.Header.Values("Accept-Charset"), ",")), offers, matchToken)
+}
+
+// Languages returns the language ranges of the Accept-Language header of
+// the request, most preferred first, leaving out unacceptable ones.
+func (r Request) Languages() []string {
+	var languages []string
+	for _, item := range ParseAccept(strings.Join(r.Header.Values("Accept-Language"), ",")) {
+		if item.Q > 0 {
+			languages = append(languages, item.Value)
+		}
+	}
+	return languages
+}
+
+// Negotiate calls the handler of handlers, keyed by media type, that the
+// Accept header of the request given to Res prefers, see
+// NegotiateMediaType. Ties go to the media type sorting first. The
+// response varies by Accept. When no media type is acceptable, a 406 Not
+// Acceptable problem listing them is written instead.
+//
+//	ngamux.Res(rw, r).Negotiate(map[string]func(){
+//		"application/json": func() { ngamux.Res(rw, r).JSON(users) },
+//		"text/html":        func() { ngamux.Res(rw, r).HTML("users.html", users) },
+//		"text/csv":         func() { ngamux.Res(rw, r).Encode(users) },
+//	})
+func (r *Response) Negotiate(handlers map[string]func()) {
+	r.Header().Add("Vary", "Accept")
+
+	offers := make([]string, 0, len(handlers))
+	for mediaType := range handlers {
+		offers = append(offers, mediaType)
+	}
+	slices.Sort(offers)
+
+	mediaType, ok := NegotiateMediaType(r.accept(), offers...)
+	if !ok {
+		r.notAcceptable(offers)
+		return
+	}
+	handlers[mediaType]()
+}
+
+// accept returns the Accept header of the request given to Res or ETag.
+func (r *Response) accept() string {
+	if r.request == nil {
+		return ""
+	}
+	return strings.Join(r.request.Header.Values("Accept"), ",")
+}
+
+// notAcceptable writes a 406 Not Acceptable problem listing the media
+// types that can be produced under "acceptable".
+func (r *Response) notAcceptable(mediaTypes []string) {
+	problem := NewProblem(http.StatusNotAcceptable, "none of the acceptable media types can be produced")
+	problem.Extensions = map[string]any{"acceptable": mediaTypes}
+	r.Problem(problem)
+}
@@ -0,0 +1,144 @@
+package ngamux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestParseAccept(t *testing.T) {
+	must := must.New(t)
+	items := ParseAccept(`*/*;q=0.8, text/*, Text/HTML;Level=1, text/html, application/xml;q=0.9, image/png;q=bad, video/*;q=2, , text/plain;charset="utf-8";q=0`)
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = item.Value
+	}
+	must.Equal([]string{"text/html", "text/html", "text/*", "application/xml", "*/*", "text/plain"}, values)
+	must.Equal(map[string]string{"level": "1"}, items[0].Params)
+	must.Equal(0.9, items[3].Q)
+	must.Equal(map[string]string{"charset": "utf-8"}, items[5].Params)
+	must.Equal(0.0, items[5].Q)
+
+	must.Equal(0, len(ParseAccept("")))
+
+	languages := ParseAccept("*;q=0.1, en;q=0.8, en-US;q=0.8, id")
+	must.Equal("id", languages[0].Value)
+	must.Equal("en-us", languages[1].Value)
+	must.Equal("en", languages[2].Value)
+	must.Equal("*", languages[3].Value)
+}
+
+func TestNegotiateMediaType(t *testing.T) {
+	must := must.New(t)
+	// The example of RFC 9110, section 12.5.1.
+	accept := "text/*;q=0.3, text/plain;q=0.7, text/plain;format=flowed, text/plain;format=fixed;q=0.4, */*;q=0.5"
+	for _, tc := range []struct {
+		offers []string
+		want   string
+	}{
+		{[]string{"text/plain", "text/plain;format=flowed"}, "text/plain;format=flowed"},
+		{[]string{"text/html", "text/plain"}, "text/plain"},
+		{[]string{"text/html", "image/jpeg"}, "image/jpeg"},
+		{[]string{"text/plain;format=fixed", "image/jpeg"}, "image/jpeg"},
+		{[]string{"text/html;level=3", "text/plain;format=fixed"}, "text/plain;format=fixed"},
+		{[]string{"image/png", "image/jpeg"}, "image/png"},
+	} {
+		got, ok := NegotiateMediaType(accept, tc.offers...)
+		must.True(ok)
+		must.Equal(tc.want, got)
+	}
+
+	// Exclusions win over wildcards.
+	_, ok := NegotiateMediaType("*/*, text/csv;q=0", "text/csv")
+	must.False(ok)
+	got, ok := NegotiateMediaType("*/*, text/csv;q=0", "text/csv", "application/json")
+	must.True(ok)
+	must.Equal("application/json", got)
+
+	got, ok = NegotiateMediaType("", "text/html", "application/json")
+	must.True(ok)
+	must.Equal("text/html", got)
+	_, ok = NegotiateMediaType("image/*", "text/html")
+	must.False(ok)
+	_, ok = NegotiateMediaType("*/*")
+	must.False(ok)
+}
+
+func TestAcceptsLanguageAndCharset(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "id-ID, en;q=0.8, fr;q=0")
+	req.Header.Set("Accept-Charset", "utf-8, iso-8859-1;q=0.5")
+
+	for _, tc := range []struct {
+		offers []string
+		want   string
+		ok     bool
+	}{
+		{[]string{"en", "id-ID"}, "id-ID", true},
+		{[]string{"en-GB", "de"}, "en-GB", true},
+		{[]string{"id", "en"}, "en", true},
+		{[]string{"id", "de"}, "id", true},
+		{[]string{"fr", "de"}, "", false},
+	} {
+		got, ok := Req(req).AcceptsLanguage(tc.offers...)
+		must.Equal(tc.ok, ok)
+		must.Equal(tc.want, got)
+	}
+	must.Equal([]string{"id-id", "en"}, Req(req).Languages())
+
+	got, ok := Req(req).AcceptsCharset("ISO-8859-1", "UTF-8")
+	must.True(ok)
+	must.Equal("UTF-8", got)
+	_, ok = Req(req).AcceptsCharset("utf-16")
+	must.False(ok)
+
+	req.Header.Set("Accept", "text/html, application/json;q=0.9")
+	got, ok = Req(req).Accepts("application/json", "text/html")
+	must.True(ok)
+	must.Equal("text/html", got)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	got, ok = Req(req).AcceptsLanguage("en", "id")
+	must.True(ok)
+	must.Equal("en", got)
+	must.Equal(0, len(Req(req).Languages()))
+}
+
+func TestResponseNegotiate(t *testing.T) {
+	must := must.New(t)
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		Res(rw, r).Negotiate(map[string]func(){
+			"application/json": func() { Res(rw, r).JSON("json") },
+			"text/html":        func() { Res(rw, r).Text("html") },
+			"text/csv":         func() { Res(rw, r).Text("csv") },
+		})
+	}
+
+	for accept, want := range map[string]string{
+		"":                                 `"json"`,
+		"*/*":                              `"json"`,
+		"text/html,*/*;q=0.8":              "html",
+		"text/*":                           "csv",
+		"text/*, text/csv;q=0.5":           "html",
+		"application/*;q=0.2, text/csv":    "csv",
+		"application/json;q=0, text/*;q=1": "csv",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		must.Equal(want, rec.Body.String())
+		must.Equal("Accept", rec.Header().Get("Vary"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "image/png")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	must.Equal(http.StatusNotAcceptable, rec.Code)
+	must.True(strings.Contains(rec.Body.String(), `"acceptable":["application/json","text/csv","text/html"]`))
+}
@@ -26,6 +26,26 @@ const (
 	// this key is [][]string where each element is a two-item slice
 	// [name, value]. Handlers can read parameters using Req(r).Params(name).
 	KeyContextParams KeyContext = 1 << iota
+
+	// KeyContextConfig is the context key under which the router stores
+	// its *Config for every request it serves, so request helpers can
+	// honour router-wide settings such as trusted proxies.
+	KeyContextConfig
+
+	// KeyContextCSPNonce is the context key under which a per-request
+	// Content-Security-Policy nonce is stored by the secure middleware.
+	// Handlers can read it using Req(r).CSPNonce().
+	KeyContextCSPNonce
+
+	// KeyContextCSRFToken is the context key under which the csrf
+	// middleware stores the masked token to embed in forms or headers.
+	// Handlers can read it using Req(r).CSRFToken().
+	KeyContextCSRFToken
+
+	// KeyContextLocals is the context key under which the router stores
+	// the mutable per-request locals read and written by
+	// Req(r).Locals, Local and SetLocal.
+	KeyContextLocals
 )
 
 var (
@@ -35,6 +55,12 @@ var (
 	headerContentTypeText = http.Header{
 		"Content-Type": []string{"text/plain"},
 	}
+	headerContentTypeHTML = http.Header{
+		"Content-Type": []string{"text/html; charset=utf-8"},
+	}
+	headerContentTypeProblem = http.Header{
+		"Content-Type": []string{"application/problem+json"},
+	}
 )
 
 type Ngamux struct {
@@ -43,6 +69,8 @@ type Ngamux struct {
 	config      *Config
 	path        string
 	parent      *Ngamux
+	policies    []Policy
+	routes      []Route
 }
 
 // New constructs a new Ngamux router. Optionally pass functional
@@ -56,6 +84,7 @@ func New(opts ...func(*Config)) *Ngamux {
 	for _, opt := range opts {
 		opt(&config)
 	}
+	config.build()
 	return &Ngamux{
 		root:        mapping.New[string, *Node](),
 		middlewares: make([]MiddlewareFunc, 0),
@@ -83,27 +112,33 @@ func (mux Ngamux) Config() Config {
 // path. Middlewares passed here are combined with middlewares registered
 // on this router and any parent groups. If this Ngamux is nested (created
 // via Group), the final path and middleware chain are composed by walking
-// the parent chain and joining path prefixes.
+// the parent chain and joining path prefixes. Policies declared with
+// Require on this router and its parents are checked after every
+// middleware, right before handler.
 func (mux *Ngamux) HandleFunc(method, path string, handler http.HandlerFunc, middlewares ...MiddlewareFunc) {
 	middlewares = append(mux.middlewares, middlewares...)
-	if mux.parent == nil {
-		mux.Handle(method+" "+path, WithMiddlewares(middlewares...)(handler))
-		return
-	}
-
-	parent := mux.parent
-	path = gopath.Join(mux.path, path)
-	for parent != nil {
-		path = gopath.Join(parent.path, path)
-		middlewares = append(parent.middlewares, middlewares...)
-		if parent.parent == nil {
-			break
+	policies := mux.policies
+	root := mux
+	if mux.parent != nil {
+		parent := mux.parent
+		path = gopath.Join(mux.path, path)
+		for parent != nil {
+			path = gopath.Join(parent.path, path)
+			middlewares = append(parent.middlewares, middlewares...)
+			policies = slices.Concat(parent.policies, policies)
+			if parent.parent == nil {
+				break
+			}
+
+			parent = parent.parent
 		}
-
-		parent = parent.parent
+		root = parent
 	}
 
-	parent.Handle(method+" "+path, WithMiddlewares(middlewares...)(handler))
+	if len(policies) > 0 {
+		handler = Authorize(policies...)(handler)
+	}
+	root.handle(method+" "+path, WithMiddlewares(middlewares...)(handler), policies)
 }
 
 // Get registers a handler for GET requests on the provided URL.
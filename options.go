@@ -1,6 +1,15 @@
 package ngamux
 
-import "log/slog"
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/ngamux/ngamux/codec"
+	"github.com/ngamux/ngamux/securecookie"
+	"github.com/ngamux/ngamux/validate"
+)
 
 // WithTrailingSlash returns function that adds RemoveTrailingSlash into config
 func WithTrailingSlash() func(*Config) {
@@ -15,3 +24,81 @@ func WithLogLevel(level slog.Level) func(*Config) {
 		c.LogLevel = level
 	}
 }
+
+// WithTrustedProxies returns function that adds TrustedProxies into config.
+// Each entry is either a CIDR ("10.0.0.0/8") or a single address
+// ("192.0.2.1"). It panics on malformed entries, as they are
+// programming errors caught at startup.
+func WithTrustedProxies(proxies ...string) func(*Config) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr := netip.MustParseAddr(proxy).Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefixes = append(prefixes, netip.MustParsePrefix(proxy).Masked())
+	}
+
+	return func(c *Config) {
+		c.TrustedProxies = append(c.TrustedProxies, prefixes...)
+	}
+}
+
+// WithProxyHeader returns function that sets ProxyHeader in config: one
+// of X-Forwarded-For, Forwarded or X-Real-Ip. It panics on any other
+// header, as it is a programming error caught at startup.
+func WithProxyHeader(header string) func(*Config) {
+	header = http.CanonicalHeaderKey(header)
+	switch header {
+	case "X-Forwarded-For", "Forwarded", "X-Real-Ip":
+	default:
+		panic("ngamux: unsupported proxy header " + header)
+	}
+
+	return func(c *Config) {
+		c.ProxyHeader = header
+	}
+}
+
+// WithCookieKeys returns function that adds CookieKeys into config. The
+// first key signs and encrypts new cookies, while every key is accepted
+// when reading them, which allows rotating keys without logging users out.
+// It panics on keys shorter than securecookie.MinKeyLength, as they are
+// programming errors caught at startup.
+func WithCookieKeys(keys ...[]byte) func(*Config) {
+	for _, key := range keys {
+		if len(key) < securecookie.MinKeyLength {
+			panic("ngamux: " + securecookie.ErrShortKey.Error())
+		}
+	}
+
+	return func(c *Config) {
+		c.CookieKeys = append(c.CookieKeys, keys...)
+	}
+}
+
+// WithValidator returns function that adds Validator into config, so
+// that Request.Bind and Request.JSON validate what they decode. It uses
+// validate.Default when no validator is given.
+func WithValidator(validator ...*validate.Validator) func(*Config) {
+	v := validate.Default
+	if len(validator) > 0 {
+		v = validator[0]
+	}
+	return func(c *Config) {
+		c.Validator = v
+	}
+}
+
+// WithCodec returns function that registers c for mediaType into the
+// Codecs of config, starting from a copy of codec.Default, so that
+// Request.Decode and Response.Encode handle the media type.
+func WithCodec(mediaType string, c codec.Codec) func(*Config) {
+	return func(config *Config) {
+		if config.Codecs == nil {
+			config.Codecs = codec.Default().Clone()
+		}
+		config.Codecs.Register(mediaType, c)
+	}
+}
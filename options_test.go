@@ -1,9 +1,13 @@
 package ngamux
 
 import (
+	"bytes"
+	"net/netip"
 	"testing"
 
 	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/codec"
+	"github.com/ngamux/ngamux/validate"
 )
 
 func TestOptions(t *testing.T) {
@@ -21,4 +25,73 @@ func TestOptions(t *testing.T) {
 		must.Equal(mux.config.LogLevel, LogLevelQuiet)
 	})
 
+	t.Run("set TrustedProxies", func(t *testing.T) {
+		must := must.New(t)
+
+		mux := New(WithTrustedProxies("10.0.0.0/8", "192.0.2.1", "2001:db8::/32"))
+		must.Equal([]netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.0.2.1/32"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		}, mux.config.TrustedProxies)
+	})
+
+	t.Run("set ProxyHeader", func(t *testing.T) {
+		must := must.New(t)
+
+		must.Equal("X-Forwarded-For", New().config.ProxyHeader)
+		mux := New(WithProxyHeader("forwarded"))
+		must.Equal("Forwarded", mux.config.ProxyHeader)
+
+		defer func() {
+			must.NotNil(recover())
+		}()
+		WithProxyHeader("X-Client-IP")
+	})
+
+	t.Run("set CookieKeys", func(t *testing.T) {
+		must := must.New(t)
+
+		a, b := bytes.Repeat([]byte("a"), 32), bytes.Repeat([]byte("b"), 32)
+		mux := New(WithCookieKeys(a, b))
+		must.Equal([][]byte{a, b}, mux.config.CookieKeys)
+		must.NotNil(mux.config.cookies)
+
+		defer func() {
+			must.NotNil(recover())
+		}()
+		WithCookieKeys(a, []byte("short"))
+	})
+
+	t.Run("invalid CookieKeys", func(t *testing.T) {
+		must := must.New(t)
+
+		defer func() {
+			must.NotNil(recover())
+		}()
+		New(func(c *Config) {
+			c.CookieKeys = [][]byte{[]byte("short")}
+		})
+	})
+
+	t.Run("set Validator", func(t *testing.T) {
+		must := must.New(t)
+
+		mux := New(WithValidator())
+		must.True(mux.config.Validator == validate.Default)
+		v := validate.New()
+		mux = New(WithValidator(v))
+		must.True(mux.config.Validator == v)
+	})
+
+	t.Run("WithCodec", func(t *testing.T) {
+		must := must.New(t)
+		mux := New(WithCodec("application/yaml", codec.XML))
+		c, ok := mux.config.Codecs.Lookup("application/yaml")
+		must.True(ok)
+		must.Equal(codec.XML, c)
+		_, ok = codec.Default().Lookup("application/yaml")
+		must.False(ok)
+	})
+
 }
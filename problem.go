@@ -0,0 +1,124 @@
+package ngamux
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/ngamux/ngamux/json"
+	"github.com/ngamux/ngamux/validate"
+)
+
+// Problem describes an error as RFC 9457 problem details. It is written
+// with Response.Problem as application/problem+json.
+type Problem struct {
+	// Type is a URI identifying the problem type. Empty means
+	// "about:blank", i.e. the problem is described by Status alone.
+	Type string
+	// Title is a short summary of the problem type.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail explains this occurrence of the problem.
+	Detail string
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string
+	// Extensions holds additional members, serialized next to the
+	// standard ones.
+	Extensions map[string]any
+}
+
+// NewProblem returns a Problem for status, titled with the status text.
+func NewProblem(status int, detail string) Problem {
+	return Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements error, so handlers can return problems as errors.
+func (p Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON encodes p as a problem details object.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	return json.Standard.Marshal(p.members())
+}
+
+// members returns the members of the problem details object of p.
+func (p Problem) members() map[string]any {
+	members := make(map[string]any, len(p.Extensions)+5)
+	maps.Copy(members, p.Extensions)
+	for name, value := range map[string]string{
+		"type":     p.Type,
+		"title":    p.Title,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+	} {
+		if value != "" {
+			members[name] = value
+		}
+	}
+	if p.Status != 0 {
+		members["status"] = p.Status
+	}
+	return members
+}
+
+// ErrorProblem returns the problem describing err: err itself when it is
+// a Problem, the result of its Problem method for errors such as
+// *BindError and *JSONError, 422 Unprocessable Content listing the
+// broken rules under "errors" for validate.Errors, and 500 Internal
+// Server Error, without detail, otherwise.
+func ErrorProblem(err error) Problem {
+	var problem Problem
+	var problemErr interface{ Problem() Problem }
+	var validationErrs validate.Errors
+	switch {
+	case errors.As(err, &problem):
+		return problem
+	case errors.As(err, &problemErr):
+		return problemErr.Problem()
+	case errors.As(err, &validationErrs):
+		errs := make([]map[string]string, len(validationErrs))
+		for i, e := range validationErrs {
+			errs[i] = map[string]string{
+				"field":  e.Field,
+				"rule":   e.Rule,
+				"detail": e.Message,
+			}
+		}
+		problem = NewProblem(http.StatusUnprocessableEntity, "the request has invalid fields")
+		problem.Extensions = map[string]any{"errors": errs}
+		return problem
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// Problem writes problem as application/problem+json. The status is the
+// one of problem, else the one set with Status, else 500.
+func (r *Response) Problem(problem Problem) {
+	if problem.Status == 0 {
+		problem.Status = r.status
+		if problem.Status == 0 {
+			problem.Status = http.StatusInternalServerError
+		}
+		if problem.Title == "" {
+			problem.Title = http.StatusText(problem.Status)
+		}
+	}
+
+	b, err := r.jsonCodec().Marshal(problem.members())
+	if err != nil {
+		http.Error(r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r.status = problem.Status
+	r.send(headerContentTypeProblem, b)
+}
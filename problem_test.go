@@ -0,0 +1,75 @@
+package ngamux
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/validate"
+)
+
+func TestProblem(t *testing.T) {
+	t.Run("members", func(t *testing.T) {
+		must := must.New(t)
+		problem := NewProblem(http.StatusConflict, "already exists")
+		problem.Type = "https://example.com/problems/duplicate"
+		problem.Extensions = map[string]any{"name": "alice", "title": "overridden"}
+
+		rec := httptest.NewRecorder()
+		Res(rec).Problem(problem)
+
+		must.Equal(http.StatusConflict, rec.Code)
+		must.Equal("application/problem+json", rec.Header().Get("Content-Type"))
+		body := map[string]any{}
+		must.Nil(json.Unmarshal(rec.Body.Bytes(), &body))
+		must.Equal(map[string]any{
+			"type":   "https://example.com/problems/duplicate",
+			"title":  "Conflict",
+			"status": float64(http.StatusConflict),
+			"detail": "already exists",
+			"name":   "alice",
+		}, body)
+	})
+
+	t.Run("status from response", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		Res(rec).Status(http.StatusBadGateway).Problem(Problem{Detail: "upstream down"})
+		must.Equal(http.StatusBadGateway, rec.Code)
+		must.Equal(`{"detail":"upstream down","status":502,"title":"Bad Gateway"}`, rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		Res(rec).Problem(Problem{})
+		must.Equal(http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		must := must.New(t)
+		must.Equal("gone for good", NewProblem(http.StatusGone, "gone for good").Error())
+		must.Equal("Gone", NewProblem(http.StatusGone, "").Error())
+	})
+}
+
+func TestErrorProblem(t *testing.T) {
+	must := must.New(t)
+	problem := NewProblem(http.StatusConflict, "taken")
+	must.Equal(problem, ErrorProblem(fmt.Errorf("create: %w", problem)))
+
+	bindErr := &BindError{Fields: []*FieldError{{Source: BindQuery, Key: "page", Err: errors.New("invalid")}}}
+	must.Equal(http.StatusBadRequest, ErrorProblem(bindErr).Status)
+
+	type signup struct {
+		Name string `json:"name" validate:"required"`
+	}
+	problem = ErrorProblem(validate.Struct(signup{}))
+	must.Equal(http.StatusUnprocessableEntity, problem.Status)
+	must.Equal([]map[string]string{{"field": "name", "rule": "required", "detail": "is required"}}, problem.Extensions["errors"])
+
+	problem = ErrorProblem(errors.New("database is down"))
+	must.Equal(http.StatusInternalServerError, problem.Status)
+	must.Equal("", problem.Detail)
+}
@@ -0,0 +1,230 @@
+package ngamux
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// forwardedElement is one comma separated element of an RFC 7239
+// Forwarded header, i.e. the parameters added by a single proxy.
+type forwardedElement map[string]string
+
+// parseForwarded parses every Forwarded header line of h into its
+// elements, ordered from the client towards the server.
+func parseForwarded(h http.Header) []forwardedElement {
+	values := h.Values("Forwarded")
+	if len(values) == 0 {
+		return nil
+	}
+
+	elements := []forwardedElement{}
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			parsed := forwardedElement{}
+			for _, pair := range splitQuoted(element, ';') {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				v = strings.TrimSpace(v)
+				if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+					v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+				}
+				parsed[strings.ToLower(strings.TrimSpace(k))] = v
+			}
+			elements = append(elements, parsed)
+		}
+	}
+	return elements
+}
+
+// splitQuoted splits s on sep, ignoring separators inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseNodeAddr parses a node address as found in RemoteAddr, X-Real-Ip,
+// X-Forwarded-For or a Forwarded "for" parameter. Ports, IPv6 brackets
+// and IPv4-mapped IPv6 forms are accepted. Obfuscated identifiers such as
+// "unknown" or "_hidden" yield an invalid netip.Addr.
+func parseNodeAddr(s string) netip.Addr {
+	s = strings.TrimSpace(s)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedChain returns the client addresses recorded by proxies in
+// header, the one trusted proxies write, from the original client
+// towards the server. Other forwarding headers are ignored, as clients
+// could set them freely. An empty header means X-Forwarded-For.
+func forwardedChain(h http.Header, header string) []string {
+	switch http.CanonicalHeaderKey(header) {
+	case "Forwarded":
+		elements := parseForwarded(h)
+		chain := make([]string, 0, len(elements))
+		for _, element := range elements {
+			chain = append(chain, element["for"])
+		}
+		return chain
+	case "X-Real-Ip":
+		if realIP := h.Get("X-Real-Ip"); realIP != "" {
+			return []string{realIP}
+		}
+		return nil
+	}
+
+	chain := []string{}
+	for _, value := range h.Values("X-Forwarded-For") {
+		chain = append(chain, strings.Split(value, ",")...)
+	}
+	return chain
+}
+
+// resolveClientIP walks the forwarding chain from the right, starting at
+// the direct peer, and returns the first address that is not a trusted
+// proxy. When every hop is trusted the left-most one is returned. A
+// malformed hop stops the walk at the last trusted address, since
+// nothing beyond it can be believed. Only header is read, see
+// forwardedChain.
+func resolveClientIP(r *http.Request, trusted []netip.Prefix, header string) netip.Addr {
+	current := parseNodeAddr(r.RemoteAddr)
+	if !isTrustedProxy(current, trusted) {
+		return current
+	}
+
+	chain := forwardedChain(r.Header, header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := parseNodeAddr(chain[i])
+		if !addr.IsValid() {
+			return current
+		}
+		current = addr
+		if !isTrustedProxy(current, trusted) {
+			return current
+		}
+	}
+	return current
+}
+
+// trustedHops returns the Forwarded elements appended by trusted
+// proxies, ordered from the right-most (closest to the server) to the
+// left-most believable one. The walk stops after the first element whose
+// "for" parameter is not a trusted proxy, as that element was written by
+// the outermost trusted proxy on behalf of the client. It returns nil
+// when the direct peer is not a trusted proxy.
+func trustedHops(r *http.Request, trusted []netip.Prefix) []forwardedElement {
+	if !isTrustedProxy(parseNodeAddr(r.RemoteAddr), trusted) {
+		return nil
+	}
+
+	elements := parseForwarded(r.Header)
+	hops := []forwardedElement{}
+	for i := len(elements) - 1; i >= 0; i-- {
+		hops = append(hops, elements[i])
+		if !isTrustedProxy(parseNodeAddr(elements[i]["for"]), trusted) {
+			break
+		}
+	}
+	return hops
+}
+
+// lastListValue returns the right-most member of a comma separated
+// header, which is the one written by the nearest proxy.
+func lastListValue(h http.Header, key string) string {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	members := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(members[len(members)-1])
+}
+
+func validScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+func validHost(host string) bool {
+	if host == "" || strings.ContainsAny(host, "/\\?#@ \t") {
+		return false
+	}
+	_, err := url.Parse("http://" + host)
+	return err == nil
+}
+
+// resolveSchemeHost returns the scheme and host the client used to reach
+// the outermost trusted proxy. When header, the header trusted proxies
+// write, is Forwarded, its proto and host parameters are used;
+// otherwise X-Forwarded-Proto and X-Forwarded-Host are. Without a
+// trusted peer, or when nothing usable was forwarded, the connection's
+// own TLS state and Host header are used.
+func resolveSchemeHost(r *http.Request, trusted []netip.Prefix, header string) (string, string) {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if !isTrustedProxy(parseNodeAddr(r.RemoteAddr), trusted) {
+		return scheme, host
+	}
+
+	if http.CanonicalHeaderKey(header) == "Forwarded" {
+		for _, hop := range trustedHops(r, trusted) {
+			if proto := hop["proto"]; validScheme(proto) {
+				scheme = strings.ToLower(proto)
+			}
+			if h := hop["host"]; validHost(h) {
+				host = h
+			}
+		}
+		return scheme, host
+	}
+
+	if proto := lastListValue(r.Header, "X-Forwarded-Proto"); validScheme(proto) {
+		scheme = strings.ToLower(proto)
+	}
+	if h := lastListValue(r.Header, "X-Forwarded-Host"); validHost(h) {
+		host = h
+	}
+	return scheme, host
+}
@@ -0,0 +1,239 @@
+package ngamux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestParseForwarded(t *testing.T) {
+	must := must.New(t)
+	h := http.Header{}
+	h.Add("Forwarded", `for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`)
+	h.Add("Forwarded", `For="198.51.100.1";host="example.com;x"`)
+
+	result := parseForwarded(h)
+	must.Equal(3, len(result))
+	must.Equal("192.0.2.60", result[0]["for"])
+	must.Equal("http", result[0]["proto"])
+	must.Equal("[2001:db8:cafe::17]:4711", result[1]["for"])
+	must.Equal("198.51.100.1", result[2]["for"])
+	must.Equal("example.com;x", result[2]["host"])
+}
+
+func TestParseNodeAddr(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.1:8080", "192.0.2.1"},
+		{" 2001:db8::1 ", "2001:db8::1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"unknown", "invalid IP"},
+		{"_hidden", "invalid IP"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			must.Equal(t, tC.expected, parseNodeAddr(tC.input).String())
+		})
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+	testCases := []struct {
+		desc        string
+		proxyHeader string
+		remoteAddr  string
+		header      http.Header
+		expected    string
+	}{
+		{"direct client", "", "203.0.113.9:5000", nil, "203.0.113.9"},
+		{
+			"untrusted peer headers are ignored", "", "203.0.113.9:5000",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}, "X-Real-Ip": {"1.1.1.1"}},
+			"203.0.113.9",
+		},
+		{
+			"x-forwarded-for walked from the right", "X-Forwarded-For", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-For": {"6.6.6.6, 198.51.100.7", "10.0.0.2"}},
+			"198.51.100.7",
+		},
+		{
+			"all hops trusted", "", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			"10.0.0.3",
+		},
+		{
+			"malformed hop stops the walk", "", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-For": {"198.51.100.7, garbage, 10.0.0.2"}},
+			"10.0.0.2",
+		},
+		{
+			"forwarded spoofed by the client is ignored", "X-Forwarded-For", "10.0.0.1:5000",
+			http.Header{
+				"Forwarded":       {"for=1.2.3.4"},
+				"X-Real-Ip":       {"1.2.3.4"},
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			"198.51.100.7",
+		},
+		{
+			"forwarded", "Forwarded", "[2001:db8:ffff::1]:443",
+			http.Header{
+				"Forwarded":       {`for=192.0.2.60, for="[2001:db8:ffff::2]:80"`},
+				"X-Forwarded-For": {"6.6.6.6"},
+			},
+			"192.0.2.60",
+		},
+		{
+			"x-forwarded-for spoofed by the client is ignored", "Forwarded", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-For": {"6.6.6.6"}},
+			"10.0.0.1",
+		},
+		{
+			"x-real-ip from trusted peer", "x-real-ip", "10.0.0.1:5000",
+			http.Header{"X-Real-Ip": {"198.51.100.7"}, "X-Forwarded-For": {"6.6.6.6"}},
+			"198.51.100.7",
+		},
+		{"no port", "", "10.0.0.1", nil, "10.0.0.1"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tC.remoteAddr
+			for k, v := range tC.header {
+				req.Header[k] = v
+			}
+			must.Equal(t, tC.expected, resolveClientIP(req, trusted, tC.proxyHeader).String())
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	must := must.New(t)
+	mux := New(WithLogLevel(LogLevelQuiet), WithTrustedProxies("10.0.0.0/8"))
+
+	var result netip.Addr
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		result = Req(r).ClientIP()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	must.Equal(netip.MustParseAddr("198.51.100.7"), result)
+
+	// without router configuration nothing is trusted
+	must.Equal(netip.MustParseAddr("10.1.2.3"), Req(req).ClientIP())
+}
+
+func TestResolveSchemeHost(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	testCases := []struct {
+		desc        string
+		proxyHeader string
+		remoteAddr  string
+		header      http.Header
+		scheme      string
+		host        string
+	}{
+		{"direct", "", "203.0.113.9:5000", nil, "http", "example.com"},
+		{
+			"untrusted peer headers are ignored", "", "203.0.113.9:5000",
+			http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.com"}},
+			"http", "example.com",
+		},
+		{
+			"x-forwarded headers", "", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"api.example.org"}},
+			"https", "api.example.org",
+		},
+		{
+			"x-forwarded right-most value", "", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-Proto": {"http, HTTPS"}},
+			"https", "example.com",
+		},
+		{
+			"invalid values are ignored", "", "10.0.0.1:5000",
+			http.Header{"X-Forwarded-Proto": {"javascript"}, "X-Forwarded-Host": {"evil.com/path"}},
+			"http", "example.com",
+		},
+		{
+			"forwarded ignored without proxy header", "X-Forwarded-For", "10.0.0.1:5000",
+			http.Header{"Forwarded": {"for=198.51.100.7;proto=https;host=evil.com"}},
+			"http", "example.com",
+		},
+		{
+			"forwarded from outermost trusted proxy", "Forwarded", "10.0.0.1:5000",
+			http.Header{
+				"Forwarded": {
+					`for=6.6.6.6;proto=http;host=evil.com, for=198.51.100.7;proto=https;host=shop.example, for=10.0.0.2;proto=http`,
+				},
+				"X-Forwarded-Host": {"evil.com"},
+			},
+			"https", "shop.example",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			must := must.New(t)
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = tC.remoteAddr
+			for k, v := range tC.header {
+				req.Header[k] = v
+			}
+			scheme, host := resolveSchemeHost(req, trusted, tC.proxyHeader)
+			must.Equal(tC.scheme, scheme)
+			must.Equal(tC.host, host)
+		})
+	}
+
+	t.Run("tls", func(t *testing.T) {
+		must := must.New(t)
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		scheme, _ := resolveSchemeHost(req, trusted, "")
+		must.Equal("https", scheme)
+	})
+}
+
+func TestRequestURLBuilding(t *testing.T) {
+	must := must.New(t)
+	mux := New(WithLogLevel(LogLevelQuiet), WithTrustedProxies("10.0.0.0/8"))
+
+	var scheme, host, base, absolute, relative string
+	mux.Get("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		req := Req(r)
+		scheme = req.Scheme()
+		host = req.OriginalHost()
+		base = req.BaseURL().String()
+		absolute = req.AbsoluteURL("/login?next=1")
+		relative = req.AbsoluteURL("edit")
+		Res(rw).Status(http.StatusSeeOther).Redirect(r, "/login")
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://internal:8080/users/1", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	mux.ServeHTTP(rec, req)
+
+	must.Equal("https", scheme)
+	must.Equal("example.com", host)
+	must.Equal("https://example.com", base)
+	must.Equal("https://example.com/login?next=1", absolute)
+	must.Equal("https://example.com/users/edit", relative)
+	must.Equal(http.StatusSeeOther, rec.Code)
+	must.Equal("https://example.com/login", rec.Header().Get("Location"))
+}
@@ -0,0 +1,28 @@
+// Package realip provides a middleware that rewrites the request's
+// RemoteAddr to the originating client address, as resolved by
+// ngamux.Request.ClientIP from the router's trusted proxies and the
+// forwarding header they write, Config.ProxyHeader.
+//
+// Handlers and middlewares further down the chain, including ones that
+// know nothing about ngamux, then see the real client in RemoteAddr.
+package realip
+
+import (
+	"net/http"
+
+	"github.com/ngamux/ngamux"
+)
+
+// New returns a middleware that replaces r.RemoteAddr with the client
+// address resolved from trusted forwarding headers. The port is dropped
+// because it belongs to the last proxy, not the client.
+func New() ngamux.MiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			if addr := ngamux.Req(r).ClientIP(); addr.IsValid() {
+				r.RemoteAddr = addr.String()
+			}
+			next(rw, r)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+)
+
+func TestNew(t *testing.T) {
+	must := must.New(t)
+	mux := ngamux.New(ngamux.WithLogLevel(ngamux.LogLevelQuiet), ngamux.WithTrustedProxies("10.0.0.0/8"))
+	mux.Use(New())
+
+	var result string
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		result = r.RemoteAddr
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 198.51.100.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	must.Equal("198.51.100.7", result)
+
+	// Headers the trusted proxies do not write are not believed.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Forwarded", "for=1.2.3.4")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	must.Equal("198.51.100.7", result)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	must.Equal("203.0.113.1", result)
+}
@@ -1,21 +1,23 @@
 package ngamux
 
 import (
-	"context"
-	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"reflect"
-	"strconv"
 	"strings"
 
+	"github.com/ngamux/ngamux/auth"
+	"github.com/ngamux/ngamux/internal/convert"
 	"github.com/ngamux/ngamux/json"
+	"github.com/ngamux/ngamux/session"
+	"github.com/ngamux/ngamux/validate"
 )
 
 var (
-	errUnsupportedFieldType = errors.New("unsupported field type")
+	errUnsupportedFieldType = convert.ErrUnsupportedType
 )
 
 // Request define single request manager
@@ -53,87 +55,23 @@ func (r Request) Query(key string, fallback ...string) string {
 	return query
 }
 
-// Parse query into struct
+// QueriesParser fills the struct pointed to by data from the query
+// values named by its query tags.
+//
+// Fields may be strings, booleans, numbers of any width, time.Duration,
+// time.Time (parsed with the layout tag, RFC 3339 by default) or any
+// encoding.TextUnmarshaler. Pointers are allocated for present values
+// only, and slices are filled from repeated keys. Nested structs are
+// filled from keys such as filter[status] or filter.status, or from a
+// single URL-encoded value. Absent values are taken from the default
+// tag, comma-separated for slices, when the field is still zero.
+//
+// Every rejected value is reported in a *BindError.
 func (r Request) QueriesParser(data any) error {
-	queryValues := r.URL.Query()
-
 	val := reflect.ValueOf(data).Elem()
-	typ := val.Type()
-
-	for i := 0; i < val.NumField(); i++ {
-		field := typ.Field(i)
-		tag := field.Tag.Get("query")
-		if tag != "" {
-			if queryValue, found := queryValues[tag]; found && len(queryValue) > 0 {
-				fieldValue := val.Field(i)
-				if fieldValue.CanSet() {
-					if err := setFieldValue(fieldValue, queryValue[0]); err != nil {
-						return err
-					}
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
-func setFieldValue(fieldValue reflect.Value, value string) error {
-	switch fieldValue.Kind() {
-	case reflect.Int:
-		intValue, err := strconv.Atoi(value)
-		if err != nil {
-			return err
-		}
-		fieldValue.SetInt(int64(intValue))
-	case reflect.String:
-		fieldValue.SetString(value)
-	case reflect.Bool:
-		boolValue, err := strconv.ParseBool(value)
-		if err != nil {
-			return err
-		}
-		fieldValue.SetBool(boolValue)
-	case reflect.Float32, reflect.Float64:
-		floatValue, err := strconv.ParseFloat(value, fieldValue.Type().Bits())
-		if err != nil {
-			return err
-		}
-		fieldValue.SetFloat(floatValue)
-	case reflect.Struct:
-		nestedStruct := reflect.New(fieldValue.Type()).Elem()
-		if err := parseNestedStruct(nestedStruct, value); err != nil {
-			return err
-		}
-		fieldValue.Set(nestedStruct)
-	default:
-		return errUnsupportedFieldType
-	}
-	return nil
-}
-
-func parseNestedStruct(nestedStruct reflect.Value, value string) error {
-	queryValues, err := url.ParseQuery(value)
-	if err != nil {
-		return err
-	}
-
-	typ := nestedStruct.Type()
-	for i := 0; i < nestedStruct.NumField(); i++ {
-		field := typ.Field(i)
-		tag := field.Tag.Get("query")
-		if tag != "" {
-			if queryValue, found := queryValues[tag]; found && len(queryValue) > 0 {
-				fieldValue := nestedStruct.Field(i)
-				if fieldValue.CanSet() {
-					if err := setFieldValue(fieldValue, queryValue[0]); err != nil {
-						return err
-					}
-				}
-			}
-		}
+	if errs := decodeValues(val, r.URL.Query(), BindQuery); len(errs) > 0 {
+		return &BindError{Fields: errs}
 	}
-
 	return nil
 }
 
@@ -150,7 +88,9 @@ func (r Request) FormValue(key string, fallback ...string) string {
 	return value
 }
 
-// FormFile returns file from form using a key
+// FormFile returns file from form using a key. The whole form is parsed
+// first, with files over maxFileSize, 10MB by default, spilled to
+// temporary files. Use Multipart to stream large files instead.
 func (r Request) FormFile(key string, maxFileSize ...int64) (*multipart.FileHeader, error) {
 	var maxFileSizeParsed int64 = 10 << 20
 	if len(maxFileSize) > 0 {
@@ -173,53 +113,172 @@ func (r Request) FormFile(key string, maxFileSize ...int64) (*multipart.FileHead
 	return header, nil
 }
 
-// JSON get json data from request body and store to variable reference
-func (r Request) JSON(store any) error {
-	rBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		return err
-	}
+// JSON get json data from request body and store to variable reference.
+// It is validated when the router has a Validator.
+//
+// Without options the body is read whole and decoded with the router's
+// JSON codec. Given options, it is decoded as a stream and
+// rejected bodies are reported as a *JSONError.
+func (r Request) JSON(store any, options ...JSONOptions) error {
+	if len(options) > 0 {
+		if err := decodeJSON(r.Request, store, options[0]); err != nil {
+			return err
+		}
+	} else {
+		rBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
 
-	err = json.Unmarshal(rBody, &store)
-	if err != nil {
-		return err
+		err = r.JSONCodec().Unmarshal(rBody, store)
+		if err != nil {
+			return err
+		}
 	}
 
+	if validator := configFromRequest(r.Request).Validator; validator != nil {
+		return validator.Struct(store)
+	}
 	return nil
 }
 
+// JSONCodec returns the JSON codec of the router serving the request.
+func (r Request) JSONCodec() json.Codec {
+	return configFromRequest(r.Request).JSONCodec()
+}
+
+// Validate checks v against its validate tags with the router's
+// Validator, or validate.Default when none is configured. It returns
+// validate.Errors listing the broken rules, or nil.
+func (r Request) Validate(v any) error {
+	if validator := configFromRequest(r.Request).Validator; validator != nil {
+		return validator.Struct(v)
+	}
+	return validate.Struct(v)
+}
+
 // Locals needs key and optional value
-// It returns any if only key and no value given
-// It insert value to context if key and value is given
+// It returns any if only key and no value given, looking in the request
+// locals and then in the context
+// It stores value in the request locals if key and value is given
+//
+// The locals are created once by the router and shared by every
+// middleware and handler serving the request, so values set here are
+// visible downstream without passing a new request along. See also
+// Local and SetLocal.
 func (r *Request) Locals(key any, value ...any) any {
+	l, ok := r.Context().Value(KeyContextLocals).(*locals)
 	if len(value) <= 0 {
+		if ok {
+			if v, found := l.get(key); found {
+				return v
+			}
+		}
 		return r.Context().Value(key)
 	}
-	r.Request = r.WithContext(context.WithValue(r.Context(), key, value[0]))
+	if !ok {
+		// Not served by a router: keep the locals with this wrapper.
+		r.Request = withLocals(r.Request)
+		l = r.Context().Value(KeyContextLocals).(*locals)
+	}
+	l.set(key, value[0])
 	return nil
 }
 
+// CSPNonce returns the Content-Security-Policy nonce generated for this
+// request, or an empty string when none was generated.
+func (r Request) CSPNonce() string {
+	nonce, _ := r.Context().Value(KeyContextCSPNonce).(string)
+	return nonce
+}
+
+// CSRFToken returns the CSRF token to embed in forms or send back in a
+// request header, or an empty string when the csrf middleware is not in
+// use.
+func (r Request) CSRFToken() string {
+	token, _ := r.Context().Value(KeyContextCSRFToken).(string)
+	return token
+}
+
+// Session returns the session loaded by the session middleware, or nil
+// when the middleware is not in use.
+func (r Request) Session() *session.Session {
+	return session.FromContext(r.Context())
+}
+
+// Principal returns the caller authenticated by one of the auth
+// middlewares, or nil when the request is not authenticated.
+func (r Request) Principal() *auth.Principal {
+	return auth.FromContext(r.Context())
+}
+
 // IsLocalhost returns true if hostname is localhost or 127.0.0.1
 func (r *Request) IsLocalhost() bool {
 	return strings.Contains(r.Host, "localhost") || strings.Contains(r.Host, "127.0.0.1")
 }
 
-// Get Client IP
-func (r Request) GetIPAdress() string {
+// ClientIP returns the address of the client that originated the
+// request. The forwarding header named by the router's
+// Config.ProxyHeader is only believed when the direct peer is listed in
+// Config.TrustedProxies, and the chain is walked from the right so a
+// client cannot spoof its address by prepending entries. The result is
+// invalid when RemoteAddr cannot be parsed.
+func (r Request) ClientIP() netip.Addr {
+	config := configFromRequest(r.Request)
+	return resolveClientIP(r.Request, config.TrustedProxies, config.ProxyHeader)
+}
 
-	var ipAddress string
+// Scheme returns the URL scheme, "http" or "https", the client used for
+// the original request. X-Forwarded-Proto, or the RFC 7239 Forwarded
+// "proto" parameter when Config.ProxyHeader is Forwarded, is only
+// believed from the router's trusted proxies.
+func (r Request) Scheme() string {
+	scheme, _ := r.schemeHost()
+	return scheme
+}
 
-	// X-Real-Ip - fetches first true IP (if the requests sits behind multiple NAT sources/load balancer
-	ipAddress = r.Header.Get("X-Real-Ip")
-	if ipAddress == "" {
-		// X-Forwarded-For - if for some reason X-Real-Ip is blank and does not return response, get from X-Forwarded-For
-		ipAddress = r.Header.Get("X-Forwarded-For")
-	}
+// OriginalHost returns the host, and optional port, the client used for
+// the original request. X-Forwarded-Host, or the RFC 7239 Forwarded
+// "host" parameter when Config.ProxyHeader is Forwarded, is only believed
+// from the router's trusted proxies.
+func (r Request) OriginalHost() string {
+	_, host := r.schemeHost()
+	return host
+}
 
-	if ipAddress == "" {
-		// Remote Address - last resort (usually won't be reliable as this might be the last ip or if it is a naked http request to server ie no load balancer)
-		ipAddress = r.RemoteAddr
+func (r Request) schemeHost() (string, string) {
+	config := configFromRequest(r.Request)
+	return resolveSchemeHost(r.Request, config.TrustedProxies, config.ProxyHeader)
+}
+
+// BaseURL returns the scheme and host the client used to reach the
+// application, e.g. https://example.com, as a URL with an empty path.
+func (r Request) BaseURL() *url.URL {
+	scheme, host := r.schemeHost()
+	return &url.URL{Scheme: scheme, Host: host}
+}
+
+// AbsoluteURL resolves ref, typically an application path such as
+// "/users/1", against BaseURL and the current request path and returns
+// the resulting absolute URL. References that are already absolute are
+// returned unchanged.
+func (r Request) AbsoluteURL(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
 	}
+	base := r.BaseURL()
+	base.Path = r.URL.Path
+	return base.ResolveReference(u).String()
+}
 
-	return ipAddress
+// GetIPAdress returns the client address as a string.
+//
+// Deprecated: use ClientIP, which returns a netip.Addr.
+func (r Request) GetIPAdress() string {
+	addr := r.ClientIP()
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
 }
@@ -9,10 +9,13 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/auth"
+	"github.com/ngamux/ngamux/session"
 )
 
 func TestReq(t *testing.T) {
@@ -123,6 +126,102 @@ func TestLocals(t *testing.T) {
 	must.Nil(slug)
 }
 
+func TestLocalsDownstream(t *testing.T) {
+	must := must.New(t)
+	mux := New()
+	mux.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			// The wrapper is dropped: the value must still reach next.
+			Req(r).Locals("user", "gandalf")
+			SetLocal(r, KeyID, 7)
+			next(rw, r)
+			id, _ := Local[int](r, KeyID)
+			rw.Header().Set("X-ID", strconv.Itoa(id))
+		}
+	})
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		user, ok := Local[string](r, "user")
+		must.True(ok)
+		must.Equal("gandalf", user)
+		_, ok = Local[string](r, KeyID)
+		must.False(ok)
+		_, ok = Local[string](r, "missing")
+		must.False(ok)
+
+		// Writes are visible upstream too.
+		SetLocal(r, KeyID, 8)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), Key("from-context"), "yes"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	must.Equal("8", rec.Header().Get("X-ID"))
+
+	// HttpServeMux shares the locals the same way.
+	serveMux := NewHttpServeMux()
+	serveMux.Use(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			SetLocal(r, KeyID, 9)
+			next(rw, r)
+		}
+	})
+	var fromServeMux int
+	serveMux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		fromServeMux, _ = Local[int](r, KeyID)
+	})
+	serveMux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	must.Equal(9, fromServeMux)
+
+	// Context values are read when no local is set.
+	r := withLocals(req)
+	value, ok := Local[string](r, Key("from-context"))
+	must.True(ok)
+	must.Equal("yes", value)
+}
+
+func TestSession(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	must.Nil(Req(req).Session())
+
+	session.New(session.NewMemoryStore())(func(rw http.ResponseWriter, r *http.Request) {
+		Req(r).Session().Set("id", 1)
+		must.Equal(1, Req(r).Session().Get("id"))
+	})(httptest.NewRecorder(), req)
+
+	// The session cookie is Secure when a trusted proxy terminated TLS.
+	mux := New(WithTrustedProxies("10.0.0.0/8"))
+	config := session.NewConfig()
+	config.Scheme = func(r *http.Request) string { return Req(r).Scheme() }
+	mux.Use(session.New(session.NewMemoryStore(), config))
+	mux.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+		Req(r).Session().Set("id", 1)
+	})
+	for _, tc := range []struct {
+		remoteAddr string
+		secure     bool
+	}{{"10.0.0.1:1234", true}, {"192.0.2.1:1234", false}} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		cookies := rec.Result().Cookies()
+		must.Equal(1, len(cookies))
+		must.Equal(tc.secure, cookies[0].Secure)
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	must.Nil(Req(req).Principal())
+
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{Subject: "alice"}))
+	must.Equal("alice", Req(req).Principal().Subject)
+}
+
 func TestIsLocalhost(t *testing.T) {
 	must := must.New(t)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
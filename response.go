@@ -1,9 +1,12 @@
 package ngamux
 
 import (
+	"bytes"
 	"html/template"
 	"maps"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/ngamux/ngamux/json"
 )
@@ -12,13 +15,38 @@ import (
 type Response struct {
 	http.ResponseWriter
 	status int
+	// request is the request given to Res or ETag.
+	request *http.Request
+	etag    bool
+	weak    bool
+	config  *Config
 }
 
-// Res needs http.ResponseWriter and returns *Response object
-func Res(rw http.ResponseWriter) *Response {
-	return &Response{
+// Res needs http.ResponseWriter and returns *Response object. Given the
+// request being answered, the response uses the configuration of the
+// router serving it, such as its JSON codec, and Encode follows its
+// Accept header.
+func Res(rw http.ResponseWriter, req ...*http.Request) *Response {
+	res := &Response{
 		ResponseWriter: rw,
 	}
+	if len(req) > 0 && req[0] != nil {
+		res.request = req[0]
+		res.config = configFromRequest(req[0])
+	}
+	return res
+}
+
+// jsonCodec returns the JSON codec of the router serving the request
+// given to Res or ETag, else json.Default.
+func (r *Response) jsonCodec() json.Codec {
+	switch {
+	case r.config != nil:
+		return r.config.JSONCodec()
+	case r.request != nil:
+		return configFromRequest(r.request).JSONCodec()
+	}
+	return json.Default()
 }
 
 func (r Response) statusSafe() int {
@@ -36,38 +64,143 @@ func (r *Response) Status(status int) *Response {
 	return r
 }
 
+// ETag enables entity tag generation for the body written by Text, JSON
+// and HTML. The tag is computed from the rendered body, strong by
+// default or weak when weak is true, and the conditional headers of req
+// are evaluated against it so that a 304 Not Modified or 412
+// Precondition Failed is sent instead of the body when appropriate.
+//
+// A Last-Modified header already set on the response takes part in the
+// evaluation as well. Conditions are only evaluated for GET and HEAD
+// requests with a 2xx status; other responses just carry the ETag.
+func (r *Response) ETag(req *http.Request, weak ...bool) *Response {
+	r.request = req
+	r.etag = true
+	r.weak = len(weak) > 0 && weak[0]
+	return r
+}
+
+// send writes body with the given headers, applying ETag handling when
+// it was requested.
+func (r *Response) send(header http.Header, body []byte) {
+	maps.Copy(r.Header(), header)
+	status := r.statusSafe()
+
+	if r.etag && status >= 200 && status < 300 {
+		etag := GenerateETag(body, r.weak)
+		r.Header().Set("ETag", etag)
+
+		if r.request.Method == http.MethodGet || r.request.Method == http.MethodHead {
+			var lastModified time.Time
+			if lm := r.Header().Get("Last-Modified"); lm != "" {
+				lastModified, _ = http.ParseTime(lm)
+			}
+			if code := CheckPreconditions(r.request, etag, lastModified); code != 0 {
+				WriteConditional(r, code)
+				return
+			}
+		}
+	}
+
+	r.WriteHeader(status)
+	_, _ = r.Write(body)
+}
+
+// Redirect replies to req with a redirect to location. Relative
+// locations are made absolute with the scheme and host the client
+// originally used (see Request.AbsoluteURL), so redirects stay correct
+// behind trusted reverse proxies. The status defaults to 302 Found
+// unless a 3xx status was set with Status.
+func (r *Response) Redirect(req *http.Request, location string) {
+	status := r.status
+	if status < 300 || status >= 400 {
+		status = http.StatusFound
+	}
+
+	r.Header().Set("Location", Req(req).AbsoluteURL(location))
+	r.WriteHeader(status)
+}
+
 // Text writes text/plain data with simple string as response body
 func (r *Response) Text(data string) {
-	r.WriteHeader(r.statusSafe())
-	maps.Copy(r.Header(), headerContentTypeText)
-	_, _ = r.Write([]byte(data))
+	r.send(headerContentTypeText, []byte(data))
 }
 
 // JSON write application/json data with json encoded string as response body
 func (r *Response) JSON(data any) {
-	b, err := json.Marshal(data)
+	b, err := r.jsonCodec().Marshal(data)
 	if err != nil {
 		http.Error(r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	maps.Copy(r.Header(), headerContentTypeJSON)
-	r.WriteHeader(r.statusSafe())
-	_, _ = r.Write(b)
+	r.send(headerContentTypeJSON, b)
 }
 
-// HTML write text/html data with HTML string as response body
-func (r *Response) HTML(path string, data any) {
-	r.WriteHeader(r.statusSafe())
-	r.Header().Set("Content-Type", "text/html; charset=utf-8")
+// TemplateFuncProvider is implemented by http.ResponseWriter wrappers
+// that expose per-request helpers, such as a CSP nonce, to templates
+// rendered with Response.HTML. Providers are found by following the
+// Unwrap chain of the response writer.
+type TemplateFuncProvider interface {
+	TemplateFuncs() template.FuncMap
+}
+
+// templateFuncs returns the functions of the providers wrapped by rw,
+// over defaults that keep templates parsing without them: cspNonce and
+// csrfToken return the nonce and token of req, or an empty string, and
+// csrfField an empty hidden field.
+func templateFuncs(rw http.ResponseWriter, req *http.Request) template.FuncMap {
+	nonce, token := "", ""
+	if req != nil {
+		nonce, token = Req(req).CSPNonce(), Req(req).CSRFToken()
+	}
+	funcs := template.FuncMap{}
+	for rw != nil {
+		if provider, ok := rw.(TemplateFuncProvider); ok {
+			for name, fn := range provider.TemplateFuncs() {
+				if _, exists := funcs[name]; !exists {
+					funcs[name] = fn
+				}
+			}
+		}
 
-	temp, err := template.ParseFiles(path)
+		unwrapper, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		rw = unwrapper.Unwrap()
+	}
+	defaults := template.FuncMap{
+		"cspNonce":  func() string { return nonce },
+		"csrfToken": func() string { return token },
+		"csrfField": func() template.HTML { return `<input type="hidden">` },
+	}
+	for name, fn := range defaults {
+		if _, exists := funcs[name]; !exists {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// HTML write text/html data with HTML string as response body.
+// Functions exposed by middlewares through TemplateFuncProvider are
+// available to the template, and {{cspNonce}}, {{csrfToken}} and
+// {{csrfField}} always are: without their middleware they fall back to
+// the request given to Res, or to empty values.
+func (r *Response) HTML(path string, data any) {
+	temp, err := template.New(filepath.Base(path)).Funcs(templateFuncs(r.ResponseWriter, r.request)).ParseFiles(path)
 	if err != nil {
+		r.WriteHeader(r.statusSafe())
 		return
 	}
 
-	err = temp.Execute(r, data)
+	buf := &bytes.Buffer{}
+	err = temp.Execute(buf, data)
 	if err != nil {
+		r.WriteHeader(r.statusSafe())
 		return
 	}
+
+	r.send(headerContentTypeHTML, buf.Bytes())
 }
@@ -1,6 +1,8 @@
 package ngamux
 
 import (
+	"context"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -88,6 +90,122 @@ func TestResHtml(t *testing.T) {
 	})
 }
 
+func TestResETag(t *testing.T) {
+	t.Run("sets etag", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		Res(rec).ETag(req).JSON(Map{"id": 1})
+
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal(GenerateETag([]byte(`{"id":1}`), false), rec.Header().Get("ETag"))
+		must.Equal(`{"id":1}`, rec.Body.String())
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", GenerateETag([]byte("ok"), true))
+		Res(rec).ETag(req, true).Text("ok")
+
+		must.Equal(http.StatusNotModified, rec.Code)
+		must.Equal("", rec.Header().Get("Content-Type"))
+		must.Equal("", rec.Body.String())
+	})
+
+	t.Run("precondition failed", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-Match", `"other"`)
+		Res(rec).ETag(req).Text("ok")
+
+		must.Equal(http.StatusPreconditionFailed, rec.Code)
+	})
+
+	t.Run("error status is not evaluated", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", "*")
+		Res(rec).ETag(req).Status(http.StatusNotFound).Text("not found")
+
+		must.Equal(http.StatusNotFound, rec.Code)
+		must.Equal("", rec.Header().Get("ETag"))
+		must.Equal("not found", rec.Body.String())
+	})
+
+	t.Run("html", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		Res(rec).ETag(req).HTML("./response_test.html", nil)
+
+		must.NotEqual("", rec.Header().Get("ETag"))
+		must.Equal("text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	})
+}
+
+func TestResRedirect(t *testing.T) {
+	t.Run("default status", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		Res(rec).Redirect(req, "/b")
+
+		must.Equal(http.StatusFound, rec.Code)
+		must.Equal("http://example.com/b", rec.Header().Get("Location"))
+	})
+
+	t.Run("absolute location", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		Res(rec).Status(http.StatusPermanentRedirect).Redirect(req, "https://other.example/")
+
+		must.Equal(http.StatusPermanentRedirect, rec.Code)
+		must.Equal("https://other.example/", rec.Header().Get("Location"))
+	})
+}
+
+type funcsWriter struct {
+	http.ResponseWriter
+}
+
+func (funcsWriter) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{"greet": func() string { return "hi" }}
+}
+
+func (w funcsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	must := must.New(t)
+	rec := httptest.NewRecorder()
+
+	funcs := templateFuncs(rec, nil)
+	must.Equal(3, len(funcs))
+	must.Equal("", funcs["cspNonce"].(func() string)())
+	must.Equal("", funcs["csrfToken"].(func() string)())
+	must.Equal(template.HTML(`<input type="hidden">`), funcs["csrfField"].(func() template.HTML)())
+
+	funcs = templateFuncs(struct{ http.ResponseWriter }{funcsWriter{rec}}, nil)
+	must.Equal(3, len(funcs))
+
+	funcs = templateFuncs(funcsWriter{funcsWriter{rec}}, nil)
+	must.Equal(4, len(funcs))
+	must.Equal("hi", funcs["greet"].(func() string)())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.WithValue(req.Context(), KeyContextCSPNonce, "abc")
+	ctx = context.WithValue(ctx, KeyContextCSRFToken, "xyz")
+	funcs = templateFuncs(rec, req.WithContext(ctx))
+	must.Equal("abc", funcs["cspNonce"].(func() string)())
+	must.Equal("xyz", funcs["csrfToken"].(func() string)())
+}
+
 func BenchmarkResponseJSON(b *testing.B) {
 	res := Res(httptest.NewRecorder())
 	data := Map{"data": "ok"}
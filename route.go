@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 type (
+	// Route describes a registered route. Routes reports the Method,
+	// Path, Handler and Policies of each route.
 	Route struct {
 		RawPath    string
 		Path       string
@@ -15,6 +18,9 @@ type (
 		Handler    http.HandlerFunc
 		Params     [][]string
 		URLMatcher *regexp.Regexp
+		// Policies lists the authorization policies declared with
+		// Require, outermost group first.
+		Policies []Policy
 	}
 
 	Node struct {
@@ -30,7 +36,27 @@ func (t *Ngamux) Handle(key string, handler http.Handler) {
 	if strings.HasPrefix(key, "/") {
 		key = "ALL " + key
 	}
-	t.handle(key, handler)
+	t.handle(key, handler, nil)
+}
+
+// Routes returns the routes registered on the router and its groups, in
+// registration order. Called on a group, it reports the whole tree.
+func (t *Ngamux) Routes() []Route {
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	return slices.Clone(root.routes)
+}
+
+// Policy describes the authorization policies of the route, or returns
+// an empty string when it has none.
+func (r Route) Policy() string {
+	names := make([]string, len(r.Policies))
+	for i, policy := range r.Policies {
+		names[i] = policy.String()
+	}
+	return strings.Join(names, " and ")
 }
 
 func splitMethodPath(path string) (string, string) {
@@ -43,8 +69,15 @@ func splitMethodPath(path string) (string, string) {
 	return method, path
 }
 
-func (t *Ngamux) handle(key string, handler http.Handler) {
+func (t *Ngamux) handle(key string, handler http.Handler, policies []Policy) {
 	method, key := splitMethodPath(key)
+	t.routes = append(t.routes, Route{
+		Path:     key,
+		Method:   method,
+		Handler:  ToHandlerFunc(handler),
+		Policies: policies,
+	})
+
 	current, ok := t.root.Get(method)
 	if !ok {
 		current = &Node{key: "", children: make(map[string]*Node)}
@@ -127,6 +160,7 @@ func (t Ngamux) Handler(r *http.Request) (http.Handler, string) {
 }
 
 func (t Ngamux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withLocals(withConfig(r, t.config))
 	handler, _ := t.Handler(r)
 	if handler != nil {
 		handler.ServeHTTP(w, r)
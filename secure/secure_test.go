@@ -0,0 +1,126 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+)
+
+func TestCSPString(t *testing.T) {
+	must := must.New(t)
+	csp := CSP{
+		DefaultSrc:              []string{"'self'"},
+		ScriptSrc:               []string{"'self'", "cdn.example.com"},
+		ScriptNonce:             true,
+		Directives:              map[string][]string{"sandbox": nil, "require-trusted-types-for": {"'script'"}},
+		UpgradeInsecureRequests: true,
+		ReportURI:               "/csp",
+	}
+
+	must.Equal(
+		"default-src 'self'; script-src 'self' cdn.example.com 'nonce-abc'; require-trusted-types-for 'script'; sandbox; upgrade-insecure-requests; report-uri /csp",
+		csp.String("abc"),
+	)
+	must.Equal(
+		"default-src 'self'; script-src 'self' cdn.example.com; require-trusted-types-for 'script'; sandbox; upgrade-insecure-requests; report-uri /csp",
+		csp.String(""),
+	)
+
+	// Nonce directives without sources start from default-src.
+	csp = CSP{DefaultSrc: []string{"'self'"}, ScriptNonce: true, StyleNonce: true}
+	must.Equal("default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'self' 'nonce-abc'", csp.String("abc"))
+	must.Equal("default-src 'self'", csp.String(""))
+	csp = CSP{DefaultSrc: []string{"'none'"}, ScriptNonce: true}
+	must.Equal("default-src 'none'; script-src 'nonce-abc'", csp.String("abc"))
+	must.Equal([]string{"'none'"}, csp.DefaultSrc)
+}
+
+func TestNew(t *testing.T) {
+	ok := func(rw http.ResponseWriter, r *http.Request) {}
+
+	t.Run("defaults", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New()(ok)(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+		h := rec.Header()
+		must.Equal("nosniff", h.Get("X-Content-Type-Options"))
+		must.Equal("DENY", h.Get("X-Frame-Options"))
+		must.Equal("strict-origin-when-cross-origin", h.Get("Referrer-Policy"))
+		must.Equal("same-origin", h.Get("Cross-Origin-Opener-Policy"))
+		must.Equal("same-origin", h.Get("Cross-Origin-Resource-Policy"))
+		must.Equal("", h.Get("Cross-Origin-Embedder-Policy"))
+		must.Equal("default-src 'self'; object-src 'none'; frame-ancestors 'none'; base-uri 'self'", h.Get("Content-Security-Policy"))
+		must.Equal("", h.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("hsts over https", func(t *testing.T) {
+		must := must.New(t)
+		config := NewConfig()
+		config.HSTSMaxAge = time.Hour
+		config.HSTSPreload = true
+		rec := httptest.NewRecorder()
+		New(config)(ok)(rec, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+
+		must.Equal("max-age=3600; includeSubDomains; preload", rec.Header().Get("Strict-Transport-Security"))
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		must := must.New(t)
+		rec := httptest.NewRecorder()
+		New(Config{CSP: &CSP{DefaultSrc: []string{"'none'"}, ReportOnly: true}})(ok)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.Equal("", rec.Header().Get("Content-Security-Policy"))
+		must.Equal("default-src 'none'", rec.Header().Get("Content-Security-Policy-Report-Only"))
+		must.Equal("", rec.Header().Get("X-Frame-Options"))
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		must := must.New(t)
+		config := Config{CSP: &CSP{ScriptSrc: []string{"'self'"}, ScriptNonce: true, StyleNonce: true}}
+
+		var nonce string
+		rec := httptest.NewRecorder()
+		New(config)(func(rw http.ResponseWriter, r *http.Request) {
+			nonce = ngamux.Req(r).CSPNonce()
+			ngamux.Res(rw).HTML("./testdata/nonce.html", "ok")
+		})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		must.NotEqual("", nonce)
+		must.Equal(
+			"script-src 'self' 'nonce-"+nonce+"'; style-src 'nonce-"+nonce+"'",
+			rec.Header().Get("Content-Security-Policy"),
+		)
+		must.Equal(`<script nonce="`+nonce+`"></script><p>ok</p>`, strings.TrimSpace(rec.Body.String()))
+
+		rec2 := httptest.NewRecorder()
+		New(config)(ok)(rec2, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.NotEqual(rec.Header().Get("Content-Security-Policy"), rec2.Header().Get("Content-Security-Policy"))
+	})
+
+	t.Run("nonce without provider", func(t *testing.T) {
+		must := must.New(t)
+		config := Config{CSP: &CSP{ScriptNonce: true}}
+
+		// A wrapper without Unwrap hides the nonce writer; the nonce of
+		// the request is used instead.
+		var nonce string
+		rec := httptest.NewRecorder()
+		New(config)(func(rw http.ResponseWriter, r *http.Request) {
+			nonce = ngamux.Req(r).CSPNonce()
+			ngamux.Res(struct{ http.ResponseWriter }{rw}, r).HTML("./testdata/nonce.html", "ok")
+		})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		must.Equal(`<script nonce="`+nonce+`"></script><p>ok</p>`, strings.TrimSpace(rec.Body.String()))
+
+		// Without the middleware the template still renders.
+		rec = httptest.NewRecorder()
+		ngamux.Res(rec).HTML("./testdata/nonce.html", "ok")
+		must.Equal(http.StatusOK, rec.Code)
+		must.Equal(`<script nonce=""></script><p>ok</p>`, strings.TrimSpace(rec.Body.String()))
+	})
+}
@@ -0,0 +1,149 @@
+// Package securecookie signs and encrypts cookie values so that they can
+// be handed to the client and trusted when they come back.
+//
+// A Codec is built from one or more secret keys. The first key is used
+// to sign and encrypt; every key is tried to verify and decrypt, so keys
+// can be rotated by prepending a new key and dropping the oldest once the
+// cookies it produced have expired. Signing and encryption use distinct
+// sub-keys derived from each secret with HMAC-SHA256.
+//
+// The cookie name is bound into every signature and ciphertext, so a
+// value issued for one cookie is rejected when replayed under another.
+package securecookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// MinKeyLength is the minimum length of a secret key.
+const MinKeyLength = 32
+
+var (
+	// ErrNoKeys is returned by New when no key is given.
+	ErrNoKeys = errors.New("securecookie: no keys")
+	// ErrShortKey is returned by New for keys shorter than MinKeyLength.
+	ErrShortKey = errors.New("securecookie: key shorter than 32 bytes")
+	// ErrMalformed is returned when a value is not in the expected format.
+	ErrMalformed = errors.New("securecookie: malformed value")
+	// ErrInvalidSignature is returned when no key verifies the signature,
+	// i.e. the value was tampered with or signed with an unknown key.
+	ErrInvalidSignature = errors.New("securecookie: invalid signature")
+	// ErrDecrypt is returned when no key can decrypt and authenticate the
+	// value, i.e. it was tampered with or sealed with an unknown key.
+	ErrDecrypt = errors.New("securecookie: decryption failed")
+)
+
+// Codec signs, verifies, encrypts and decrypts cookie values.
+type Codec struct {
+	signKeys [][]byte
+	aeads    []cipher.AEAD
+}
+
+// New returns a Codec for keys, newest first. Each key must be at least
+// MinKeyLength bytes of high-entropy secret.
+func New(keys ...[]byte) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	c := &Codec{}
+	for _, key := range keys {
+		if len(key) < MinKeyLength {
+			return nil, ErrShortKey
+		}
+		c.signKeys = append(c.signKeys, derive(key, "ngamux securecookie sign"))
+
+		block, err := aes.NewCipher(derive(key, "ngamux securecookie encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func signature(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Sign returns value with an HMAC-SHA256 signature for the cookie name.
+// The value itself stays readable by the client.
+func (c *Codec) Sign(name, value string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature(c.signKeys[0], name, payload))
+}
+
+// Verify checks a value produced by Sign for the cookie name and returns
+// the original value.
+func (c *Codec) Verify(name, signed string) (string, error) {
+	payload, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return "", ErrMalformed
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	for _, key := range c.signKeys {
+		if hmac.Equal(mac, signature(key, name, payload)) {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+// Encrypt seals value with AES-256-GCM for the cookie name, hiding it
+// from the client and protecting it against tampering.
+func (c *Codec) Encrypt(name, value string) (string, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name))), nil
+}
+
+// Decrypt opens a value produced by Encrypt for the cookie name.
+func (c *Codec) Decrypt(name, sealed string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	for _, aead := range c.aeads {
+		if len(b) < aead.NonceSize()+aead.Overhead() {
+			return "", ErrMalformed
+		}
+		plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", ErrDecrypt
+}
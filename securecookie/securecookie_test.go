@@ -0,0 +1,92 @@
+package securecookie
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte("o"), 32)
+	newKey = bytes.Repeat([]byte("n"), 64)
+)
+
+func TestNew(t *testing.T) {
+	must := must.New(t)
+
+	_, err := New()
+	must.True(errors.Is(err, ErrNoKeys))
+
+	_, err = New([]byte("short"))
+	must.True(errors.Is(err, ErrShortKey))
+
+	c, err := New(newKey, oldKey)
+	must.Nil(err)
+	must.Equal(2, len(c.signKeys))
+	must.Equal(2, len(c.aeads))
+}
+
+func TestSignVerify(t *testing.T) {
+	must := must.New(t)
+	old, _ := New(oldKey)
+	rotated, _ := New(newKey, oldKey)
+	onlyNew, _ := New(newKey)
+
+	signed := old.Sign("user", "42")
+	value, err := old.Verify("user", signed)
+	must.Nil(err)
+	must.Equal("42", value)
+
+	value, err = rotated.Verify("user", signed)
+	must.Nil(err)
+	must.Equal("42", value)
+
+	_, err = onlyNew.Verify("user", signed)
+	must.True(errors.Is(err, ErrInvalidSignature))
+
+	_, err = old.Verify("admin", signed)
+	must.True(errors.Is(err, ErrInvalidSignature))
+
+	payload, sig, _ := strings.Cut(signed, ".")
+	_, err = old.Verify("user", payload+"x."+sig)
+	must.NotNil(err)
+
+	_, err = old.Verify("user", "no-dot")
+	must.True(errors.Is(err, ErrMalformed))
+
+	_, err = old.Verify("user", payload+".!!")
+	must.True(errors.Is(err, ErrMalformed))
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	must := must.New(t)
+	old, _ := New(oldKey)
+	rotated, _ := New(newKey, oldKey)
+	onlyNew, _ := New(newKey)
+
+	sealed, err := old.Encrypt("cart", "secret contents")
+	must.Nil(err)
+	must.False(strings.Contains(sealed, "secret"))
+
+	again, _ := old.Encrypt("cart", "secret contents")
+	must.NotEqual(sealed, again)
+
+	value, err := rotated.Decrypt("cart", sealed)
+	must.Nil(err)
+	must.Equal("secret contents", value)
+
+	_, err = onlyNew.Decrypt("cart", sealed)
+	must.True(errors.Is(err, ErrDecrypt))
+
+	_, err = old.Decrypt("other", sealed)
+	must.True(errors.Is(err, ErrDecrypt))
+
+	_, err = old.Decrypt("cart", "!!!")
+	must.True(errors.Is(err, ErrMalformed))
+
+	_, err = old.Decrypt("cart", "AAAA")
+	must.True(errors.Is(err, ErrMalformed))
+}
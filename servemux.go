@@ -5,8 +5,6 @@ import (
 	"net/http"
 	gopath "path"
 	"slices"
-
-	"github.com/ngamux/ngamux/json"
 )
 
 // HttpServeMux is a lightweight wrapper around the standard library's
@@ -31,8 +29,7 @@ func NewHttpServeMux(cfg ...*Config) *HttpServeMux {
 		c := NewConfig()
 		cfg = append(cfg, &c)
 	}
-
-	json.Configure(cfg[0].JSONMarshal, cfg[0].JSONUnmarshal)
+	cfg[0].build()
 
 	return &HttpServeMux{
 		"",
@@ -55,6 +52,7 @@ func (h *HttpServeMux) Use(middlewares ...MiddlewareFunc) {
 // route matches, registered middlewares will be applied to the
 // http.NotFound handler.
 func (h HttpServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withLocals(withConfig(r, h.config))
 	_, pattern := h.mux.Handler(r)
 	if pattern == "" || (pattern == "GET /" && r.URL.Path != "/") {
 		WithMiddlewares(h.middlewares...)(http.NotFound).ServeHTTP(w, r)
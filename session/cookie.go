@@ -0,0 +1,92 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ngamux/ngamux/securecookie"
+)
+
+// maxCookieSize is the largest cookie value browsers reliably accept.
+const maxCookieSize = 4096
+
+// ErrCookieTooLarge is returned by CookieStore.Save when the encoded
+// session does not fit in a cookie.
+var ErrCookieTooLarge = errors.New("session: encoded session exceeds cookie size limit")
+
+// CookieStore is a Store keeping the whole session in the cookie,
+// gob-encoded and encrypted with package securecookie so the client can
+// neither read nor alter it. Nothing is kept on the server, so Delete
+// only relies on the middleware expiring the cookie; a copied cookie
+// stays valid until its embedded expiry.
+type CookieStore struct {
+	codec *securecookie.Codec
+}
+
+// cookiePayload is what is sealed in the cookie. The expiry is embedded
+// so old cookies are rejected even if the client keeps sending them.
+type cookiePayload struct {
+	Record Record
+	Expiry time.Time
+}
+
+// cookiePurpose binds sealed sessions to this store, so that values
+// encrypted with the same keys for other cookies are rejected.
+const cookiePurpose = "session"
+
+// NewCookieStore returns a CookieStore encrypting sessions with keys, as
+// securecookie.New does. Each key must be at least
+// securecookie.MinKeyLength bytes long. The first key seals new cookies;
+// all keys are tried when opening, so keys can be rotated by prepending
+// a new one and removing the oldest once its cookies have expired.
+func NewCookieStore(keys ...[]byte) (*CookieStore, error) {
+	codec, err := securecookie.New(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return &CookieStore{codec: codec}, nil
+}
+
+// Load implements Store.
+func (c *CookieStore) Load(ctx context.Context, token string) (Record, error) {
+	plain, err := c.codec.Decrypt(cookiePurpose, token)
+	if err != nil {
+		return Record{}, ErrNotFound
+	}
+
+	var payload cookiePayload
+	if err := gob.NewDecoder(strings.NewReader(plain)).Decode(&payload); err != nil {
+		return Record{}, err
+	}
+	if !time.Now().Before(payload.Expiry) {
+		return Record{}, ErrNotFound
+	}
+	return payload.Record, nil
+}
+
+// Save implements Store.
+func (c *CookieStore) Save(ctx context.Context, oldToken string, record Record, expiry time.Time) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(cookiePayload{record, expiry}); err != nil {
+		return "", err
+	}
+
+	token, err := c.codec.Encrypt(cookiePurpose, buf.String())
+	if err != nil {
+		return "", err
+	}
+	if len(token) > maxCookieSize {
+		return "", ErrCookieTooLarge
+	}
+	return token, nil
+}
+
+// Delete implements Store. Cookie sessions live on the client only, so
+// there is nothing to remove.
+func (c *CookieStore) Delete(ctx context.Context, token string) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux/securecookie"
+)
+
+func TestCookieStore(t *testing.T) {
+	must := must.New(t)
+	ctx := context.Background()
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	_, err := NewCookieStore()
+	must.NotNil(err)
+	_, err = NewCookieStore([]byte("short"))
+	must.NotNil(err)
+	_, err = NewCookieStore(bytes.Repeat([]byte("k"), 16))
+	must.True(errors.Is(err, securecookie.ErrShortKey))
+
+	old, err := NewCookieStore(oldKey)
+	must.Nil(err)
+	token, err := old.Save(ctx, "", Record{ID: "a", Values: map[string]any{"user": 7}}, time.Now().Add(time.Hour))
+	must.Nil(err)
+	must.False(strings.Contains(token, "user"))
+
+	record, err := old.Load(ctx, token)
+	must.Nil(err)
+	must.Equal("a", record.ID)
+	must.Equal(7, record.Values["user"])
+
+	// rotated keys still open cookies sealed with older keys
+	rotated, err := NewCookieStore(newKey, oldKey)
+	must.Nil(err)
+	record, err = rotated.Load(ctx, token)
+	must.Nil(err)
+	must.Equal(7, record.Values["user"])
+
+	// tampered or foreign cookies are rejected
+	tampered := token[:len(token)-2] + "AA"
+	_, err = old.Load(ctx, tampered)
+	must.True(errors.Is(err, ErrNotFound))
+	_, err = old.Load(ctx, "!!!")
+	must.True(errors.Is(err, ErrNotFound))
+	onlyNew, _ := NewCookieStore(newKey)
+	_, err = onlyNew.Load(ctx, token)
+	must.True(errors.Is(err, ErrNotFound))
+
+	// expired cookies are rejected
+	expired, err := old.Save(ctx, "", Record{ID: "b"}, time.Now().Add(-time.Second))
+	must.Nil(err)
+	_, err = old.Load(ctx, expired)
+	must.True(errors.Is(err, ErrNotFound))
+
+	_, err = old.Save(ctx, "", Record{Values: map[string]any{"big": strings.Repeat("x", maxCookieSize)}}, time.Now().Add(time.Hour))
+	must.True(errors.Is(err, ErrCookieTooLarge))
+
+	must.Nil(old.Delete(ctx, token))
+}
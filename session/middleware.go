@@ -0,0 +1,248 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Config configures the session middleware.
+type Config struct {
+	// CookieName is the name of the session cookie.
+	CookieName string
+	// CookiePath is the path attribute of the session cookie.
+	CookiePath string
+	// CookieDomain is the domain attribute of the session cookie.
+	CookieDomain string
+	// CookieSecure forces the Secure attribute. It is set anyway on
+	// requests the client sent over HTTPS, as reported by Scheme.
+	CookieSecure bool
+	// CookieSameSite is the SameSite attribute of the session cookie.
+	CookieSameSite http.SameSite
+
+	// IdleTimeout expires sessions not used for this long. Zero disables
+	// the idle expiry.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires sessions this long after their creation,
+	// however active they are. Zero disables the absolute expiry.
+	AbsoluteTimeout time.Duration
+
+	// Scheme returns the scheme, "http" or "https", the client used for
+	// the request. The default only looks at the connection; behind
+	// trusted reverse proxies terminating TLS, use ngamux.Request.Scheme:
+	//
+	//	Scheme: func(r *http.Request) string { return ngamux.Req(r).Scheme() },
+	Scheme func(r *http.Request) string
+
+	// ErrorHandler is called when the store fails to load or save a
+	// session. The default logs the error with slog.
+	ErrorHandler func(r *http.Request, err error)
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		CookieName:      "session",
+		CookiePath:      "/",
+		CookieSameSite:  http.SameSiteLaxMode,
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 24 * time.Hour,
+		Scheme:          connectionScheme,
+		ErrorHandler:    defaultErrorHandler,
+	}
+}
+
+// connectionScheme is the default Scheme.
+func connectionScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func defaultErrorHandler(r *http.Request, err error) {
+	slog.Default().ErrorContext(r.Context(), "session store failure", "error", err)
+}
+
+// fallbackLifetime bounds sessions when neither timeout is configured.
+const fallbackLifetime = 24 * time.Hour
+
+// New returns a middleware that loads the request's session from store
+// and saves it before the response headers are written. The returned
+// function is assignable to ngamux.MiddlewareFunc.
+func New(store Store, config ...Config) func(next http.HandlerFunc) http.HandlerFunc {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Scheme == nil {
+		cfg.Scheme = connectionScheme
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = defaultErrorHandler
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			s := cfg.load(r, store)
+			r = r.WithContext(NewContext(r.Context(), s))
+
+			sw := &sessionWriter{ResponseWriter: rw}
+			sw.commit = func() { cfg.save(rw, r, store, s) }
+			next(sw, r)
+			sw.commitOnce()
+		}
+	}
+}
+
+func (c Config) expired(record Record, now time.Time) bool {
+	if c.IdleTimeout > 0 && now.Sub(record.LastSeen) > c.IdleTimeout {
+		return true
+	}
+	if c.AbsoluteTimeout > 0 && now.Sub(record.Created) > c.AbsoluteTimeout {
+		return true
+	}
+	return false
+}
+
+func (c Config) expiry(record Record) time.Time {
+	var expiry time.Time
+	if c.IdleTimeout > 0 {
+		expiry = record.LastSeen.Add(c.IdleTimeout)
+	}
+	if c.AbsoluteTimeout > 0 {
+		absolute := record.Created.Add(c.AbsoluteTimeout)
+		if expiry.IsZero() || absolute.Before(expiry) {
+			expiry = absolute
+		}
+	}
+	if expiry.IsZero() {
+		expiry = record.Created.Add(fallbackLifetime)
+	}
+	return expiry
+}
+
+func (c Config) load(r *http.Request, store Store) *Session {
+	cookie, err := r.Cookie(c.CookieName)
+	if err != nil || cookie.Value == "" {
+		return newSession()
+	}
+
+	record, err := store.Load(r.Context(), cookie.Value)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			c.ErrorHandler(r, err)
+		}
+		return newSession()
+	}
+
+	if c.expired(record, time.Now()) {
+		if err := store.Delete(r.Context(), cookie.Value); err != nil {
+			c.ErrorHandler(r, err)
+		}
+		return newSession()
+	}
+
+	return &Session{record: cloneRecord(record), token: cookie.Value}
+}
+
+func (c Config) save(rw http.ResponseWriter, r *http.Request, store Store, s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx := context.WithoutCancel(r.Context())
+
+	if s.destroyed {
+		if s.token != "" {
+			if err := store.Delete(ctx, s.token); err != nil {
+				c.ErrorHandler(r, err)
+			}
+			c.setCookie(rw, r, "", time.Unix(0, 0))
+		}
+		return
+	}
+
+	if s.isNew && s.empty() {
+		return
+	}
+	if !s.modified && c.IdleTimeout <= 0 {
+		return
+	}
+
+	oldToken := s.token
+	if s.regenerated && oldToken != "" {
+		if err := store.Delete(ctx, oldToken); err != nil {
+			c.ErrorHandler(r, err)
+		}
+		oldToken = ""
+	}
+
+	s.record.LastSeen = time.Now()
+	expiry := c.expiry(s.record)
+	token, err := store.Save(ctx, oldToken, cloneRecord(s.record), expiry)
+	if err != nil {
+		c.ErrorHandler(r, err)
+		return
+	}
+	s.token = token
+	c.setCookie(rw, r, token, expiry)
+}
+
+func (c Config) setCookie(rw http.ResponseWriter, r *http.Request, value string, expiry time.Time) {
+	cookie := &http.Cookie{
+		Name:     c.CookieName,
+		Value:    value,
+		Path:     c.CookiePath,
+		Domain:   c.CookieDomain,
+		Expires:  expiry,
+		Secure:   c.CookieSecure || c.Scheme(r) == "https",
+		HttpOnly: true,
+		SameSite: c.CookieSameSite,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(time.Until(expiry).Seconds())
+	}
+	http.SetCookie(rw, cookie)
+}
+
+// sessionWriter saves the session right before the response headers
+// are sent, which is the last moment the session cookie can be set.
+type sessionWriter struct {
+	http.ResponseWriter
+	commit    func()
+	committed bool
+}
+
+func (w *sessionWriter) commitOnce() {
+	if !w.committed {
+		w.committed = true
+		w.commit()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	w.commitOnce()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.commitOnce()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *sessionWriter) Flush() {
+	w.commitOnce()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type client struct {
+	cookie *http.Cookie
+}
+
+func (c *client) do(h http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			c.cookie = nil
+			continue
+		}
+		c.cookie = cookie
+	}
+	return rec
+}
+
+func TestNew(t *testing.T) {
+	store := NewMemoryStore()
+	mw := New(store)
+
+	t.Run("empty sessions are not saved", func(t *testing.T) {
+		must := must.New(t)
+		c := &client{}
+		rec := c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			must.NotNil(FromContext(r.Context()))
+		}))
+		must.Equal(0, len(rec.Result().Cookies()))
+		must.Equal(0, store.Len())
+	})
+
+	t.Run("values persist across requests", func(t *testing.T) {
+		must := must.New(t)
+		c := &client{}
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("user", "alice")
+			FromContext(r.Context()).Flash("notice", "welcome")
+			_, _ = rw.Write([]byte("ok"))
+		}))
+		must.NotNil(c.cookie)
+		must.True(c.cookie.HttpOnly)
+
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			s := FromContext(r.Context())
+			must.False(s.IsNew())
+			must.Equal("alice", s.Get("user"))
+			must.Equal([]any{"welcome"}, s.Flashes("notice"))
+		}))
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			must.Nil(FromContext(r.Context()).Flashes("notice"))
+		}))
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		must := must.New(t)
+		c := &client{}
+		var id string
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("user", "bob")
+		}))
+		old := c.cookie.Value
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			s := FromContext(r.Context())
+			s.Regenerate()
+			id = s.ID()
+			rw.WriteHeader(http.StatusNoContent)
+		}))
+		must.Equal(id, c.cookie.Value)
+		must.NotEqual(old, c.cookie.Value)
+
+		stale := &client{cookie: &http.Cookie{Name: "session", Value: old}}
+		stale.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			must.True(FromContext(r.Context()).IsNew())
+		}))
+	})
+
+	t.Run("destroy", func(t *testing.T) {
+		must := must.New(t)
+		c := &client{}
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("user", "carol")
+		}))
+		token := c.cookie.Value
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Destroy()
+		}))
+		must.Nil(c.cookie)
+		_, err := store.Load(t.Context(), token)
+		must.Equal(ErrNotFound, err)
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		must := must.New(t)
+		config := NewConfig()
+		config.IdleTimeout = time.Millisecond
+		c := &client{}
+		c.do(New(store, config)(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("user", "dave")
+		}))
+		time.Sleep(5 * time.Millisecond)
+		c.do(New(store, config)(func(rw http.ResponseWriter, r *http.Request) {
+			must.True(FromContext(r.Context()).IsNew())
+		}))
+	})
+
+	t.Run("absolute timeout", func(t *testing.T) {
+		must := must.New(t)
+		config := NewConfig()
+		config.IdleTimeout = 0
+		config.AbsoluteTimeout = time.Hour
+		record := Record{Created: time.Now().Add(-2 * time.Hour), LastSeen: time.Now()}
+		must.True(config.expired(record, time.Now()))
+		must.Equal(record.Created.Add(time.Hour), config.expiry(record))
+	})
+
+	t.Run("secure cookie", func(t *testing.T) {
+		must := must.New(t)
+		set := func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("user", "alice")
+		}
+
+		must.False((&client{}).do(mw(set)).Result().Cookies()[0].Secure)
+
+		config := NewConfig()
+		config.Scheme = func(r *http.Request) string { return "https" }
+		must.True((&client{}).do(New(store, config)(set)).Result().Cookies()[0].Secure)
+
+		// A Config without Scheme falls back to the connection.
+		must.False((&client{}).do(New(store, Config{CookieName: "s"})(set)).Result().Cookies()[0].Secure)
+	})
+
+	t.Run("cookie store", func(t *testing.T) {
+		must := must.New(t)
+		cookieStore, err := NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+		must.Nil(err)
+		mw := New(cookieStore)
+		c := &client{}
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Set("cart", 3)
+		}))
+		c.do(mw(func(rw http.ResponseWriter, r *http.Request) {
+			must.Equal(3, FromContext(r.Context()).Get("cart"))
+		}))
+	})
+}
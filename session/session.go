@@ -0,0 +1,191 @@
+// Package session provides HTTP sessions for ngamux. The middleware
+// returned by New loads the session of the current request from a
+// Store before the handler runs and saves it back, refreshing the
+// session cookie, before the response headers are written.
+//
+// Handlers reach the session with ngamux.Req(r).Session() or
+// FromContext. Values are kept in a map[string]any; stores that
+// serialise sessions, such as CookieStore, use encoding/gob, so custom
+// value types must be registered with gob.Register.
+//
+// Two stores are provided: MemoryStore keeps sessions in process memory
+// and CookieStore keeps them, encrypted and authenticated, in the cookie
+// itself.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"maps"
+	"sync"
+	"time"
+)
+
+type contextKey struct{}
+
+// Record is the persisted state of a session, as exchanged with a Store.
+type Record struct {
+	ID       string
+	Values   map[string]any
+	Flashes  map[string][]any
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// Session is the session of a single request. It is safe for concurrent
+// use by the handler and goroutines it starts.
+type Session struct {
+	mu          sync.Mutex
+	record      Record
+	token       string
+	isNew       bool
+	modified    bool
+	regenerated bool
+	destroyed   bool
+}
+
+func newSession() *Session {
+	now := time.Now()
+	return &Session{
+		record: Record{
+			ID:       generateID(),
+			Values:   map[string]any{},
+			Flashes:  map[string][]any{},
+			Created:  now,
+			LastSeen: now,
+		},
+		isNew: true,
+	}
+}
+
+func generateID() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// FromContext returns the session stored in ctx by the session
+// middleware, or nil when there is none.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(contextKey{}).(*Session)
+	return s
+}
+
+// NewContext returns a copy of ctx carrying s.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// ID returns the session identifier. It changes after Regenerate.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.record.ID
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get returns the value stored under key, or nil.
+func (s *Session) Get(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.record.Values[key]
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record.Values[key] = value
+	s.modified = true
+}
+
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.record.Values[key]; ok {
+		delete(s.record.Values, key)
+		s.modified = true
+	}
+}
+
+// Keys returns the keys of all stored values, in no particular order.
+func (s *Session) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.record.Values))
+	for k := range s.record.Values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Flash adds a one-time message under key. Flash messages survive until
+// they are read with Flashes, typically on the next request.
+func (s *Session) Flash(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record.Flashes[key] = append(s.record.Flashes[key], value)
+	s.modified = true
+}
+
+// Flashes returns and removes the flash messages stored under key.
+func (s *Session) Flashes(key string) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, ok := s.record.Flashes[key]
+	if ok {
+		delete(s.record.Flashes, key)
+		s.modified = true
+	}
+	return flashes
+}
+
+// Regenerate gives the session a new identifier while keeping its
+// values. Call it whenever the privilege level changes, such as on
+// login, to prevent session fixation. The old identifier is removed from
+// the store when the session is saved.
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record.ID = generateID()
+	s.regenerated = true
+	s.modified = true
+}
+
+// Destroy clears the session and removes it from the store and the
+// client when the response is written.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record.Values = map[string]any{}
+	s.record.Flashes = map[string][]any{}
+	s.destroyed = true
+	s.modified = true
+}
+
+// cloneRecord returns a copy of r that shares no maps or slices with it,
+// so sessions and stores never alias each other's state.
+func cloneRecord(r Record) Record {
+	values := maps.Clone(r.Values)
+	if values == nil {
+		values = map[string]any{}
+	}
+	flashes := make(map[string][]any, len(r.Flashes))
+	for k, v := range r.Flashes {
+		flashes[k] = append([]any(nil), v...)
+	}
+	r.Values, r.Flashes = values, flashes
+	return r
+}
+
+func (s *Session) empty() bool {
+	return len(s.record.Values) == 0 && len(s.record.Flashes) == 0
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-must/must"
+)
+
+func TestSession(t *testing.T) {
+	must := must.New(t)
+	s := newSession()
+	must.True(s.IsNew())
+	must.True(s.empty())
+
+	s.Set("user", 1)
+	must.Equal(1, s.Get("user"))
+	must.Equal([]string{"user"}, s.Keys())
+	must.True(s.modified)
+
+	s.Delete("user")
+	must.Nil(s.Get("user"))
+
+	s.Flash("notice", "saved")
+	s.Flash("notice", "again")
+	must.Equal([]any{"saved", "again"}, s.Flashes("notice"))
+	must.Nil(s.Flashes("notice"))
+
+	id := s.ID()
+	s.Regenerate()
+	must.NotEqual(id, s.ID())
+	must.True(s.regenerated)
+
+	s.Set("user", 1)
+	s.Destroy()
+	must.True(s.destroyed)
+	must.Nil(s.Get("user"))
+}
+
+func TestContext(t *testing.T) {
+	must := must.New(t)
+	must.Nil(FromContext(context.Background()))
+
+	s := newSession()
+	must.Equal(s, FromContext(NewContext(context.Background(), s)))
+}
+
+func TestCloneRecord(t *testing.T) {
+	must := must.New(t)
+	original := Record{
+		Values:  map[string]any{"a": 1},
+		Flashes: map[string][]any{"f": {"x"}},
+	}
+
+	clone := cloneRecord(original)
+	clone.Values["a"] = 2
+	clone.Flashes["f"][0] = "y"
+	must.Equal(1, original.Values["a"])
+	must.Equal("x", original.Flashes["f"][0])
+
+	must.NotNil(cloneRecord(Record{}).Values)
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Store.Load when token identifies no live
+// session.
+var ErrNotFound = errors.New("session: not found")
+
+// Store persists sessions between requests. The token is the value of
+// the session cookie: server-side stores use the session ID, while
+// client-side stores such as CookieStore encode the whole record in it.
+type Store interface {
+	// Load returns the session identified by token, or ErrNotFound.
+	Load(ctx context.Context, token string) (Record, error)
+	// Save persists record until expiry. oldToken is the token the
+	// session was loaded with, empty for new sessions. It returns the
+	// token to send back in the session cookie.
+	Save(ctx context.Context, oldToken string, record Record, expiry time.Time) (string, error)
+	// Delete removes the session identified by token.
+	Delete(ctx context.Context, token string) error
+}
+
+type memoryEntry struct {
+	record Record
+	expiry time.Time
+}
+
+// MemoryStore is a Store keeping sessions in process memory. Sessions
+// are lost on restart and are not shared between processes, which makes
+// it best suited to development, tests and single-instance services.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]memoryEntry{},
+		now:     time.Now,
+	}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(ctx context.Context, token string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[token]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	if !m.now().Before(entry.expiry) {
+		delete(m.entries, token)
+		return Record{}, ErrNotFound
+	}
+	return entry.record, nil
+}
+
+// Save implements Store. Expired sessions are swept at most once a
+// minute while saving.
+func (m *MemoryStore) Save(ctx context.Context, oldToken string, record Record, expiry time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for token, entry := range m.entries {
+			if !now.Before(entry.expiry) {
+				delete(m.entries, token)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if oldToken != "" && oldToken != record.ID {
+		delete(m.entries, oldToken)
+	}
+	m.entries[record.ID] = memoryEntry{record, expiry}
+	return record.ID, nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, token)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones that
+// were not swept yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
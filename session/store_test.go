@@ -0,0 +1,50 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestMemoryStore(t *testing.T) {
+	must := must.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, err := store.Load(ctx, "missing")
+	must.True(errors.Is(err, ErrNotFound))
+
+	token, err := store.Save(ctx, "", Record{ID: "a", Values: map[string]any{"k": "v"}}, now.Add(time.Minute))
+	must.Nil(err)
+	must.Equal("a", token)
+
+	record, err := store.Load(ctx, "a")
+	must.Nil(err)
+	must.Equal("v", record.Values["k"])
+
+	// regenerated sessions replace the old token
+	token, err = store.Save(ctx, "a", Record{ID: "b"}, now.Add(time.Minute))
+	must.Nil(err)
+	must.Equal("b", token)
+	_, err = store.Load(ctx, "a")
+	must.True(errors.Is(err, ErrNotFound))
+
+	must.Nil(store.Delete(ctx, "b"))
+	_, err = store.Load(ctx, "b")
+	must.True(errors.Is(err, ErrNotFound))
+
+	// expired sessions are not returned and are swept
+	_, _ = store.Save(ctx, "", Record{ID: "c"}, now.Add(time.Second))
+	_, _ = store.Save(ctx, "", Record{ID: "d"}, now.Add(time.Second))
+	now = now.Add(2 * time.Minute)
+	_, err = store.Load(ctx, "c")
+	must.True(errors.Is(err, ErrNotFound))
+	must.Equal(1, store.Len())
+	_, _ = store.Save(ctx, "", Record{ID: "e"}, now.Add(time.Minute))
+	must.Equal(1, store.Len())
+}
@@ -0,0 +1,239 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Info describes an upload.
+type Info struct {
+	// ID identifies the upload in its URL.
+	ID string `json:"id"`
+	// Size is the length of the complete upload in bytes.
+	Size int64 `json:"size"`
+	// Offset is the number of bytes received so far. The upload is
+	// complete once it reaches Size.
+	Offset int64 `json:"-"`
+	// Metadata holds the Upload-Metadata given on creation, such as the
+	// file name.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Created is the creation time.
+	Created time.Time `json:"created"`
+	// Expires is when an incomplete upload is given up. Zero means
+	// never.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Complete reports whether every byte of the upload was received.
+func (i Info) Complete() bool {
+	return i.Offset == i.Size
+}
+
+// Store persists uploads. The Handler serializes the appends to an
+// upload within a process; stores shared between processes must reject
+// appends at an offset that is not the current one.
+type Store interface {
+	// Create records the new upload info, whose Offset is zero.
+	Create(ctx context.Context, info Info) error
+	// Info returns the upload with id, or ErrNotFound.
+	Info(ctx context.Context, id string) (Info, error)
+	// Append copies r to the upload with id, which must be at offset,
+	// and returns the number of bytes written. The bytes read before an
+	// error are kept, so that clients can resume after a broken
+	// connection, unless the error is ErrChecksumMismatch, in which case
+	// the upload must be left at offset.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// UpdateExpiry sets when the upload with id expires.
+	UpdateExpiry(ctx context.Context, id string, expires time.Time) error
+	// Open returns the content of the upload with id.
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Delete removes the upload with id, or reports ErrNotFound.
+	Delete(ctx context.Context, id string) error
+	// DeleteExpired removes the incomplete uploads that expired before
+	// now and returns how many were removed.
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// FileStore is a Store keeping each upload in a directory as two files:
+// the content, named after the upload ID, and its info, with an .info
+// extension. The offset of an upload is the size of its content file, so
+// that what was written before a crash is not lost.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore keeping uploads in dir, which is
+// created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Path returns the path of the content file of the upload with id, for
+// completion hooks moving it elsewhere.
+func (s *FileStore) Path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+func (s *FileStore) infoPath(id string) string {
+	return s.Path(id) + ".info"
+}
+
+// Create implements Store.
+func (s *FileStore) Create(ctx context.Context, info Info) error {
+	content, err := os.OpenFile(s.Path(info.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if err := content.Close(); err != nil {
+		return err
+	}
+	return s.writeInfo(info)
+}
+
+// writeInfo replaces the info file of info.ID atomically.
+func (s *FileStore) writeInfo(info Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(info.ID))
+}
+
+// Info implements Store.
+func (s *FileStore) Info(ctx context.Context, id string) (Info, error) {
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, err
+	}
+
+	stat, err := os.Stat(s.Path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	info.Offset = stat.Size()
+	return info, nil
+}
+
+// Append implements Store.
+func (s *FileStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	content, err := os.OpenFile(s.Path(id), os.O_WRONLY, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	stat, err := content.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if stat.Size() != offset {
+		return 0, ErrOffsetMismatch
+	}
+	if _, err := content.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(content, r)
+	if errors.Is(err, ErrChecksumMismatch) {
+		if truncateErr := content.Truncate(offset); truncateErr != nil {
+			return n, truncateErr
+		}
+		return 0, err
+	}
+	if syncErr := content.Sync(); err == nil {
+		err = syncErr
+	}
+	return n, err
+}
+
+// UpdateExpiry implements Store.
+func (s *FileStore) UpdateExpiry(ctx context.Context, id string, expires time.Time) error {
+	info, err := s.Info(ctx, id)
+	if err != nil {
+		return err
+	}
+	info.Expires = expires
+	return s.writeInfo(info)
+}
+
+// Open implements Store.
+func (s *FileStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	content, err := os.Open(s.Path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.Path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DeleteExpired implements Store.
+func (s *FileStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		info, err := s.Info(ctx, id)
+		if err != nil || info.Complete() || info.Expires.IsZero() || !info.Expires.Before(now) {
+			continue
+		}
+		if err := s.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,83 @@
+package upload
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestFileStore(t *testing.T) {
+	must := must.New(t)
+	ctx := t.Context()
+	store, err := NewFileStore(t.TempDir())
+	must.Nil(err)
+
+	id := "0123456789abcdef0123456789abcdef"
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	must.Nil(store.Create(ctx, Info{ID: id, Size: 10, Metadata: map[string]string{"filename": "a.txt"}, Created: created}))
+	must.NotNil(store.Create(ctx, Info{ID: id, Size: 10}))
+
+	n, err := store.Append(ctx, id, 0, strings.NewReader("hello"))
+	must.Nil(err)
+	must.Equal(int64(5), n)
+	_, err = store.Append(ctx, id, 0, strings.NewReader("hello"))
+	must.True(errors.Is(err, ErrOffsetMismatch))
+
+	// Bytes read before a broken connection are kept, unless they fail
+	// their checksum.
+	errBroken := errors.New("connection reset")
+	n, err = store.Append(ctx, id, 5, failingReader{strings.NewReader("wor"), errBroken})
+	must.Equal(errBroken, err)
+	must.Equal(int64(3), n)
+	n, err = store.Append(ctx, id, 8, failingReader{strings.NewReader("ld"), ErrChecksumMismatch})
+	must.True(errors.Is(err, ErrChecksumMismatch))
+	must.Equal(int64(0), n)
+
+	info, err := store.Info(ctx, id)
+	must.Nil(err)
+	must.Equal(Info{ID: id, Size: 10, Offset: 8, Metadata: map[string]string{"filename": "a.txt"}, Created: created}, info)
+
+	expires := created.Add(time.Hour)
+	must.Nil(store.UpdateExpiry(ctx, id, expires))
+	info, _ = store.Info(ctx, id)
+	must.Equal(expires, info.Expires)
+
+	content, err := store.Open(ctx, id)
+	must.Nil(err)
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	must.Equal("hellowor", string(data))
+	_, err = os.Stat(store.Path(id))
+	must.Nil(err)
+
+	n2, err := store.DeleteExpired(ctx, expires)
+	must.Nil(err)
+	must.Equal(0, n2)
+	n2, err = store.DeleteExpired(ctx, expires.Add(time.Second))
+	must.Nil(err)
+	must.Equal(1, n2)
+
+	_, err = store.Info(ctx, id)
+	must.True(errors.Is(err, ErrNotFound))
+	must.True(errors.Is(store.Delete(ctx, id), ErrNotFound))
+	_, err = store.Open(ctx, id)
+	must.True(errors.Is(err, ErrNotFound))
+}
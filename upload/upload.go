@@ -0,0 +1,647 @@
+// Package upload provides a handler for resumable uploads following the
+// tus protocol 1.0.0, so that clients on unreliable networks can resume
+// an upload where it stopped instead of starting over.
+//
+// A client creates an upload with a POST to the collection path, giving
+// its length in Upload-Length, and gets its URL in Location. It then
+// sends the content with PATCH requests, each starting at the offset
+// given in Upload-Offset. After a broken connection, a HEAD request tells
+// how many bytes were received. Besides the core protocol, the creation,
+// creation-with-upload, expiration, checksum and termination extensions
+// are supported.
+package upload
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngamux/ngamux"
+)
+
+const (
+	// Version is the version of the tus protocol implemented.
+	Version = "1.0.0"
+	// Extensions lists the tus extensions supported, as advertised in
+	// the Tus-Extension header.
+	Extensions = "creation,creation-with-upload,expiration,checksum,termination"
+
+	// StatusChecksumMismatch is the status answered when the content of
+	// a PATCH request does not match its Upload-Checksum.
+	StatusChecksumMismatch = 460
+
+	offsetContentType = "application/offset+octet-stream"
+)
+
+var (
+	// ErrUnsupportedVersion is reported for requests whose Tus-Resumable
+	// header is not Version.
+	ErrUnsupportedVersion = errors.New("upload: unsupported protocol version")
+	// ErrNotFound is reported for unknown uploads.
+	ErrNotFound = errors.New("upload: not found")
+	// ErrExpired is reported for uploads that expired before completion.
+	ErrExpired = errors.New("upload: expired")
+	// ErrInvalidLength is reported for missing or invalid Upload-Length
+	// headers.
+	ErrInvalidLength = errors.New("upload: invalid Upload-Length")
+	// ErrInvalidOffset is reported for missing or invalid Upload-Offset
+	// headers.
+	ErrInvalidOffset = errors.New("upload: invalid Upload-Offset")
+	// ErrInvalidMetadata is reported for malformed Upload-Metadata
+	// headers.
+	ErrInvalidMetadata = errors.New("upload: invalid Upload-Metadata")
+	// ErrInvalidChecksum is reported for malformed Upload-Checksum
+	// headers and unsupported algorithms.
+	ErrInvalidChecksum = errors.New("upload: invalid or unsupported Upload-Checksum")
+	// ErrInvalidContentType is reported for PATCH requests whose body is
+	// not application/offset+octet-stream.
+	ErrInvalidContentType = errors.New("upload: content type must be " + offsetContentType)
+	// ErrOffsetMismatch is reported when Upload-Offset is not the offset
+	// of the upload.
+	ErrOffsetMismatch = errors.New("upload: offset mismatch")
+	// ErrChecksumMismatch is reported when the content of a request does
+	// not match its Upload-Checksum.
+	ErrChecksumMismatch = errors.New("upload: checksum mismatch")
+	// ErrTooLarge is reported for uploads longer than MaxSize and for
+	// content going past the length of the upload.
+	ErrTooLarge = errors.New("upload: too large")
+	// ErrLocked is reported while another request appends to or deletes
+	// the upload.
+	ErrLocked = errors.New("upload: locked by another request")
+)
+
+// checksums maps the names of the Upload-Checksum algorithms to their
+// hash.
+var checksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Config configures the upload handler.
+type Config struct {
+	// MaxSize limits the length of uploads, advertised in Tus-Max-Size.
+	// Zero means no limit.
+	MaxSize int64
+	// Expiration is how long an incomplete upload is kept after its last
+	// PATCH request. Negative means forever.
+	Expiration time.Duration
+
+	// OnCreate is called before an upload is created and may change its
+	// metadata. An error rejects the creation and is given to
+	// ErrorHandler.
+	OnCreate func(r *http.Request, info *Info) error
+	// OnComplete is called once the last byte of an upload is received,
+	// before answering the request that sent it, e.g. to move the content
+	// out of the Store. An error is given to ErrorHandler; the upload
+	// stays complete.
+	OnComplete func(r *http.Request, info Info) error
+
+	// ErrorHandler writes the response for rejected requests and store
+	// failures. The default replies with a problem response whose status
+	// follows the tus protocol, e.g. 409 for offset mismatches and 460
+	// for checksum mismatches. Other errors are answered with
+	// ngamux.ErrorProblem, so hooks may return problems.
+	ErrorHandler func(rw http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewConfig returns Config with some default values
+func NewConfig() Config {
+	return Config{
+		Expiration:   24 * time.Hour,
+		ErrorHandler: defaultErrorHandler,
+	}
+}
+
+func (c *Config) setDefaults() {
+	defaults := NewConfig()
+	if c.Expiration == 0 {
+		c.Expiration = defaults.Expiration
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = defaults.ErrorHandler
+	}
+}
+
+func defaultErrorHandler(rw http.ResponseWriter, r *http.Request, err error) {
+	status := 0
+	switch {
+	case errors.Is(err, ErrUnsupportedVersion):
+		status = http.StatusPreconditionFailed
+		rw.Header().Set("Tus-Version", Version)
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrExpired):
+		status = http.StatusGone
+	case errors.Is(err, ErrInvalidLength), errors.Is(err, ErrInvalidOffset),
+		errors.Is(err, ErrInvalidMetadata), errors.Is(err, ErrInvalidChecksum):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrInvalidContentType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrLocked):
+		status = http.StatusLocked
+	case errors.Is(err, ErrChecksumMismatch):
+		problem := ngamux.NewProblem(StatusChecksumMismatch, err.Error())
+		problem.Title = "Checksum Mismatch"
+		ngamux.Res(rw, r).Problem(problem)
+		return
+	}
+
+	if status == 0 {
+		ngamux.Res(rw, r).Problem(ngamux.ErrorProblem(err))
+		return
+	}
+	ngamux.Res(rw, r).Problem(ngamux.NewProblem(status, err.Error()))
+}
+
+// Handler serves resumable uploads kept in a Store. It answers POST and
+// OPTIONS requests on the collection path, and HEAD, PATCH, DELETE and
+// OPTIONS requests on the path of an upload, whose ID it reads from the
+// {id} path value. Use Register to mount it on a router.
+type Handler struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+// New returns a Handler keeping uploads in store.
+//
+//	store, err := upload.NewFileStore("/var/lib/app/uploads")
+//	...
+//	uploads := upload.New(store, upload.Config{
+//		MaxSize: 4 << 30,
+//		OnComplete: func(r *http.Request, info upload.Info) error {
+//			return os.Rename(store.Path(info.ID), "/srv/videos/"+info.ID)
+//		},
+//	})
+//	uploads.Register(mux, "/files")
+func New(store Store, config ...Config) *Handler {
+	cfg := NewConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg.setDefaults()
+
+	return &Handler{
+		store:  store,
+		cfg:    cfg,
+		now:    time.Now,
+		active: map[string]struct{}{},
+	}
+}
+
+// Register mounts h on mux: the collection at prefix and the uploads at
+// prefix/{id}. The middlewares wrap every route.
+func (h *Handler) Register(mux *ngamux.Ngamux, prefix string, middlewares ...ngamux.MiddlewareFunc) {
+	middlewares = slices.Clone(middlewares)
+	slices.Reverse(middlewares)
+	for _, method := range []string{http.MethodOptions, http.MethodPost} {
+		mux.HandleFunc(method, prefix, h.ServeHTTP, middlewares...)
+	}
+	for _, method := range []string{http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodDelete, http.MethodPost} {
+		mux.HandleFunc(method, path.Join(prefix, "{id}"), h.ServeHTTP, middlewares...)
+	}
+}
+
+// Purge deletes the incomplete uploads that expired and returns how many
+// were deleted. Expired uploads are refused anyway, so calling it
+// periodically only reclaims storage.
+func (h *Handler) Purge(ctx context.Context) (int, error) {
+	return h.store.DeleteExpired(ctx, h.now())
+}
+
+// ServeHTTP implements http.Handler. POST requests carrying an
+// X-HTTP-Method-Override header are handled as the method it names, for
+// clients that cannot send PATCH or DELETE.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Tus-Resumable", Version)
+
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); method == http.MethodPost && override != "" {
+		method = strings.ToUpper(override)
+	}
+	id := r.PathValue("id")
+
+	if method == http.MethodOptions {
+		h.options(rw)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != Version {
+		h.cfg.ErrorHandler(rw, r, ErrUnsupportedVersion)
+		return
+	}
+
+	switch {
+	case id == "" && method == http.MethodPost:
+		h.create(rw, r)
+	case id != "" && method == http.MethodHead:
+		h.head(rw, r, id)
+	case id != "" && method == http.MethodPatch:
+		h.patch(rw, r, id)
+	case id != "" && method == http.MethodDelete:
+		h.terminate(rw, r, id)
+	default:
+		if id == "" {
+			rw.Header().Set("Allow", "OPTIONS, POST")
+		} else {
+			rw.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		}
+		ngamux.Res(rw, r).Problem(ngamux.NewProblem(http.StatusMethodNotAllowed, ""))
+	}
+}
+
+// options advertises the protocol and its extensions.
+func (h *Handler) options(rw http.ResponseWriter) {
+	header := rw.Header()
+	header.Set("Tus-Version", Version)
+	header.Set("Tus-Extension", Extensions)
+	algorithms := make([]string, 0, len(checksums))
+	for name := range checksums {
+		algorithms = append(algorithms, name)
+	}
+	slices.Sort(algorithms)
+	header.Set("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+	if h.cfg.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// create creates an upload and, when the request has content, appends
+// it.
+func (h *Handler) create(rw http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		h.cfg.ErrorHandler(rw, r, ErrInvalidLength)
+		return
+	}
+	if h.cfg.MaxSize > 0 && size > h.cfg.MaxSize {
+		h.cfg.ErrorHandler(rw, r, ErrTooLarge)
+		return
+	}
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+	withContent := r.Header.Get("Content-Type") != ""
+	if withContent && !isOffsetContent(r) {
+		h.cfg.ErrorHandler(rw, r, ErrInvalidContentType)
+		return
+	}
+
+	now := h.now()
+	info := Info{
+		ID:       newID(),
+		Size:     size,
+		Metadata: metadata,
+		Created:  now,
+	}
+	if h.cfg.Expiration > 0 {
+		info.Expires = now.Add(h.cfg.Expiration)
+	}
+	if h.cfg.OnCreate != nil {
+		if err := h.cfg.OnCreate(r, &info); err != nil {
+			h.cfg.ErrorHandler(rw, r, err)
+			return
+		}
+	}
+	if err := h.store.Create(r.Context(), info); err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+	rw.Header().Set("Location", ngamux.Req(r).AbsoluteURL(path.Join(r.URL.Path, info.ID)))
+
+	switch {
+	case info.Complete():
+		// An empty upload is complete as soon as it is created.
+		setUploadHeaders(rw, info)
+		if err := h.complete(r, info); err != nil {
+			h.cfg.ErrorHandler(rw, r, err)
+			return
+		}
+	case withContent:
+		if !h.lock(info.ID) {
+			h.cfg.ErrorHandler(rw, r, ErrLocked)
+			return
+		}
+		defer h.unlock(info.ID)
+		info, err = h.append(r, info)
+		setUploadHeaders(rw, info)
+		if err != nil {
+			h.cfg.ErrorHandler(rw, r, err)
+			return
+		}
+	default:
+		setUploadHeaders(rw, info)
+	}
+	rw.WriteHeader(http.StatusCreated)
+}
+
+// head reports the offset of an upload.
+func (h *Handler) head(rw http.ResponseWriter, r *http.Request, id string) {
+	info, err := h.info(r.Context(), id)
+	if err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+
+	header := rw.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Length", strconv.FormatInt(info.Size, 10))
+	if len(info.Metadata) > 0 {
+		header.Set("Upload-Metadata", formatMetadata(info.Metadata))
+	}
+	setUploadHeaders(rw, info)
+	rw.WriteHeader(http.StatusOK)
+}
+
+// patch appends the content of the request to an upload.
+func (h *Handler) patch(rw http.ResponseWriter, r *http.Request, id string) {
+	if !isOffsetContent(r) {
+		h.cfg.ErrorHandler(rw, r, ErrInvalidContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.cfg.ErrorHandler(rw, r, ErrInvalidOffset)
+		return
+	}
+
+	if !h.lock(id) {
+		h.cfg.ErrorHandler(rw, r, ErrLocked)
+		return
+	}
+	defer h.unlock(id)
+
+	info, err := h.info(r.Context(), id)
+	if err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+	if offset != info.Offset {
+		rw.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		h.cfg.ErrorHandler(rw, r, ErrOffsetMismatch)
+		return
+	}
+	if info.Complete() {
+		// Nothing is left to append, and OnComplete already ran: refuse
+		// content and answer empty requests with the final offset.
+		setUploadHeaders(rw, info)
+		if r.ContentLength != 0 {
+			h.cfg.ErrorHandler(rw, r, ErrTooLarge)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	info, err = h.append(r, info)
+	setUploadHeaders(rw, info)
+	if err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// terminate deletes an upload.
+func (h *Handler) terminate(rw http.ResponseWriter, r *http.Request, id string) {
+	if !validID(id) {
+		h.cfg.ErrorHandler(rw, r, ErrNotFound)
+		return
+	}
+	if !h.lock(id) {
+		h.cfg.ErrorHandler(rw, r, ErrLocked)
+		return
+	}
+	defer h.unlock(id)
+
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		h.cfg.ErrorHandler(rw, r, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// info returns the upload with id, deleting it when it expired.
+func (h *Handler) info(ctx context.Context, id string) (Info, error) {
+	if !validID(id) {
+		return Info{}, ErrNotFound
+	}
+	info, err := h.store.Info(ctx, id)
+	if err != nil {
+		return Info{}, err
+	}
+	if !info.Complete() && !info.Expires.IsZero() && !h.now().Before(info.Expires) {
+		if err := h.store.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return Info{}, err
+		}
+		return Info{}, ErrExpired
+	}
+	return info, nil
+}
+
+// append appends the content of r to the upload of info, at its offset,
+// and returns its new info. Content going past the length of the upload
+// is rejected up front when the request has a Content-Length, and
+// ignored otherwise. Content with an Upload-Checksum is kept only when it
+// is complete and matches. OnComplete runs when the content completes
+// the upload.
+func (h *Handler) append(r *http.Request, info Info) (Info, error) {
+	remaining := info.Size - info.Offset
+	if r.ContentLength > remaining {
+		return info, ErrTooLarge
+	}
+
+	var body io.Reader = http.NoBody
+	if r.Body != nil {
+		body = io.LimitReader(r.Body, remaining)
+	}
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		checksum, err := newChecksumReader(body, header)
+		if err != nil {
+			return info, err
+		}
+		body = checksum
+	}
+
+	n, err := h.store.Append(r.Context(), info.ID, info.Offset, body)
+	info.Offset += n
+	if err != nil {
+		return info, err
+	}
+
+	if n > 0 && info.Complete() {
+		return info, h.complete(r, info)
+	}
+	if h.cfg.Expiration > 0 {
+		info.Expires = h.now().Add(h.cfg.Expiration)
+		if err := h.store.UpdateExpiry(r.Context(), info.ID, info.Expires); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// complete runs the OnComplete hook.
+func (h *Handler) complete(r *http.Request, info Info) error {
+	if h.cfg.OnComplete == nil {
+		return nil
+	}
+	return h.cfg.OnComplete(r, info)
+}
+
+// lock reserves the upload with id for the request, reporting false when
+// another request holds it.
+func (h *Handler) lock(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.active[id]; ok {
+		return false
+	}
+	h.active[id] = struct{}{}
+	return true
+}
+
+func (h *Handler) unlock(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.active, id)
+}
+
+// setUploadHeaders sets Upload-Offset and, for incomplete uploads that
+// expire, Upload-Expires.
+func setUploadHeaders(rw http.ResponseWriter, info Info) {
+	rw.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	if !info.Complete() && !info.Expires.IsZero() {
+		rw.Header().Set("Upload-Expires", info.Expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+func isOffsetContent(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == offsetContentType
+}
+
+// newID returns a random upload ID of 32 hexadecimal digits.
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// validID reports whether id may have been returned by newID, so that
+// stores never see IDs such as "../secret".
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// parseMetadata parses an Upload-Metadata header: comma separated keys,
+// each followed by a space and its base64 encoded value, if any.
+func parseMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, ErrInvalidMetadata
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidMetadata, key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: value of %q is not base64", ErrInvalidMetadata, key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatMetadata formats metadata as an Upload-Metadata header, sorted by
+// key.
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if value := metadata[key]; value != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// checksumReader hashes what is read from r and, at its end, fails with
+// ErrChecksumMismatch unless the hash is sum. Read errors are reported as
+// mismatches too, since incomplete content cannot be verified.
+type checksumReader struct {
+	r    io.Reader
+	hash hash.Hash
+	sum  []byte
+}
+
+// newChecksumReader parses header, an Upload-Checksum header such as
+// "sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0=", and returns a reader verifying r
+// against it.
+func newChecksumReader(r io.Reader, header string) (*checksumReader, error) {
+	algorithm, encoded, _ := strings.Cut(strings.TrimSpace(header), " ")
+	newHash, ok := checksums[algorithm]
+	if !ok {
+		return nil, ErrInvalidChecksum
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, ErrInvalidChecksum
+	}
+	return &checksumReader{r: r, hash: newHash(), sum: sum}, nil
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	switch {
+	case err == io.EOF && !slices.Equal(c.hash.Sum(nil), c.sum):
+		return n, ErrChecksumMismatch
+	case err != nil && err != io.EOF:
+		return n, fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+	return n, err
+}
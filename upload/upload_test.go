@@ -0,0 +1,322 @@
+package upload
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+	"github.com/ngamux/ngamux"
+)
+
+type client struct {
+	t   *testing.T
+	mux *ngamux.Ngamux
+}
+
+func newClient(t *testing.T, config ...Config) (*client, *Handler, *FileStore) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(store, config...)
+	mux := ngamux.New()
+	h.Register(mux, "/files")
+	return &client{t: t, mux: mux}, h, store
+}
+
+func (c *client) do(method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", Version)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	c.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func (c *client) create(length string, header map[string]string) string {
+	if header == nil {
+		header = map[string]string{}
+	}
+	header["Upload-Length"] = length
+	rec := c.do(http.MethodPost, "/files", "", header)
+	if rec.Code != http.StatusCreated {
+		c.t.Fatalf("create: got %d %s", rec.Code, rec.Body.String())
+	}
+	return strings.TrimPrefix(rec.Header().Get("Location"), "http://example.com")
+}
+
+func (c *client) patch(location, offset, body string, header map[string]string) *httptest.ResponseRecorder {
+	if header == nil {
+		header = map[string]string{}
+	}
+	header["Content-Type"] = "application/offset+octet-stream"
+	header["Upload-Offset"] = offset
+	return c.do(http.MethodPatch, location, body, header)
+}
+
+func TestUpload(t *testing.T) {
+	must := must.New(t)
+	var completed []Info
+	c, _, store := newClient(t, Config{
+		OnComplete: func(r *http.Request, info Info) error {
+			completed = append(completed, info)
+			return nil
+		},
+	})
+
+	location := c.create("11", map[string]string{"Upload-Metadata": "filename aGVsbG8udHh0,is_draft"})
+	must.True(strings.HasPrefix(location, "/files/"))
+
+	rec := c.patch(location, "0", "hello", nil)
+	must.Equal(http.StatusNoContent, rec.Code)
+	must.Equal("5", rec.Header().Get("Upload-Offset"))
+	must.Equal(Version, rec.Header().Get("Tus-Resumable"))
+	must.NotEqual("", rec.Header().Get("Upload-Expires"))
+
+	rec = c.do(http.MethodHead, location, "", nil)
+	must.Equal(http.StatusOK, rec.Code)
+	must.Equal("5", rec.Header().Get("Upload-Offset"))
+	must.Equal("11", rec.Header().Get("Upload-Length"))
+	must.Equal("filename aGVsbG8udHh0,is_draft", rec.Header().Get("Upload-Metadata"))
+	must.Equal("no-store", rec.Header().Get("Cache-Control"))
+	must.Equal("", rec.Body.String())
+
+	// Resuming at a stale offset conflicts.
+	rec = c.patch(location, "0", "hello", nil)
+	must.Equal(http.StatusConflict, rec.Code)
+	must.Equal("5", rec.Header().Get("Upload-Offset"))
+
+	rec = c.patch(location, "5", " world", nil)
+	must.Equal(http.StatusNoContent, rec.Code)
+	must.Equal("11", rec.Header().Get("Upload-Offset"))
+	must.Equal("", rec.Header().Get("Upload-Expires"))
+
+	must.Equal(1, len(completed))
+	must.Equal(int64(11), completed[0].Offset)
+	must.Equal(map[string]string{"filename": "hello.txt", "is_draft": ""}, completed[0].Metadata)
+	content, err := store.Open(t.Context(), completed[0].ID)
+	must.Nil(err)
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	must.Equal("hello world", string(data))
+
+	// Nothing can be appended to a complete upload.
+	rec = c.patch(location, "11", "!", nil)
+	must.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = c.do(http.MethodDelete, location, "", nil)
+	must.Equal(http.StatusNoContent, rec.Code)
+	rec = c.do(http.MethodHead, location, "", nil)
+	must.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestOptions(t *testing.T) {
+	must := must.New(t)
+	c, _, _ := newClient(t, Config{MaxSize: 1000})
+	req := httptest.NewRequest(http.MethodOptions, "/files", nil)
+	rec := httptest.NewRecorder()
+	c.mux.ServeHTTP(rec, req)
+	must.Equal(http.StatusNoContent, rec.Code)
+	must.Equal(Version, rec.Header().Get("Tus-Version"))
+	must.Equal(Extensions, rec.Header().Get("Tus-Extension"))
+	must.Equal("md5,sha1,sha256,sha512", rec.Header().Get("Tus-Checksum-Algorithm"))
+	must.Equal("1000", rec.Header().Get("Tus-Max-Size"))
+}
+
+func TestCreate(t *testing.T) {
+	must := must.New(t)
+	var completed int
+	c, _, _ := newClient(t, Config{
+		MaxSize: 10,
+		OnCreate: func(r *http.Request, info *Info) error {
+			if info.Metadata["filename"] == "" {
+				return ngamux.NewProblem(http.StatusUnprocessableEntity, "filename is required")
+			}
+			return nil
+		},
+		OnComplete: func(r *http.Request, info Info) error {
+			completed++
+			return nil
+		},
+	})
+	withName := map[string]string{"Upload-Metadata": "filename YS50eHQ="}
+
+	for _, tc := range []struct {
+		header map[string]string
+		status int
+	}{
+		{map[string]string{"Upload-Metadata": "filename YS50eHQ="}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "-1", "Upload-Metadata": "filename YS50eHQ="}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "11", "Upload-Metadata": "filename YS50eHQ="}, http.StatusRequestEntityTooLarge},
+		{map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename !!"}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename YQ==,filename YQ=="}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "1"}, http.StatusUnprocessableEntity},
+		{map[string]string{"Upload-Length": "1", "Upload-Metadata": "filename YS50eHQ=", "Tus-Resumable": "0.2.2"}, http.StatusPreconditionFailed},
+	} {
+		rec := c.do(http.MethodPost, "/files", "", tc.header)
+		must.Equal(tc.status, rec.Code)
+	}
+
+	// Creation with upload.
+	withName["Content-Type"] = "application/offset+octet-stream"
+	withName["Upload-Length"] = "6"
+	rec := c.do(http.MethodPost, "/files", "abc", withName)
+	must.Equal(http.StatusCreated, rec.Code)
+	must.Equal("3", rec.Header().Get("Upload-Offset"))
+	must.True(strings.HasPrefix(rec.Header().Get("Location"), "http://example.com/files/"))
+
+	// Empty uploads are complete right away.
+	delete(withName, "Content-Type")
+	withName["Upload-Length"] = "0"
+	rec = c.do(http.MethodPost, "/files", "", withName)
+	must.Equal(http.StatusCreated, rec.Code)
+	must.Equal(1, completed)
+}
+
+func TestChecksum(t *testing.T) {
+	must := must.New(t)
+	c, _, _ := newClient(t)
+	location := c.create("10", nil)
+	sum := sha1.Sum([]byte("hello"))
+	checksum := "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+
+	rec := c.patch(location, "0", "hellO", map[string]string{"Upload-Checksum": checksum})
+	must.Equal(StatusChecksumMismatch, rec.Code)
+	must.Equal("0", rec.Header().Get("Upload-Offset"))
+	must.True(strings.Contains(rec.Body.String(), "Checksum Mismatch"))
+
+	rec = c.patch(location, "0", "hello", map[string]string{"Upload-Checksum": "crc32 AAAA"})
+	must.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = c.patch(location, "0", "hello", map[string]string{"Upload-Checksum": checksum})
+	must.Equal(http.StatusNoContent, rec.Code)
+	must.Equal("5", rec.Header().Get("Upload-Offset"))
+}
+
+func TestPatchErrors(t *testing.T) {
+	must := must.New(t)
+	c, h, _ := newClient(t)
+	location := c.create("5", nil)
+
+	rec := c.do(http.MethodPatch, location, "hello", map[string]string{"Upload-Offset": "0", "Content-Type": "text/plain"})
+	must.Equal(http.StatusUnsupportedMediaType, rec.Code)
+	rec = c.patch(location, "x", "hello", nil)
+	must.Equal(http.StatusBadRequest, rec.Code)
+	rec = c.patch(location, "0", "hello world", nil)
+	must.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+	rec = c.patch("/files/0123456789abcdef0123456789abcdef", "0", "hello", nil)
+	must.Equal(http.StatusNotFound, rec.Code)
+
+	// IDs are checked before reaching the store.
+	req := httptest.NewRequest(http.MethodDelete, "/files/x", nil)
+	req.Header.Set("Tus-Resumable", Version)
+	req.SetPathValue("id", "../secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	must.Equal(http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, location, nil)
+	req.Header.Set("Tus-Resumable", Version)
+	req.SetPathValue("id", strings.TrimPrefix(location, "/files/"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	must.Equal(http.StatusMethodNotAllowed, rec.Code)
+	must.Equal("OPTIONS, HEAD, PATCH, DELETE", rec.Header().Get("Allow"))
+
+	id := strings.TrimPrefix(location, "/files/")
+	must.True(h.lock(id))
+	rec = c.patch(location, "0", "hello", nil)
+	must.Equal(http.StatusLocked, rec.Code)
+	h.unlock(id)
+
+	// Clients that cannot send PATCH override POST.
+	rec = c.do(http.MethodPost, location, "hello", map[string]string{
+		"X-HTTP-Method-Override": "PATCH",
+		"Content-Type":           "application/offset+octet-stream",
+		"Upload-Offset":          "0",
+	})
+	must.Equal(http.StatusNoContent, rec.Code)
+}
+
+func TestExpiration(t *testing.T) {
+	must := must.New(t)
+	c, h, _ := newClient(t, Config{Expiration: time.Hour})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	first := c.create("10", nil)
+	second := c.create("10", nil)
+	rec := c.patch(first, "0", "hello", nil)
+	must.Equal("Mon, 01 Jan 2024 01:00:00 GMT", rec.Header().Get("Upload-Expires"))
+
+	// Each PATCH request extends the expiry.
+	now = now.Add(30 * time.Minute)
+	rec = c.patch(first, "5", "hello"[:2], nil)
+	must.Equal("Mon, 01 Jan 2024 01:30:00 GMT", rec.Header().Get("Upload-Expires"))
+
+	now = now.Add(45 * time.Minute)
+	rec = c.do(http.MethodHead, second, "", nil)
+	must.Equal(http.StatusGone, rec.Code)
+	rec = c.do(http.MethodHead, second, "", nil)
+	must.Equal(http.StatusNotFound, rec.Code)
+
+	n, err := h.Purge(t.Context())
+	must.Nil(err)
+	must.Equal(0, n)
+	now = now.Add(time.Hour)
+	n, err = h.Purge(t.Context())
+	must.Nil(err)
+	must.Equal(1, n)
+}
+
+func TestCompleteError(t *testing.T) {
+	must := must.New(t)
+	c, _, _ := newClient(t, Config{
+		OnComplete: func(r *http.Request, info Info) error {
+			return errors.New("disk full")
+		},
+	})
+	location := c.create("2", nil)
+	rec := c.patch(location, "0", "ok", nil)
+	must.Equal(http.StatusInternalServerError, rec.Code)
+	must.Equal("2", rec.Header().Get("Upload-Offset"))
+	rec = c.do(http.MethodHead, location, "", nil)
+	must.Equal("2", rec.Header().Get("Upload-Offset"))
+}
+
+func TestPatchComplete(t *testing.T) {
+	must := must.New(t)
+	calls := 0
+	c, _, _ := newClient(t, Config{
+		OnComplete: func(r *http.Request, info Info) error {
+			calls++
+			return nil
+		},
+	})
+	location := c.create("2", nil)
+	rec := c.patch(location, "0", "ok", nil)
+	must.Equal(http.StatusNoContent, rec.Code)
+
+	// Retried empty requests at the final offset do not rerun OnComplete.
+	for range 3 {
+		rec = c.patch(location, "2", "", nil)
+		must.Equal(http.StatusNoContent, rec.Code)
+		must.Equal("2", rec.Header().Get("Upload-Offset"))
+	}
+	must.Equal(1, calls)
+
+	// Empty uploads complete on creation only.
+	location = c.create("0", nil)
+	rec = c.patch(location, "0", "", nil)
+	must.Equal(http.StatusNoContent, rec.Code)
+	must.Equal(2, calls)
+}
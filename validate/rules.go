@@ -0,0 +1,164 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var builtinRules = map[string]Rule{
+	"required": required,
+	"min":      compare(func(n, param float64) bool { return n >= param }),
+	"max":      compare(func(n, param float64) bool { return n <= param }),
+	"len":      compare(func(n, param float64) bool { return n == param }),
+	"oneof":    oneOf,
+	"regexp":   matches,
+	"email":    email,
+	"url":      isURL,
+	"uuid":     isUUID,
+}
+
+// paramCheck reports why param is not a valid parameter of a rule
+// applied to values of typ, which is not a pointer.
+type paramCheck func(typ reflect.Type, param string) error
+
+// builtinParams checks the parameters of the built-in rules taking one,
+// so that malformed tags are reported before any value is validated.
+var builtinParams = map[string]paramCheck{
+	"min":    checkSize,
+	"max":    checkSize,
+	"len":    checkSize,
+	"regexp": checkPattern,
+}
+
+// messages holds the failure messages of the built-in rules, with %s
+// standing for the rule parameter.
+var messages = map[string]string{
+	"required": "is required",
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"len":      "must have a length of %s",
+	"oneof":    "must be one of %s",
+	"regexp":   "must match %s",
+	"email":    "must be a valid email address",
+	"url":      "must be a valid URL",
+	"uuid":     "must be a valid UUID",
+}
+
+func required(value reflect.Value, _ string) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() > 0
+	}
+	return !value.IsZero()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// compare returns a rule comparing the size of a value to its
+// parameter: the value of numbers, the number of characters of strings
+// and the length of slices, arrays and maps. Durations take a
+// time.ParseDuration parameter. Values fail against malformed
+// parameters, which checkSize reports beforehand.
+func compare(ok func(n, param float64) bool) Rule {
+	return func(value reflect.Value, param string) bool {
+		if value.Type() == durationType {
+			d, err := time.ParseDuration(param)
+			return err == nil && ok(float64(value.Int()), float64(d))
+		}
+
+		p, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+		switch value.Kind() {
+		case reflect.String:
+			return ok(float64(utf8.RuneCountInString(value.String())), p)
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return ok(float64(value.Len()), p)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return ok(float64(value.Int()), p)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return ok(float64(value.Uint()), p)
+		case reflect.Float32, reflect.Float64:
+			return ok(value.Float(), p)
+		}
+		return false
+	}
+}
+
+// oneOf checks that a value is one of the space-separated parameter
+// values.
+func oneOf(value reflect.Value, param string) bool {
+	return slices.Contains(strings.Fields(param), fmt.Sprint(value.Interface()))
+}
+
+// checkSize checks the parameter of min, max and len: a duration for
+// durations and a number otherwise. Interface values may hold either.
+func checkSize(typ reflect.Type, param string) error {
+	_, durationErr := time.ParseDuration(param)
+	_, numberErr := strconv.ParseFloat(param, 64)
+	switch {
+	case typ == durationType && durationErr != nil:
+		return fmt.Errorf("invalid duration %q", param)
+	case typ.Kind() == reflect.Interface && durationErr != nil && numberErr != nil,
+		typ != durationType && typ.Kind() != reflect.Interface && numberErr != nil:
+		return fmt.Errorf("invalid number %q", param)
+	}
+	return nil
+}
+
+var patterns sync.Map
+
+// pattern returns the compiled regular expression param.
+func pattern(param string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(param); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(param)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := patterns.LoadOrStore(param, re)
+	return actual.(*regexp.Regexp), nil
+}
+
+func checkPattern(_ reflect.Type, param string) error {
+	_, err := pattern(param)
+	return err
+}
+
+func matches(value reflect.Value, param string) bool {
+	re, err := pattern(param)
+	return err == nil && value.Kind() == reflect.String && re.MatchString(value.String())
+}
+
+func email(value reflect.Value, _ string) bool {
+	if value.Kind() != reflect.String {
+		return false
+	}
+	address, err := mail.ParseAddress(value.String())
+	return err == nil && address.Address == value.String()
+}
+
+func isURL(value reflect.Value, _ string) bool {
+	if value.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.ParseRequestURI(value.String())
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func isUUID(value reflect.Value, _ string) bool {
+	return value.Kind() == reflect.String && uuidPattern.MatchString(value.String())
+}
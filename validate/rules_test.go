@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+func TestRules(t *testing.T) {
+	must := must.New(t)
+	check := func(rule string, value any, param string) bool {
+		return builtinRules[rule](reflect.ValueOf(value), param)
+	}
+
+	must.True(check("required", 1, ""))
+	must.False(check("required", "", ""))
+	must.False(check("required", []int{}, ""))
+
+	must.True(check("min", "héllo", "5"))
+	must.False(check("min", "héllo", "6"))
+	must.True(check("max", uint8(3), "3"))
+	must.True(check("max", 2.5, "3"))
+	must.True(check("len", []int{1, 2}, "2"))
+	must.True(check("len", map[string]int{"a": 1}, "1"))
+	must.True(check("min", 2*time.Second, "1s"))
+	must.False(check("min", true, "1"))
+
+	must.True(check("oneof", 2, "1 2 3"))
+	must.False(check("oneof", "4", "1 2 3"))
+
+	must.True(check("regexp", "abc", "^[a-c]+$"))
+	must.False(check("regexp", 1, "^1$"))
+
+	must.True(check("email", "alice@example.com", ""))
+	must.False(check("email", "alice", ""))
+
+	must.True(check("url", "https://example.com/path", ""))
+	must.False(check("url", "/path", ""))
+
+	must.True(check("uuid", "123E4567-E89B-12D3-A456-426614174000", ""))
+	must.False(check("uuid", "123e4567e89b12d3a456426614174000", ""))
+
+	// Malformed parameters fail rather than panic.
+	must.False(check("min", 1, "one"))
+	must.False(check("min", time.Second, "one"))
+	must.False(check("regexp", "a", "("))
+}
+
+func TestCheckParams(t *testing.T) {
+	must := must.New(t)
+	intType := reflect.TypeOf(0)
+	durationType := reflect.TypeOf(time.Duration(0))
+	anyType := reflect.TypeOf((*any)(nil)).Elem()
+
+	must.Nil(checkSize(intType, "1.5"))
+	must.NotNil(checkSize(intType, "abc"))
+	must.NotNil(checkSize(intType, "1s"))
+	must.Nil(checkSize(durationType, "1s"))
+	must.NotNil(checkSize(durationType, "1"))
+	must.Nil(checkSize(anyType, "1s"))
+	must.NotNil(checkSize(anyType, "abc"))
+	must.Nil(checkPattern(nil, "^a+$"))
+	must.NotNil(checkPattern(nil, "("))
+}
@@ -0,0 +1,366 @@
+// Package validate checks struct values against rules declared in
+// validate struct tags:
+//
+//	type Signup struct {
+//		Email string   `json:"email" validate:"required,email"`
+//		Name  string   `json:"name" validate:"required,min=2,max=64"`
+//		Plan  string   `json:"plan" validate:"omitempty,oneof=free pro"`
+//		Tags  []string `json:"tags" validate:"max=5,dive,min=1"`
+//	}
+//
+// Rules are separated by commas and take an optional parameter after
+// "=". Since its pattern may contain commas, regexp must be the last
+// rule of a tag. Rules before dive apply to a slice, array or map
+// itself and rules after it to each of its elements. omitempty skips
+// the other rules when the value is zero, and nil pointers skip every
+// rule but required.
+//
+// Nested structs, including those pointed to or held in slices, arrays
+// and maps, are validated recursively. Fields are reported by their
+// json name when they have one, as in "items[0].name".
+package validate
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule reports whether value satisfies the rule with param, the text
+// after "=" in the tag. value is never a pointer.
+type Rule func(value reflect.Value, param string) bool
+
+// FieldError describes a value that broke a rule.
+type FieldError struct {
+	// Field is the path of the value, e.g. "items[0].name".
+	Field string
+	// Rule is the name of the broken rule.
+	Rule string
+	// Param is the parameter of the rule.
+	Param string
+	// Message explains the failure, without the field name.
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Errors lists every rule broken by a value.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	texts := make([]string, len(e))
+	for i, err := range e {
+		texts[i] = err.Error()
+	}
+	return "validate: " + strings.Join(texts, "; ")
+}
+
+// Validator checks values against the built-in rules and the ones it
+// was given with Register.
+type Validator struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+	// params checks the parameters of the built-in rules in use.
+	params map[string]paramCheck
+	cache  sync.Map
+}
+
+// New returns a Validator with the built-in rules.
+func New() *Validator {
+	return &Validator{
+		rules:  maps.Clone(builtinRules),
+		params: maps.Clone(builtinParams),
+	}
+}
+
+// Default is the Validator used by Struct and Register.
+var Default = New()
+
+// Struct validates s with Default.
+func Struct(s any) error {
+	return Default.Struct(s)
+}
+
+// Register adds rule to Default.
+func Register(name string, rule Rule) {
+	Default.Register(name, rule)
+}
+
+// Register adds rule under name, replacing any rule with that name.
+func (v *Validator) Register(name string, rule Rule) {
+	if name == "" || rule == nil || name == "dive" || name == "omitempty" {
+		panic("validate: invalid rule " + strconv.Quote(name))
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[name] = rule
+	delete(v.params, name)
+	// Tags are resolved against the rules when first used.
+	v.cache.Clear()
+}
+
+// Struct validates s, a struct or a pointer to one, and returns Errors
+// listing every broken rule, or nil. Other values are not validated.
+// Tags naming unknown rules or giving a malformed parameter to a
+// built-in rule, such as min=abc, are reported as an error that is not
+// Errors, the first time a value of their struct type is validated.
+func (v *Validator) Struct(s any) error {
+	val := indirect(reflect.ValueOf(s))
+	if !val.IsValid() || val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	if err := v.validateStruct(val, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// tagRule is a rule named in a tag.
+type tagRule struct {
+	name  string
+	param string
+}
+
+// fieldRules holds the parsed tag of a struct field.
+type fieldRules struct {
+	index     int
+	name      string
+	omitEmpty bool
+	rules     []tagRule
+	// checks holds the resolved functions of rules.
+	checks []Rule
+	dive   *fieldRules
+}
+
+// structRules is what fieldsOf caches for a struct type.
+type structRules struct {
+	fields []fieldRules
+	err    error
+}
+
+// fieldsOf returns the rules of the fields of the struct type typ, or
+// an error naming the first field whose tag cannot be resolved.
+func (v *Validator) fieldsOf(typ reflect.Type) ([]fieldRules, error) {
+	if cached, ok := v.cache.Load(typ); ok {
+		rules := cached.(structRules)
+		return rules.fields, rules.err
+	}
+
+	rules := structRules{fields: []fieldRules{}}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		fieldRules := parseTag(tag)
+		if err := v.resolve(&fieldRules, field.Type); err != nil {
+			rules = structRules{err: fmt.Errorf("validate: %s.%s: %w", typ, field.Name, err)}
+			break
+		}
+		fieldRules.index = i
+		fieldRules.name = fieldName(field)
+		rules.fields = append(rules.fields, fieldRules)
+	}
+
+	actual, _ := v.cache.LoadOrStore(typ, rules)
+	rules = actual.(structRules)
+	return rules.fields, rules.err
+}
+
+// resolve looks up the rules of field, applying to values of typ, and
+// checks the parameters of the built-in ones.
+func (v *Validator) resolve(field *fieldRules, typ reflect.Type) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.resolveLocked(field, typ)
+}
+
+func (v *Validator) resolveLocked(field *fieldRules, typ reflect.Type) error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	field.checks = make([]Rule, len(field.rules))
+	for i, r := range field.rules {
+		rule, ok := v.rules[r.name]
+		if !ok {
+			return fmt.Errorf("unknown rule %q", r.name)
+		}
+		if check, ok := v.params[r.name]; ok {
+			if err := check(typ, r.param); err != nil {
+				return fmt.Errorf("rule %s: %w", r.name, err)
+			}
+		}
+		field.checks[i] = rule
+	}
+
+	if field.dive == nil {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		typ = typ.Elem()
+	}
+	return v.resolveLocked(field.dive, typ)
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func parseTag(tag string) fieldRules {
+	rules := fieldRules{}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "":
+		case "omitempty":
+			rules.omitEmpty = true
+		case "dive":
+			dive := parseTag(tag)
+			rules.dive = &dive
+			return rules
+		default:
+			rules.rules = append(rules.rules, tagRule{name, param})
+		}
+	}
+	return rules
+}
+
+func (v *Validator) validateStruct(val reflect.Value, path string, errs *Errors) error {
+	fields, err := v.fieldsOf(val.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		name := field.name
+		if path != "" {
+			name = path + "." + name
+		}
+		if err := v.validateValue(val.Field(field.index), field, name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validateValue(val reflect.Value, field fieldRules, path string, errs *Errors) error {
+	if field.omitEmpty && val.IsZero() {
+		return nil
+	}
+	if val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			for _, r := range field.rules {
+				if r.name == "required" {
+					*errs = append(*errs, newFieldError(path, r))
+				}
+			}
+			return nil
+		}
+	}
+	val = indirect(val)
+
+	for i, r := range field.rules {
+		if !field.checks[i](val, r.param) {
+			*errs = append(*errs, newFieldError(path, r))
+		}
+	}
+
+	if field.dive == nil && !mayNest(val.Type()) {
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		return v.validateStruct(val, path, errs)
+	case reflect.Slice, reflect.Array:
+		elem := fieldRules{}
+		if field.dive != nil {
+			elem = *field.dive
+		}
+		for i := 0; i < val.Len(); i++ {
+			if err := v.validateValue(val.Index(i), elem, path+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		elem := fieldRules{}
+		if field.dive != nil {
+			elem = *field.dive
+		}
+		keys := val.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, key := range keys {
+			if err := v.validateValue(val.MapIndex(key), elem, path+"["+fmt.Sprint(key.Interface())+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// mayNest reports whether values of typ may hold structs to validate.
+func mayNest(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return mayNest(typ.Elem())
+	case reflect.Struct:
+		return typ != timeType
+	case reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func indirect(val reflect.Value) reflect.Value {
+	for val.IsValid() && (val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface) {
+		if val.IsNil() {
+			return reflect.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+func newFieldError(path string, r tagRule) *FieldError {
+	message, ok := messages[r.name]
+	if !ok {
+		message = "must satisfy " + r.name
+		if r.param != "" {
+			message += " " + r.param
+		}
+	} else if strings.Contains(message, "%s") {
+		message = fmt.Sprintf(message, r.param)
+	}
+	return &FieldError{Field: path, Rule: r.name, Param: r.param, Message: message}
+}
@@ -0,0 +1,193 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"len=2"`
+}
+
+type item struct {
+	Name     string `json:"name" validate:"required,max=8"`
+	Quantity int    `json:"quantity" validate:"min=1,max=10"`
+}
+
+type order struct {
+	ID       string            `json:"id" validate:"uuid"`
+	Email    string            `json:"email" validate:"required,email"`
+	Website  string            `json:"website" validate:"omitempty,url"`
+	Status   string            `json:"status" validate:"oneof=new paid"`
+	Code     string            `json:"code" validate:"regexp=^[A-Z]{2,3}$"`
+	Timeout  time.Duration     `json:"timeout" validate:"max=1m"`
+	Address  address           `json:"address"`
+	Billing  *address          `json:"billing"`
+	Items    []item            `json:"items" validate:"required,max=2"`
+	Tags     []string          `json:"tags" validate:"dive,min=2"`
+	Labels   map[string]string `json:"labels" validate:"dive,required"`
+	Note     *string           `validate:"required"`
+	Created  time.Time
+	Ignored  string `validate:"-"`
+	internal string `validate:"required"`
+}
+
+func validOrder() order {
+	note := "note"
+	return order{
+		ID:      "123e4567-e89b-12d3-a456-426614174000",
+		Email:   "alice@example.com",
+		Status:  "new",
+		Code:    "ID",
+		Address: address{City: "Jakarta", Country: "ID"},
+		Items:   []item{{Name: "book", Quantity: 1}},
+		Tags:    []string{"go"},
+		Labels:  map[string]string{"a": "b"},
+		Note:    &note,
+	}
+}
+
+func TestStruct(t *testing.T) {
+	must := must.New(t)
+	o := validOrder()
+	must.Nil(Struct(o))
+	must.Nil(Struct(&o))
+	must.Nil(Struct("not a struct"))
+	must.Nil(Struct((*order)(nil)))
+}
+
+func TestStructErrors(t *testing.T) {
+	must := must.New(t)
+	o := validOrder()
+	o.ID = "123"
+	o.Email = "Alice <alice@example.com>"
+	o.Website = "example.com"
+	o.Status = "lost"
+	o.Code = "id"
+	o.Timeout = time.Hour
+	o.Address.Country = "IDN"
+	o.Billing = &address{Country: "ID"}
+	o.Items = []item{{Name: "book", Quantity: 1}, {Name: "notebooks", Quantity: 0}}
+	o.Tags = []string{"go", "x"}
+	o.Labels = map[string]string{"a": "", "b": "c"}
+	o.Note = nil
+
+	err := Struct(o)
+	var errs Errors
+	must.True(errors.As(err, &errs))
+
+	got := []string{}
+	for _, e := range errs {
+		got = append(got, e.Field+":"+e.Rule)
+	}
+	must.Equal([]string{
+		"id:uuid",
+		"email:email",
+		"website:url",
+		"status:oneof",
+		"code:regexp",
+		"timeout:max",
+		"address.country:len",
+		"billing.city:required",
+		"items[1].name:max",
+		"items[1].quantity:min",
+		"tags[1]:min",
+		"labels[a]:required",
+		"Note:required",
+	}, got)
+	must.Equal("status must be one of new paid", errs[3].Error())
+	must.True(strings.HasPrefix(err.Error(), "validate: id must be a valid UUID; "))
+
+	o = validOrder()
+	o.Items = nil
+	errs = Struct(o).(Errors)
+	must.Equal(1, len(errs))
+	must.Equal("items is required", errs[0].Error())
+}
+
+func TestRegister(t *testing.T) {
+	must := must.New(t)
+	v := New()
+	v.Register("even", func(value reflect.Value, _ string) bool {
+		return value.Int()%2 == 0
+	})
+
+	type numbers struct {
+		N int `validate:"even"`
+	}
+	must.Nil(v.Struct(numbers{N: 2}))
+	errs := v.Struct(numbers{N: 3}).(Errors)
+	must.Equal("N must satisfy even", errs[0].Error())
+
+	// Unknown rules are reported as errors that are not Errors.
+	err := Struct(numbers{})
+	_, isErrs := err.(Errors)
+	must.False(isErrs)
+	must.Equal(`validate: validate.numbers.N: unknown rule "even"`, err.Error())
+	must.True(panics(func() { v.Register("dive", nil) }))
+
+	// Registered rules replace built-in ones, parameter checks included.
+	type sized struct {
+		S string `validate:"min=short"`
+	}
+	must.NotNil(v.Struct(sized{}))
+	v.Register("min", func(value reflect.Value, param string) bool {
+		return param == "short"
+	})
+	must.Nil(v.Struct(sized{}))
+}
+
+func TestMalformedTags(t *testing.T) {
+	must := must.New(t)
+	type inner struct {
+		Pattern string `validate:"regexp=("`
+	}
+	for _, tc := range []struct {
+		value any
+		err   string
+	}{
+		{struct {
+			N int `validate:"min=abc"`
+		}{}, `rule min: invalid number "abc"`},
+		{struct {
+			D time.Duration `validate:"max=1"`
+		}{}, `rule max: invalid duration "1"`},
+		{struct {
+			Tags []string `validate:"dive,len=x"`
+		}{}, `rule len: invalid number "x"`},
+		{struct {
+			Timeouts map[string]*time.Duration `validate:"dive,min=1s"`
+		}{Timeouts: map[string]*time.Duration{}}, ""},
+		{struct{ Inner []inner }{Inner: []inner{{}}}, "rule regexp: error parsing regexp"},
+	} {
+		err := Struct(tc.value)
+		if tc.err == "" {
+			must.Nil(err)
+			continue
+		}
+		must.NotNil(err)
+		must.True(strings.Contains(err.Error(), tc.err))
+		// The error is cached with the type, not a panic.
+		must.Equal(err.Error(), Struct(tc.value).Error())
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	must := must.New(t)
+	rules := parseTag("omitempty,min=1,dive,required,regexp=^a,b$")
+	must.True(rules.omitEmpty)
+	must.Equal([]tagRule{{"min", "1"}}, rules.rules)
+	must.Equal([]tagRule{{"required", ""}, {"regexp", "^a,b$"}}, rules.dive.rules)
+}
+
+func panics(fn func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	fn()
+	return false
+}
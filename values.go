@@ -0,0 +1,37 @@
+package ngamux
+
+import (
+	"net/url"
+	"reflect"
+
+	"github.com/ngamux/ngamux/internal/convert"
+)
+
+// decodeValues fills the fields of the struct val tagged with source
+// from values, see convert.DecodeValues.
+func decodeValues(val reflect.Value, values url.Values, source string) []*FieldError {
+	return fieldErrors(source, convert.DecodeValues(val, values, source, "", ""))
+}
+
+// decodeField fills v, the struct field field, from the values named
+// key in source, see convert.DecodeField.
+func decodeField(v reflect.Value, field reflect.StructField, values url.Values, source, key string) []*FieldError {
+	return fieldErrors(source, convert.DecodeField(v, field, values, source, key, field.Name))
+}
+
+// assignField sets v, the struct field field, from the values named key
+// in source, see convert.AssignField.
+func assignField(v reflect.Value, field reflect.StructField, values []string, source, key string) []*FieldError {
+	return fieldErrors(source, convert.AssignField(v, field, values, len(values) > 0, key, field.Name))
+}
+
+func fieldErrors(source string, errs []convert.Error) []*FieldError {
+	if len(errs) == 0 {
+		return nil
+	}
+	fieldErrs := make([]*FieldError, len(errs))
+	for i, err := range errs {
+		fieldErrs[i] = &FieldError{Field: err.Field, Source: source, Key: err.Key, Err: err.Err}
+	}
+	return fieldErrs
+}
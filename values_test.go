@@ -0,0 +1,101 @@
+package ngamux
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/golang-must/must"
+)
+
+type queryFilter struct {
+	Status string   `query:"status"`
+	Tags   []string `query:"tag"`
+}
+
+type queryTypes struct {
+	Int8     int8          `query:"int8"`
+	Int64    int64         `query:"int64"`
+	Uint     uint          `query:"uint"`
+	Uint16   uint16        `query:"uint16"`
+	Float32  float32       `query:"float32"`
+	Optional *int          `query:"optional"`
+	Missing  *int          `query:"missing"`
+	IDs      []int         `query:"id"`
+	Since    time.Time     `query:"since"`
+	Day      time.Time     `query:"day" layout:"2006-01-02"`
+	Epoch    time.Time     `query:"epoch" layout:"unix"`
+	Timeout  time.Duration `query:"timeout"`
+	Addr     netip.Addr    `query:"addr"`
+	Raw      []byte        `query:"raw"`
+	Filter   queryFilter   `query:"filter"`
+	Range    *struct {
+		From int `query:"from"`
+	} `query:"range"`
+	NoRange *struct {
+		From int `query:"from"`
+	} `query:"no_range"`
+	Sort  string   `query:"sort" default:"created_at"`
+	Order []string `query:"order" default:"a,b"`
+	Limit int      `query:"limit" default:"20"`
+}
+
+func TestQueriesParserTypes(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/q?"+
+		"int8=-8&int64=64&uint=1&uint16=16&float32=1.5&optional=0&id=1&id=2&id=3"+
+		"&since=2024-01-02T03:04:05Z&day=2024-05-06&epoch=1700000000&timeout=1m30s"+
+		"&addr=10.0.0.1&raw=bytes&filter[status]=open&filter.tag=a&filter.tag=b"+
+		"&range.from=5&limit=50", nil)
+
+	var qs queryTypes
+	must.Nil(Req(req).QueriesParser(&qs))
+	must.Equal(int8(-8), qs.Int8)
+	must.Equal(int64(64), qs.Int64)
+	must.Equal(uint(1), qs.Uint)
+	must.Equal(uint16(16), qs.Uint16)
+	must.Equal(float32(1.5), qs.Float32)
+	must.NotNil(qs.Optional)
+	must.Equal(0, *qs.Optional)
+	must.Nil(qs.Missing)
+	must.Equal([]int{1, 2, 3}, qs.IDs)
+	must.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), qs.Since)
+	must.Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), qs.Day)
+	must.Equal(int64(1700000000), qs.Epoch.Unix())
+	must.Equal(90*time.Second, qs.Timeout)
+	must.Equal(netip.MustParseAddr("10.0.0.1"), qs.Addr)
+	must.Equal("bytes", string(qs.Raw))
+	must.Equal("open", qs.Filter.Status)
+	must.Equal([]string{"a", "b"}, qs.Filter.Tags)
+	must.NotNil(qs.Range)
+	must.Equal(5, qs.Range.From)
+	must.Nil(qs.NoRange)
+	must.Equal("created_at", qs.Sort)
+	must.Equal([]string{"a", "b"}, qs.Order)
+	must.Equal(50, qs.Limit)
+}
+
+func TestQueriesParserErrors(t *testing.T) {
+	must := must.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/q?int8=300&uint=-1&day=2024&filter[status]=x&id=1&id=x", nil)
+
+	var qs queryTypes
+	err := Req(req).QueriesParser(&qs)
+	bindErr := &BindError{}
+	must.True(errors.As(err, &bindErr))
+	must.Equal(4, len(bindErr.Fields))
+	must.Equal("Int8", bindErr.Fields[0].Field)
+	must.Equal("uint", bindErr.Fields[1].Key)
+	must.Equal("IDs", bindErr.Fields[2].Field)
+	must.Equal("day", bindErr.Fields[3].Key)
+	must.Equal("x", qs.Filter.Status)
+
+	var unsupported struct {
+		Value chan int `query:"value"`
+	}
+	req = httptest.NewRequest(http.MethodGet, "/q?value=1", nil)
+	must.True(errors.Is(Req(req).QueriesParser(&unsupported), errUnsupportedFieldType))
+}